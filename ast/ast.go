@@ -2,6 +2,8 @@ package ast
 
 import (
 	"bytes"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/jarviliam/inti/token"
@@ -10,6 +12,7 @@ import (
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() token.Position
 }
 
 type Statement interface {
@@ -22,6 +25,18 @@ type Expression interface {
 	expressionNode()
 }
 
+// str returns n.String(), or "" for a node missing from a tree the parser
+// gave up on part way through.
+func str(n Node) string {
+	if n == nil {
+		return ""
+	}
+	if v := reflect.ValueOf(n); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ""
+	}
+	return n.String()
+}
+
 type Program struct {
 	Statements []Statement
 }
@@ -30,7 +45,7 @@ func (p *Program) String() string {
 	var out bytes.Buffer
 
 	for _, s := range p.Statements {
-		out.WriteString(s.String())
+		out.WriteString(str(s))
 	}
 	return out.String()
 }
@@ -40,43 +55,86 @@ func (p *Program) TokenLiteral() string {
 	}
 	return ""
 }
+func (p *Program) Pos() token.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return token.Position{Line: 1, Column: 1}
+}
 
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
-	Value Expression
+	// Pattern is set instead of Name when the value is destructured.
+	Pattern Pattern
+	Value   Expression
+	// Exported is set for top-level lets marked export, which importers see.
+	Exported bool
 }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
+	if ls.Exported {
+		out.WriteString("export ")
+	}
 	out.WriteString(ls.TokenLiteral() + " ")
-	out.WriteString(ls.Name.String())
+	if ls.Pattern != nil {
+		out.WriteString(str(ls.Pattern))
+	} else {
+		out.WriteString(str(ls.Name))
+	}
 	out.WriteString(" = ")
 
 	if ls.Value != nil {
-		out.WriteString(ls.Value.String())
+		out.WriteString(str(ls.Value))
 	}
 	out.WriteString(";")
 	return out.String()
 }
+
+// Names returns the identifiers the let binds.
+func (ls *LetStatement) Names() []*Identifier {
+	if ls.Pattern != nil {
+		return PatternNames(ls.Pattern)
+	}
+	return []*Identifier{ls.Name}
+}
+
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos }
 
 type Identifier struct {
 	Token token.Token
 	Value string
+	Type  *TypeAnnotation // optional, on let bindings and params
 }
 
 func (i *Identifier) expressionNode() {}
+func (i *Identifier) patternNode()    {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() token.Position { return i.Token.Pos }
 func (i *Identifier) String() string {
+	if i.Type != nil {
+		return i.Value + ": " + str(i.Type)
+	}
 	return i.Value
 }
 
+// TypeAnnotation names the expected type of a binding or return value.
+type TypeAnnotation struct {
+	Token token.Token
+	Name  string
+}
+
+func (t *TypeAnnotation) TokenLiteral() string { return t.Token.Literal }
+func (t *TypeAnnotation) Pos() token.Position  { return t.Token.Pos }
+func (t *TypeAnnotation) String() string       { return t.Name }
+
 type ReturnStatement struct {
 	Token       token.Token //'return'
 	ReturnValue Expression
@@ -86,11 +144,12 @@ func (r *ReturnStatement) statementNode() {}
 func (r *ReturnStatement) TokenLiteral() string {
 	return r.Token.Literal
 }
+func (r *ReturnStatement) Pos() token.Position { return r.Token.Pos }
 func (r *ReturnStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(r.TokenLiteral() + " ")
 	if r.ReturnValue != nil {
-		out.WriteString(r.ReturnValue.String())
+		out.WriteString(str(r.ReturnValue))
 	}
 	out.WriteString(";")
 	return out.String()
@@ -103,9 +162,10 @@ type ExpressionStatement struct {
 
 func (e *ExpressionStatement) statementNode()       {}
 func (e *ExpressionStatement) TokenLiteral() string { return e.Token.Literal }
+func (e *ExpressionStatement) Pos() token.Position  { return e.Token.Pos }
 func (e *ExpressionStatement) String() string {
 	if e.Expression != nil {
-		return e.Expression.String()
+		return str(e.Expression)
 	}
 	return ""
 }
@@ -119,6 +179,7 @@ func (i *IntegerLiteral) expressionNode() {}
 func (i *IntegerLiteral) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *IntegerLiteral) Pos() token.Position { return i.Token.Pos }
 func (i *IntegerLiteral) String() string {
 	return i.Token.Literal
 }
@@ -131,12 +192,13 @@ type PrefixExpression struct {
 
 func (p *PrefixExpression) expressionNode()      {}
 func (p *PrefixExpression) TokenLiteral() string { return p.Token.Literal }
+func (p *PrefixExpression) Pos() token.Position  { return p.Token.Pos }
 func (p *PrefixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
 	out.WriteString(p.Operator)
-	out.WriteString(p.Right.String())
+	out.WriteString(str(p.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -151,13 +213,14 @@ type InfixExpression struct {
 
 func (i *InfixExpression) expressionNode()      {}
 func (i *InfixExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *InfixExpression) Pos() token.Position  { return i.Token.Pos }
 func (i *InfixExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("(")
-	out.WriteString(i.Left.String())
+	out.WriteString(str(i.Left))
 	out.WriteString(" " + i.Operator + " ")
-	out.WriteString(i.Right.String())
+	out.WriteString(str(i.Right))
 	out.WriteString(")")
 
 	return out.String()
@@ -170,6 +233,7 @@ type Boolean struct {
 
 func (b *Boolean) expressionNode()      {}
 func (b *Boolean) TokenLiteral() string { return b.Token.Literal }
+func (b *Boolean) Pos() token.Position  { return b.Token.Pos }
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -183,16 +247,17 @@ type IfExpression struct {
 
 func (i *IfExpression) expressionNode()      {}
 func (i *IfExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IfExpression) Pos() token.Position  { return i.Token.Pos }
 func (i *IfExpression) String() string {
 	var out bytes.Buffer
 
 	out.WriteString("if")
-	out.WriteString(i.Condition.String())
+	out.WriteString(str(i.Condition))
 	out.WriteString(" ")
-	out.WriteString(i.Consequence.String())
+	out.WriteString(str(i.Consequence))
 	if i.Alternative != nil {
 		out.WriteString("else ")
-		out.WriteString(i.Alternative.String())
+		out.WriteString(str(i.Alternative))
 	}
 
 	return out.String()
@@ -201,27 +266,59 @@ func (i *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	End        token.Position // closing '}'
 }
 
 func (b *BlockStatement) expressionNode()      {}
 func (b *BlockStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BlockStatement) Pos() token.Position  { return b.Token.Pos }
 func (b *BlockStatement) String() string {
 	var out bytes.Buffer
 
 	for _, s := range b.Statements {
-		out.WriteString(s.String())
+		out.WriteString(str(s))
 	}
 	return out.String()
 }
 
+// Param is a function parameter. Default is evaluated for each call not
+// given an argument for it. A Variadic param comes last and binds an array
+// of the remaining arguments.
+type Param struct {
+	Pattern  Pattern
+	Default  Expression // optional
+	Variadic bool
+}
+
+// Name returns the identifier the param binds, unless it is destructured.
+func (p *Param) Name() (*Identifier, bool) {
+	ident, ok := p.Pattern.(*Identifier)
+	return ident, ok
+}
+
+func (p *Param) String() string {
+	switch {
+	case p.Variadic:
+		return "..." + str(p.Pattern)
+	case p.Default != nil:
+		return str(p.Pattern) + " = " + str(p.Default)
+	}
+	return str(p.Pattern)
+}
+
 type FunctionLiteral struct {
 	Token  token.Token
-	Params []*Identifier
-	Block  *BlockStatement
+	Params []*Param
+	// Generator is set when the body yields. Calling a generator returns an
+	// iterator over the values it yields.
+	Generator  bool
+	ReturnType *TypeAnnotation // optional
+	Block      *BlockStatement
 }
 
 func (f *FunctionLiteral) expressionNode()      {}
 func (f *FunctionLiteral) TokenLiteral() string { return f.Token.Literal }
+func (f *FunctionLiteral) Pos() token.Position  { return f.Token.Pos }
 func (f *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -233,10 +330,32 @@ func (f *FunctionLiteral) String() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ","))
 	out.WriteString(")")
-	out.WriteString(f.Block.String())
+	if f.ReturnType != nil {
+		out.WriteString(" -> " + str(f.ReturnType) + " ")
+	}
+	out.WriteString(str(f.Block))
 	return out.String()
 }
 
+// MacroLiteral is a macro, which is passed the code of its arguments as
+// quotes and returns a quote of the code to replace its call with.
+type MacroLiteral struct {
+	Token  token.Token // 'macro'
+	Params []*Identifier
+	Body   *BlockStatement
+}
+
+func (m *MacroLiteral) expressionNode()      {}
+func (m *MacroLiteral) TokenLiteral() string { return m.Token.Literal }
+func (m *MacroLiteral) Pos() token.Position  { return m.Token.Pos }
+func (m *MacroLiteral) String() string {
+	params := make([]string, len(m.Params))
+	for i, p := range m.Params {
+		params[i] = str(p)
+	}
+	return m.TokenLiteral() + "(" + strings.Join(params, ",") + ")" + str(m.Body)
+}
+
 type CallExpression struct {
 	Token    token.Token
 	Function Expression
@@ -245,16 +364,343 @@ type CallExpression struct {
 
 func (c *CallExpression) expressionNode()      {}
 func (c *CallExpression) TokenLiteral() string { return c.Token.Literal }
+func (c *CallExpression) Pos() token.Position  { return c.Token.Pos }
 func (c *CallExpression) String() string {
 	var out bytes.Buffer
 
 	args := []string{}
 	for _, s := range c.Args {
-		args = append(args, s.String())
+		args = append(args, str(s))
 	}
-	out.WriteString(c.Function.String())
+	out.WriteString(str(c.Function))
 	out.WriteString("(")
 	out.WriteString(strings.Join(args, ","))
 	out.WriteString(")")
 	return out.String()
 }
+
+// SpreadExpression passes the elements of an array as separate arguments,
+// as in f(...xs).
+type SpreadExpression struct {
+	Token token.Token // '...'
+	Value Expression
+}
+
+func (s *SpreadExpression) expressionNode()      {}
+func (s *SpreadExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SpreadExpression) Pos() token.Position  { return s.Token.Pos }
+func (s *SpreadExpression) String() string       { return "..." + str(s.Value) }
+
+// NamedArgument passes Value for the parameter called Name, as in f(b: 3).
+type NamedArgument struct {
+	Name  *Identifier
+	Value Expression
+}
+
+func (n *NamedArgument) expressionNode()      {}
+func (n *NamedArgument) TokenLiteral() string { return n.Name.TokenLiteral() }
+func (n *NamedArgument) Pos() token.Position  { return n.Name.Pos() }
+func (n *NamedArgument) String() string       { return n.Name.Value + ": " + str(n.Value) }
+
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (s *StringLiteral) expressionNode()      {}
+func (s *StringLiteral) TokenLiteral() string { return s.Token.Literal }
+func (s *StringLiteral) Pos() token.Position  { return s.Token.Pos }
+func (s *StringLiteral) String() string       { return strconv.Quote(s.Value) }
+
+type ArrayLiteral struct {
+	Token    token.Token // '['
+	Elements []Expression
+}
+
+func (a *ArrayLiteral) expressionNode()      {}
+func (a *ArrayLiteral) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayLiteral) Pos() token.Position  { return a.Token.Pos }
+func (a *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, str(e))
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+type HashLiteral struct {
+	Token token.Token // '{'
+	Pairs []HashPair  // in source order
+}
+
+func (h *HashLiteral) expressionNode()      {}
+func (h *HashLiteral) TokenLiteral() string { return h.Token.Literal }
+func (h *HashLiteral) Pos() token.Position  { return h.Token.Pos }
+func (h *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, p := range h.Pairs {
+		pairs = append(pairs, str(p.Key)+": "+str(p.Value))
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type IndexExpression struct {
+	Token token.Token // '['
+	Left  Expression
+	Index Expression
+}
+
+func (i *IndexExpression) expressionNode()      {}
+func (i *IndexExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *IndexExpression) Pos() token.Position  { return i.Token.Pos }
+func (i *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(str(i.Left))
+	out.WriteString("[")
+	out.WriteString(str(i.Index))
+	out.WriteString("])")
+	return out.String()
+}
+
+type ImportExpression struct {
+	Token token.Token // 'import'
+	Path  string
+}
+
+func (i *ImportExpression) expressionNode()      {}
+func (i *ImportExpression) TokenLiteral() string { return i.Token.Literal }
+func (i *ImportExpression) Pos() token.Position  { return i.Token.Pos }
+func (i *ImportExpression) String() string {
+	return "import " + strconv.Quote(i.Path)
+}
+
+// ImportStatement binds names exported by a module, as in
+// import { a, b as c } from "mod".
+type ImportStatement struct {
+	Token token.Token // 'import'
+	Specs []*ImportSpec
+	Path  string
+}
+
+// ImportSpec is one imported name, bound to Alias if it is set.
+type ImportSpec struct {
+	Name  *Identifier
+	Alias *Identifier
+}
+
+// Local returns the identifier the import binds.
+func (s *ImportSpec) Local() *Identifier {
+	if s.Alias != nil {
+		return s.Alias
+	}
+	return s.Name
+}
+
+func (s *ImportSpec) String() string {
+	if s.Alias != nil {
+		return str(s.Name) + " as " + str(s.Alias)
+	}
+	return str(s.Name)
+}
+
+func (i *ImportStatement) statementNode()       {}
+func (i *ImportStatement) TokenLiteral() string { return i.Token.Literal }
+func (i *ImportStatement) Pos() token.Position  { return i.Token.Pos }
+func (i *ImportStatement) String() string {
+	specs := make([]string, len(i.Specs))
+	for n, s := range i.Specs {
+		specs[n] = s.String()
+	}
+	return "import { " + strings.Join(specs, ", ") + " } from " + strconv.Quote(i.Path) + ";"
+}
+
+// MemberExpression is a member of a module, as in mod.fn.
+type MemberExpression struct {
+	Token  token.Token // '.'
+	Object Expression
+	Member *Identifier
+}
+
+func (m *MemberExpression) expressionNode()      {}
+func (m *MemberExpression) TokenLiteral() string { return m.Token.Literal }
+func (m *MemberExpression) Pos() token.Position  { return m.Token.Pos }
+func (m *MemberExpression) String() string {
+	return "(" + str(m.Object) + "." + str(m.Member) + ")"
+}
+
+// ThrowStatement raises its value as an error, which the nearest enclosing
+// try catches.
+type ThrowStatement struct {
+	Token token.Token // 'throw'
+	Value Expression
+}
+
+func (t *ThrowStatement) statementNode()       {}
+func (t *ThrowStatement) TokenLiteral() string { return t.Token.Literal }
+func (t *ThrowStatement) Pos() token.Position  { return t.Token.Pos }
+func (t *ThrowStatement) String() string {
+	return "throw " + str(t.Value) + ";"
+}
+
+// YieldStatement hands its value to the caller of the generator it is in,
+// which resumes after it when the next value is wanted.
+type YieldStatement struct {
+	Token token.Token // 'yield'
+	Value Expression
+}
+
+func (y *YieldStatement) statementNode()       {}
+func (y *YieldStatement) TokenLiteral() string { return y.Token.Literal }
+func (y *YieldStatement) Pos() token.Position  { return y.Token.Pos }
+func (y *YieldStatement) String() string {
+	return "yield " + str(y.Value) + ";"
+}
+
+// OperatorDeclaration declares the infix operator Operator, applying the
+// function Value to its operands.
+type OperatorDeclaration struct {
+	Token      token.Token // 'infixl' or 'infixr'
+	Precedence int
+	Operator   string
+	Value      Expression
+}
+
+func (o *OperatorDeclaration) statementNode()       {}
+func (o *OperatorDeclaration) TokenLiteral() string { return o.Token.Literal }
+func (o *OperatorDeclaration) Pos() token.Position  { return o.Token.Pos }
+func (o *OperatorDeclaration) String() string {
+	return o.Token.Literal + " " + strconv.Itoa(o.Precedence) + " " + o.Operator + " = " + str(o.Value) + ";"
+}
+
+// TryExpression evaluates Block, then Catch with Param bound to the error if
+// Block raised one, then Finally. It has at least one of Catch and Finally.
+type TryExpression struct {
+	Token   token.Token // 'try'
+	Block   *BlockStatement
+	Param   *Identifier // set with Catch
+	Catch   *BlockStatement
+	Finally *BlockStatement
+}
+
+func (t *TryExpression) expressionNode()      {}
+func (t *TryExpression) TokenLiteral() string { return t.Token.Literal }
+func (t *TryExpression) Pos() token.Position  { return t.Token.Pos }
+func (t *TryExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("try ")
+	out.WriteString(str(t.Block))
+	if t.Catch != nil {
+		out.WriteString("catch(" + str(t.Param) + ") ")
+		out.WriteString(str(t.Catch))
+	}
+	if t.Finally != nil {
+		out.WriteString("finally ")
+		out.WriteString(str(t.Finally))
+	}
+	return out.String()
+}
+
+// ForStatement evaluates Body with Var bound to each element of Iterable in
+// turn, as in for (x in xs) { }.
+type ForStatement struct {
+	Token    token.Token // 'for'
+	Var      *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (f *ForStatement) statementNode()       {}
+func (f *ForStatement) TokenLiteral() string { return f.Token.Literal }
+func (f *ForStatement) Pos() token.Position  { return f.Token.Pos }
+func (f *ForStatement) String() string {
+	return "for(" + str(f.Var) + " in " + str(f.Iterable) + ") " + str(f.Body)
+}
+
+// BranchStatement is a break or continue, told apart by its token.
+type BranchStatement struct {
+	Token token.Token // 'break' or 'continue'
+}
+
+func (b *BranchStatement) statementNode()       {}
+func (b *BranchStatement) TokenLiteral() string { return b.Token.Literal }
+func (b *BranchStatement) Pos() token.Position  { return b.Token.Pos }
+func (b *BranchStatement) String() string       { return b.Token.Literal + ";" }
+
+// SpawnExpression makes Call on a task of its own, evaluating to a handle
+// its result can be awaited through.
+type SpawnExpression struct {
+	Token token.Token // 'spawn'
+	Call  *CallExpression
+}
+
+func (s *SpawnExpression) expressionNode()      {}
+func (s *SpawnExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SpawnExpression) Pos() token.Position  { return s.Token.Pos }
+func (s *SpawnExpression) String() string       { return "spawn " + str(s.Call) }
+
+// SelectExpression waits until one of its cases can go ahead, then
+// evaluates to its body. With a default case, it does not wait.
+type SelectExpression struct {
+	Token token.Token // 'select'
+	Cases []*SelectCase
+	End   token.Position // closing '}'
+}
+
+// SelectCase is a case of a select. Send cases send Value on Channel, and
+// receive cases bind the value received from Channel to Var, if set. The
+// default case has neither.
+type SelectCase struct {
+	Token   token.Token // 'send', 'receive' or '_'
+	Channel Expression
+	Value   Expression
+	Var     *Identifier
+	Body    Expression
+}
+
+// IsDefault reports whether c is the default case.
+func (c *SelectCase) IsDefault() bool { return c.Channel == nil }
+
+func (c *SelectCase) String() string {
+	var out string
+	switch {
+	case c.IsDefault():
+		out = "_"
+	case c.Value != nil:
+		out = "send(" + str(c.Channel) + ", " + str(c.Value) + ")"
+	default:
+		out = "receive(" + str(c.Channel) + ")"
+		if c.Var != nil {
+			out += " as " + c.Var.Value
+		}
+	}
+	return out + " => " + str(c.Body)
+}
+
+func (s *SelectExpression) expressionNode()      {}
+func (s *SelectExpression) TokenLiteral() string { return s.Token.Literal }
+func (s *SelectExpression) Pos() token.Position  { return s.Token.Pos }
+func (s *SelectExpression) String() string {
+	cases := make([]string, len(s.Cases))
+	for i, c := range s.Cases {
+		cases[i] = c.String()
+	}
+	return "select { " + strings.Join(cases, ", ") + " }"
+}
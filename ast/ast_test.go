@@ -1,6 +1,7 @@
 package ast
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/jarviliam/inti/token"
@@ -27,3 +28,123 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestStringPartial(t *testing.T) {
+	// nodes the parser gave up on have missing children
+	minus := token.Token{Type: token.MINUS, Literal: "-"}
+	tests := []struct {
+		node     Node
+		expected string
+	}{
+		{&InfixExpression{Token: minus, Operator: "-", Left: &Identifier{Value: "a"}}, "(a - )"},
+		{&PrefixExpression{Token: minus, Operator: "-"}, "(-)"},
+		{&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: &Identifier{Value: "x"}}, "let x = ;"},
+		{&IfExpression{Condition: &Identifier{Value: "ok"}, Consequence: (*BlockStatement)(nil)}, "ifok "},
+	}
+	for _, tt := range tests {
+		if got := tt.node.String(); got != tt.expected {
+			t.Errorf("wrong string. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{
+				Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 1}},
+				Expression: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Pos: token.Position{Line: 1, Column: 1}},
+					Value: "x",
+				},
+			},
+		},
+	}
+
+	got, err := JSON(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "node": "Program",
+  "statements": [
+    {
+      "expression": {
+        "node": "Identifier",
+        "pos": "1:1",
+        "type": null,
+        "value": "x"
+      },
+      "node": "ExpressionStatement",
+      "pos": "1:1"
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("JSON wrong.\nwant=%s\n got=%s", want, got)
+	}
+}
+
+func TestModify(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Token: token.Token{Type: token.LET, Literal: "let"}, Name: ident("a"), Value: ident("one")},
+			&ExpressionStatement{Expression: &InfixExpression{Left: ident("one"), Operator: "+", Right: &ArrayLiteral{
+				Elements: []Expression{ident("one"), &FunctionLiteral{Token: token.Token{Type: token.FUNCTION, Literal: "fn"}, Params: []*Param{{Pattern: ident("one")}}, Block: &BlockStatement{}}},
+			}}},
+			&ExpressionStatement{Expression: ident("drop")},
+		},
+	}
+	before := program.String()
+
+	modified := Modify(program, func(node Node) Node {
+		switch node := node.(type) {
+		case *Identifier:
+			if node.Value == "one" {
+				return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1"}, Value: 1}
+			}
+		case *ExpressionStatement:
+			if ident, ok := node.Expression.(*Identifier); ok && ident.Value == "drop" {
+				return nil
+			}
+		}
+		return node
+	})
+
+	// a literal cannot stand for a param, so the param is kept
+	if got, want := modified.String(), "let a = 1;(1 + [1, fn(one)])"; got != want {
+		t.Errorf("wrong modified program. want=%q, got=%q", want, got)
+	}
+	if got := program.String(); got != before {
+		t.Errorf("original program changed. want=%q, got=%q", before, got)
+	}
+}
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+	}
+	program := &Program{
+		Statements: []Statement{
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: &MemberExpression{Object: ident("a"), Member: ident("b")},
+				Args:     []Expression{ident("c"), &FunctionLiteral{Params: []*Param{{Pattern: ident("d")}}, Block: &BlockStatement{}}},
+			}},
+		},
+	}
+
+	var names []string
+	Inspect(program, func(node Node) bool {
+		if ident, ok := node.(*Identifier); ok {
+			names = append(names, ident.Value)
+		}
+		_, fn := node.(*FunctionLiteral)
+		return !fn
+	})
+	if got, want := strings.Join(names, " "), "a c"; got != want {
+		t.Errorf("wrong identifiers visited. want=%q, got=%q", want, got)
+	}
+}
@@ -0,0 +1,61 @@
+package ast
+
+import (
+	"encoding/json"
+	"reflect"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jarviliam/inti/token"
+)
+
+// JSON encodes the tree under node as indented JSON. Each node becomes an
+// object naming its type, with its token reduced to a position.
+func JSON(node Node) ([]byte, error) {
+	return json.MarshalIndent(nodeJSON(reflect.ValueOf(node)), "", "  ")
+}
+
+var (
+	tokenType    = reflect.TypeOf(token.Token{})
+	positionType = reflect.TypeOf(token.Position{})
+)
+
+// nodeJSON converts the value of a tree into values encoding/json can print.
+func nodeJSON(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return nodeJSON(v.Elem())
+	case reflect.Slice:
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = nodeJSON(v.Index(i))
+		}
+		return list
+	case reflect.Struct:
+		if v.Type() == positionType {
+			return v.Interface().(token.Position).String()
+		}
+		m := map[string]interface{}{"node": v.Type().Name()}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Type == tokenType {
+				m["pos"] = v.Field(i).Interface().(token.Token).Pos.String()
+				continue
+			}
+			m[lowerFirst(field.Name)] = nodeJSON(v.Field(i))
+		}
+		return m
+	}
+	return v.Interface()
+}
+
+func lowerFirst(s string) string {
+	r, n := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[n:]
+}
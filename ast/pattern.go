@@ -0,0 +1,142 @@
+package ast
+
+import (
+	"strings"
+
+	"github.com/jarviliam/inti/token"
+)
+
+// Pattern is matched against a value, binding the names in it. An
+// Identifier binds the whole value, except _, which binds nothing.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+// LiteralPattern matches values equal to an integer, string or boolean
+// literal.
+type LiteralPattern struct {
+	Token token.Token
+	Value Expression
+}
+
+func (l *LiteralPattern) patternNode()         {}
+func (l *LiteralPattern) TokenLiteral() string { return l.Token.Literal }
+func (l *LiteralPattern) Pos() token.Position  { return l.Token.Pos }
+func (l *LiteralPattern) String() string       { return str(l.Value) }
+
+// ArrayPattern matches arrays element by element, as in [h, ...t]. Without
+// Rest, the lengths must be equal.
+type ArrayPattern struct {
+	Token    token.Token // '['
+	Elements []Pattern
+	Rest     *Identifier // optional, bound to the remaining elements
+}
+
+func (a *ArrayPattern) patternNode()         {}
+func (a *ArrayPattern) TokenLiteral() string { return a.Token.Literal }
+func (a *ArrayPattern) Pos() token.Position  { return a.Token.Pos }
+func (a *ArrayPattern) String() string {
+	elements := make([]string, 0, len(a.Elements)+1)
+	for _, el := range a.Elements {
+		elements = append(elements, str(el))
+	}
+	if a.Rest != nil {
+		elements = append(elements, "..."+str(a.Rest))
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// HashPatternPair matches the value under Key against Value. An Identifier
+// key stands for the string of its name, and a pair written as just a name,
+// as in {name}, has that Identifier as both Key and Value.
+type HashPatternPair struct {
+	Key   Expression
+	Value Pattern
+}
+
+func (p HashPatternPair) String() string {
+	if k, ok := p.Key.(*Identifier); ok && Pattern(k) == p.Value {
+		return k.String()
+	}
+	return str(p.Key) + ": " + str(p.Value)
+}
+
+// HashPattern matches hashes holding each of its keys, whatever their other
+// keys, as in {"name": n} or {name, age: years}.
+type HashPattern struct {
+	Token token.Token // '{'
+	Pairs []HashPatternPair
+}
+
+func (h *HashPattern) patternNode()         {}
+func (h *HashPattern) TokenLiteral() string { return h.Token.Literal }
+func (h *HashPattern) Pos() token.Position  { return h.Token.Pos }
+func (h *HashPattern) String() string {
+	pairs := make([]string, len(h.Pairs))
+	for i, p := range h.Pairs {
+		pairs[i] = p.String()
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// PatternNames returns the identifiers pat binds, in source order.
+func PatternNames(pat Pattern) []*Identifier {
+	var names []*Identifier
+	var walk func(Pattern)
+	walk = func(pat Pattern) {
+		switch pat := pat.(type) {
+		case *Identifier:
+			if pat.Value != "_" {
+				names = append(names, pat)
+			}
+		case *ArrayPattern:
+			for _, el := range pat.Elements {
+				walk(el)
+			}
+			if pat.Rest != nil {
+				walk(pat.Rest)
+			}
+		case *HashPattern:
+			for _, pair := range pat.Pairs {
+				walk(pair.Value)
+			}
+		}
+	}
+	walk(pat)
+	return names
+}
+
+// MatchExpression evaluates the body of the first arm whose pattern matches
+// Subject and whose guard, if any, holds.
+type MatchExpression struct {
+	Token   token.Token // 'match'
+	Subject Expression
+	Arms    []*MatchArm
+	End     token.Position // closing '}'
+}
+
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expression // optional
+	Body    Expression
+}
+
+func (a *MatchArm) String() string {
+	out := str(a.Pattern)
+	if a.Guard != nil {
+		out += " if " + str(a.Guard)
+	}
+	return out + " => " + str(a.Body)
+}
+
+func (m *MatchExpression) expressionNode()      {}
+func (m *MatchExpression) TokenLiteral() string { return m.Token.Literal }
+func (m *MatchExpression) Pos() token.Position  { return m.Token.Pos }
+func (m *MatchExpression) String() string {
+	arms := make([]string, len(m.Arms))
+	for i, arm := range m.Arms {
+		arms[i] = arm.String()
+	}
+	return "match (" + str(m.Subject) + ") { " + strings.Join(arms, ", ") + " }"
+}
@@ -0,0 +1,394 @@
+package ast
+
+// Inspect calls f for node and, while f returns true, for each of the nodes
+// in it, depth first. The names of members, named arguments and hash
+// pattern keys are not visited, as they refer to nothing in scope.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+	for _, child := range children(node) {
+		Inspect(child, f)
+	}
+}
+
+func children(node Node) []Node {
+	var nodes []Node
+	add := func(ns ...Node) {
+		for _, n := range ns {
+			// typed nils stand for missing optional parts
+			switch n := n.(type) {
+			case nil:
+				continue
+			case *Identifier:
+				if n == nil {
+					continue
+				}
+			case *BlockStatement:
+				if n == nil {
+					continue
+				}
+			case *CallExpression:
+				if n == nil {
+					continue
+				}
+			}
+			nodes = append(nodes, n)
+		}
+	}
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			add(s)
+		}
+	case *ExpressionStatement:
+		add(node.Expression)
+	case *LetStatement:
+		add(node.Name, node.Pattern, node.Value)
+	case *ReturnStatement:
+		add(node.ReturnValue)
+	case *ThrowStatement:
+		add(node.Value)
+	case *YieldStatement:
+		add(node.Value)
+	case *OperatorDeclaration:
+		add(node.Value)
+	case *ForStatement:
+		add(node.Var, node.Iterable, node.Body)
+	case *PrefixExpression:
+		add(node.Right)
+	case *InfixExpression:
+		add(node.Left, node.Right)
+	case *IfExpression:
+		add(node.Condition, node.Consequence, node.Alternative)
+	case *FunctionLiteral:
+		for _, p := range node.Params {
+			add(p.Pattern, p.Default)
+		}
+		add(node.Block)
+	case *MacroLiteral:
+		for _, p := range node.Params {
+			add(p)
+		}
+		add(node.Body)
+	case *CallExpression:
+		add(node.Function)
+		for _, a := range node.Args {
+			add(a)
+		}
+	case *SpreadExpression:
+		add(node.Value)
+	case *NamedArgument:
+		add(node.Value)
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			add(el)
+		}
+	case *HashLiteral:
+		for _, pair := range node.Pairs {
+			add(pair.Key, pair.Value)
+		}
+	case *IndexExpression:
+		add(node.Left, node.Index)
+	case *MemberExpression:
+		add(node.Object)
+	case *TryExpression:
+		add(node.Block, node.Param, node.Catch, node.Finally)
+	case *MatchExpression:
+		add(node.Subject)
+		for _, arm := range node.Arms {
+			add(arm.Pattern, arm.Guard, arm.Body)
+		}
+	case *SpawnExpression:
+		add(node.Call)
+	case *SelectExpression:
+		for _, c := range node.Cases {
+			add(c.Channel, c.Value, c.Var, c.Body)
+		}
+	case *ArrayPattern:
+		for _, el := range node.Elements {
+			add(el)
+		}
+		add(node.Rest)
+	case *HashPattern:
+		for _, pair := range node.Pairs {
+			add(pair.Value)
+		}
+	}
+	return nodes
+}
+
+// Modify returns a copy of node in which each node, children first, is
+// replaced by what modifier returns for its copy. node itself is left as it
+// was. Statements modifier returns nil for are dropped; other nodes it
+// replaces with a node that cannot stand in their place are kept.
+func Modify(node Node, modifier func(Node) Node) Node {
+	m := &modifying{modifier}
+	return m.modifier(m.copy(node))
+}
+
+type modifying struct {
+	modifier func(Node) Node
+}
+
+// copy returns a copy of node with its children modified.
+func (m *modifying) copy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		n := *node
+		n.Statements = m.statements(node.Statements)
+		return &n
+	case *BlockStatement:
+		n := *node
+		n.Statements = m.statements(node.Statements)
+		return &n
+	case *ExpressionStatement:
+		n := *node
+		n.Expression = m.expression(node.Expression)
+		return &n
+	case *LetStatement:
+		n := *node
+		n.Name = m.identifier(node.Name)
+		n.Pattern = m.pattern(node.Pattern)
+		n.Value = m.expression(node.Value)
+		return &n
+	case *ReturnStatement:
+		n := *node
+		n.ReturnValue = m.expression(node.ReturnValue)
+		return &n
+	case *ThrowStatement:
+		n := *node
+		n.Value = m.expression(node.Value)
+		return &n
+	case *YieldStatement:
+		n := *node
+		n.Value = m.expression(node.Value)
+		return &n
+	case *OperatorDeclaration:
+		n := *node
+		n.Value = m.expression(node.Value)
+		return &n
+	case *ForStatement:
+		n := *node
+		n.Var = m.identifier(node.Var)
+		n.Iterable = m.expression(node.Iterable)
+		n.Body = m.block(node.Body)
+		return &n
+	case *BranchStatement:
+		n := *node
+		return &n
+	case *ImportStatement:
+		n := *node
+		return &n
+	case *Identifier:
+		n := *node
+		return &n
+	case *IntegerLiteral:
+		n := *node
+		return &n
+	case *Boolean:
+		n := *node
+		return &n
+	case *StringLiteral:
+		n := *node
+		return &n
+	case *ImportExpression:
+		n := *node
+		return &n
+	case *PrefixExpression:
+		n := *node
+		n.Right = m.expression(node.Right)
+		return &n
+	case *InfixExpression:
+		n := *node
+		n.Left = m.expression(node.Left)
+		n.Right = m.expression(node.Right)
+		return &n
+	case *IfExpression:
+		n := *node
+		n.Condition = m.expression(node.Condition)
+		n.Consequence = m.block(node.Consequence)
+		n.Alternative = m.block(node.Alternative)
+		return &n
+	case *FunctionLiteral:
+		n := *node
+		n.Params = make([]*Param, len(node.Params))
+		for i, p := range node.Params {
+			n.Params[i] = &Param{Pattern: m.pattern(p.Pattern), Default: m.expression(p.Default), Variadic: p.Variadic}
+		}
+		n.Block = m.block(node.Block)
+		return &n
+	case *MacroLiteral:
+		n := *node
+		n.Params = make([]*Identifier, len(node.Params))
+		for i, p := range node.Params {
+			n.Params[i] = m.identifier(p)
+		}
+		n.Body = m.block(node.Body)
+		return &n
+	case *CallExpression:
+		n := *node
+		n.Function = m.expression(node.Function)
+		n.Args = m.expressions(node.Args)
+		return &n
+	case *SpreadExpression:
+		n := *node
+		n.Value = m.expression(node.Value)
+		return &n
+	case *NamedArgument:
+		n := *node
+		n.Value = m.expression(node.Value)
+		return &n
+	case *ArrayLiteral:
+		n := *node
+		n.Elements = m.expressions(node.Elements)
+		return &n
+	case *HashLiteral:
+		n := *node
+		n.Pairs = make([]HashPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			n.Pairs[i] = HashPair{Key: m.expression(pair.Key), Value: m.expression(pair.Value)}
+		}
+		return &n
+	case *IndexExpression:
+		n := *node
+		n.Left = m.expression(node.Left)
+		n.Index = m.expression(node.Index)
+		return &n
+	case *MemberExpression:
+		n := *node
+		n.Object = m.expression(node.Object)
+		return &n
+	case *TryExpression:
+		n := *node
+		n.Block = m.block(node.Block)
+		n.Param = m.identifier(node.Param)
+		n.Catch = m.block(node.Catch)
+		n.Finally = m.block(node.Finally)
+		return &n
+	case *MatchExpression:
+		n := *node
+		n.Subject = m.expression(node.Subject)
+		n.Arms = make([]*MatchArm, len(node.Arms))
+		for i, arm := range node.Arms {
+			n.Arms[i] = &MatchArm{Pattern: m.pattern(arm.Pattern), Guard: m.expression(arm.Guard), Body: m.expression(arm.Body)}
+		}
+		return &n
+	case *SpawnExpression:
+		n := *node
+		n.Call = m.call(node.Call)
+		return &n
+	case *SelectExpression:
+		n := *node
+		n.Cases = make([]*SelectCase, len(node.Cases))
+		for i, c := range node.Cases {
+			n.Cases[i] = &SelectCase{Token: c.Token, Channel: m.expression(c.Channel), Value: m.expression(c.Value),
+				Var: m.identifier(c.Var), Body: m.expression(c.Body)}
+		}
+		return &n
+	case *LiteralPattern:
+		n := *node
+		return &n
+	case *ArrayPattern:
+		n := *node
+		n.Elements = make([]Pattern, len(node.Elements))
+		for i, el := range node.Elements {
+			n.Elements[i] = m.pattern(el)
+		}
+		n.Rest = m.identifier(node.Rest)
+		return &n
+	case *HashPattern:
+		n := *node
+		n.Pairs = make([]HashPatternPair, len(node.Pairs))
+		for i, pair := range node.Pairs {
+			n.Pairs[i] = HashPatternPair{Key: pair.Key, Value: m.pattern(pair.Value)}
+		}
+		return &n
+	}
+	return node
+}
+
+func (m *modifying) statements(stmts []Statement) []Statement {
+	out := make([]Statement, 0, len(stmts))
+	for _, s := range stmts {
+		c := m.copy(s)
+		switch n := m.modifier(c).(type) {
+		case nil:
+		case Statement:
+			out = append(out, n)
+		default:
+			out = append(out, c.(Statement))
+		}
+	}
+	return out
+}
+
+func (m *modifying) expressions(exps []Expression) []Expression {
+	if exps == nil {
+		return nil
+	}
+	out := make([]Expression, len(exps))
+	for i, e := range exps {
+		out[i] = m.expression(e)
+	}
+	return out
+}
+
+func (m *modifying) expression(e Expression) Expression {
+	if e == nil {
+		return nil
+	}
+	c := m.copy(e)
+	if out, ok := m.modifier(c).(Expression); ok {
+		return out
+	}
+	return c.(Expression)
+}
+
+func (m *modifying) pattern(p Pattern) Pattern {
+	if p == nil {
+		return nil
+	}
+	c := m.copy(p)
+	if out, ok := m.modifier(c).(Pattern); ok {
+		return out
+	}
+	return c.(Pattern)
+}
+
+func (m *modifying) identifier(i *Identifier) *Identifier {
+	if i == nil {
+		return nil
+	}
+	c := m.copy(i)
+	if out, ok := m.modifier(c).(*Identifier); ok && out != nil {
+		return out
+	}
+	return c.(*Identifier)
+}
+
+func (m *modifying) block(b *BlockStatement) *BlockStatement {
+	if b == nil {
+		return nil
+	}
+	c := m.copy(b)
+	if out, ok := m.modifier(c).(*BlockStatement); ok && out != nil {
+		return out
+	}
+	return c.(*BlockStatement)
+}
+
+func (m *modifying) call(call *CallExpression) *CallExpression {
+	if call == nil {
+		return nil
+	}
+	c := m.copy(call)
+	if out, ok := m.modifier(c).(*CallExpression); ok && out != nil {
+		return out
+	}
+	return c.(*CallExpression)
+}
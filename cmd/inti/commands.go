@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/format"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+	"github.com/jarviliam/inti/token"
+	"github.com/jarviliam/inti/types"
+)
+
+// readSource reads the named file, or stdin for "-".
+func readSource(name string) (string, error) {
+	if name == "-" {
+		src, err := ioutil.ReadAll(os.Stdin)
+		return string(src), err
+	}
+	src, err := ioutil.ReadFile(name)
+	return string(src), err
+}
+
+// parseSource parses src, reporting errors against name.
+func parseSource(name, src string, opts ...parser.Option) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src), opts...)
+	program := p.ParseProgram()
+	for _, e := range p.ErrorList() {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+	}
+	return program, len(p.ErrorList()) == 0
+}
+
+// execute type checks program if asked to and evaluates it with args.
+// Imports resolve relative to file, or the working directory if it is "",
+// and parse the operators in ops, which program was parsed with.
+func execute(name, file string, program *ast.Program, ops *parser.Operators, args []string) (object.Object, bool) {
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	opts, done, err := runOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil, false
+	}
+	defer done()
+	opts = append(opts, evaluator.WithArgs(args), evaluator.WithFile(file), evaluator.WithOperatorTable(ops))
+	ev := evaluator.New(opts...)
+	env := object.NewEnvironment()
+	if *typeCheck {
+		// the code checked is the code run, with its macros expanded
+		expanded, errObj := ev.ExpandMacros(program, env)
+		if errObj != nil {
+			reportError(name, errObj.Message)
+			return nil, false
+		}
+		if errs := types.Check(expanded); len(errs) != 0 {
+			for _, e := range errs {
+				fmt.Fprintf(os.Stderr, "%s:%s\n", name, e)
+			}
+			return nil, false
+		}
+		program = expanded
+	}
+	result := ev.EvalContext(ctx, program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		reportError(name, errObj.Message)
+		for _, frame := range errObj.Trace {
+			fmt.Fprintf(os.Stderr, "\tin %s\n", frame)
+		}
+		return nil, false
+	}
+	return result, true
+}
+
+// reportError prints a runtime error against name. Messages that start with
+// a position are printed in the name:line:col: form parse errors use.
+func reportError(name, msg string) {
+	sep := ": "
+	if hasPosition(msg) {
+		sep = ":"
+	}
+	fmt.Fprintf(os.Stderr, "%s%s%s\n", name, sep, msg)
+}
+
+// hasPosition reports whether msg starts with line:col:.
+func hasPosition(msg string) bool {
+	for i := 0; i < 2; i++ {
+		n := strings.IndexFunc(msg, func(r rune) bool { return r < '0' || r > '9' })
+		if n <= 0 || msg[n] != ':' {
+			return false
+		}
+		msg = msg[n+1:]
+	}
+	return true
+}
+
+// runOptions returns the evaluator options set by flags. done closes the
+// files they opened.
+func runOptions() (opts []evaluator.Option, done func(), err error) {
+	opts = []evaluator.Option{evaluator.WithLimits(limits), evaluator.WithCapabilities(caps)}
+	if *deterministic {
+		opts = append(opts, evaluator.WithDeterministic(*seed))
+	} else if isFlagSet("seed") {
+		opts = append(opts, evaluator.WithSeed(*seed))
+	}
+	var files []*os.File
+	done = func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	if *record != "" {
+		f, err := os.Create(*record)
+		if err != nil {
+			return nil, nil, err
+		}
+		files = append(files, f)
+		opts = append(opts, evaluator.WithRecord(f))
+	}
+	if *replay != "" {
+		f, err := os.Open(*replay)
+		if err != nil {
+			done()
+			return nil, nil, err
+		}
+		files = append(files, f)
+		opts = append(opts, evaluator.WithReplay(f))
+	}
+	return opts, done, nil
+}
+
+// run runs the script named by args[0], passing it the rest, and returns
+// the exit code.
+func run(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: inti run file [args]")
+		return 2
+	}
+	name := args[0]
+	src, err := readSource(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	file := name
+	if name == "-" {
+		name, file = "<stdin>", ""
+	}
+	ops := parser.NewOperators()
+	program, ok := parseSource(name, src, parser.WithOperators(ops))
+	if !ok {
+		return 1
+	}
+	if _, ok := execute(name, file, program, ops, args[1:]); !ok {
+		return 1
+	}
+	return 0
+}
+
+// evalExpr evaluates expr and prints its value unless it is null.
+func evalExpr(expr string, args []string) int {
+	ops := parser.NewOperators()
+	program, ok := parseSource("-e", expr, parser.WithOperators(ops))
+	if !ok {
+		return 1
+	}
+	result, ok := execute("-e", "", program, ops, args)
+	if !ok {
+		return 1
+	}
+	if result != nil && result != evaluator.NULL {
+		fmt.Println(result.Inspect())
+	}
+	return 0
+}
+
+// sourceArg returns the single optional file argument of a subcommand.
+func sourceArg(fs *flag.FlagSet, args []string) (string, bool) {
+	fs.Parse(args)
+	switch fs.NArg() {
+	case 0:
+		return "-", true
+	case 1:
+		return fs.Arg(0), true
+	}
+	fs.Usage()
+	return "", false
+}
+
+func lex(args []string) int {
+	fs := flag.NewFlagSet("lex", flag.ExitOnError)
+	name, ok := sourceArg(fs, args)
+	if !ok {
+		return 2
+	}
+	src, err := readSource(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	l := lexer.New(src)
+	status := 0
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			return status
+		}
+		if tok.Type == token.ILLEGAL {
+			status = 1
+		}
+		fmt.Printf("%-8s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func parse(args []string) int {
+	fs := flag.NewFlagSet("parse", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the tree as JSON")
+	trace := fs.Bool("trace", false, "print the parse functions entered and exited to stderr")
+	name, ok := sourceArg(fs, args)
+	if !ok {
+		return 2
+	}
+	src, err := readSource(name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var opts []parser.Option
+	if *trace {
+		opts = append(opts, parser.WithTrace(os.Stderr))
+	}
+	program, ok := parseSource(name, src, opts...)
+	if !ok {
+		return 1
+	}
+	if *asJSON {
+		out, err := ast.JSON(program)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%s\n", out)
+		return 0
+	}
+	for _, stmt := range program.Statements {
+		fmt.Println(stmt.String())
+	}
+	return 0
+}
+
+// formatFiles prints each file formatted, or rewrites it with -w.
+func formatFiles(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write the result to the file instead of printing it")
+	fs.Parse(args)
+	files := fs.Args()
+	if len(files) == 0 {
+		if *write {
+			fmt.Fprintln(os.Stderr, "inti fmt: -w needs files")
+			return 2
+		}
+		files = []string{"-"}
+	}
+
+	status := 0
+	for _, name := range files {
+		src, err := readSource(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		program, ok := parseSource(name, src)
+		if !ok {
+			status = 1
+			continue
+		}
+		out := format.Shebang(src) + format.Program(program)
+		if !*write {
+			fmt.Print(out)
+			continue
+		}
+		if out == src {
+			continue
+		}
+		if err := ioutil.WriteFile(name, []byte(out), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+		}
+	}
+	return status
+}
+
+// check type checks each file without running it and returns the exit code.
+func check(files []string) int {
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: inti check file...")
+		return 2
+	}
+	status := 0
+	for _, file := range files {
+		src, err := readSource(file)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		program, ok := parseSource(file, src)
+		if !ok {
+			status = 1
+			continue
+		}
+		for _, e := range types.Check(program) {
+			fmt.Fprintf(os.Stderr, "%s:%s\n", file, e)
+			status = 1
+		}
+	}
+	return status
+}
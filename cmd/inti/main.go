@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+
+	"github.com/jarviliam/inti/dap"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/lineedit"
+	"github.com/jarviliam/inti/lsp"
+	"github.com/jarviliam/inti/repl"
+)
+
+const usage = `usage:
+	inti [flags]                        start the REPL, or run a script piped to stdin
+	inti [flags] file [args]            run a script
+	inti [flags] run file [args]        run a script; - reads it from stdin
+	inti [flags] -e expr [args]         evaluate expr and print its value
+	inti repl                           start the REPL
+	inti lex [file]                     print the tokens of a file
+	inti parse [-json] [-trace] [file]  print the syntax tree of a file
+	inti fmt [-w] [file...]             format files
+	inti check file...                  type check files without running them
+	inti lsp                            serve the Language Server Protocol on stdio
+	inti dap                            serve the Debug Adapter Protocol on stdio
+
+Files default to stdin where optional. Scripts read their arguments with
+args(). Imports are looked up next to the importing file, then in the
+directories listed in INTI_PATH. Exit status is 1 when a script fails and
+2 on bad usage.
+
+flags:
+`
+
+var (
+	typeCheck = flag.Bool("typecheck", false, "type check input before evaluating it")
+	timeout   = flag.Duration("timeout", 0, "stop scripts running longer than `duration`")
+	limits    evaluator.Limits
+	caps      = evaluator.CapAll
+
+	deterministic = flag.Bool("deterministic", false, "run scripts repeatably: seeded random, a virtual clock and no fs, env, net, spawn or read_line unless -replay")
+	seed          = flag.Int64("seed", 0, "seed random with `n`; it is seeded from the time unless set or -deterministic")
+	record        = flag.String("record", "", "record the inputs a script reads from outside to `file`")
+	replay        = flag.String("replay", "", "replay the inputs recorded in `file` instead of reading them")
+)
+
+func init() {
+	flag.Func("allow", "grant scripts only the comma separated `capabilities`: pure, io, fs, env, time, net or all", func(s string) error {
+		c, err := evaluator.ParseCapabilities(s)
+		caps = c
+		return err
+	})
+	flag.IntVar(&limits.Steps, "max-steps", 0, "stop scripts after `n` evaluation steps")
+	flag.IntVar(&limits.CallDepth, "max-depth", evaluator.DefaultCallDepth, "stop scripts nesting more than `n` calls; -1 for no limit")
+	flag.IntVar(&limits.Allocations, "max-allocs", 0, "stop scripts allocating more than `n` objects")
+}
+
+func main() {
+	expr := flag.String("e", "", "evaluate `expr` and print its value")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+
+	if isFlagSet("e") {
+		os.Exit(evalExpr(*expr, args))
+	}
+	if len(args) == 0 {
+		if !lineedit.IsTerminal(os.Stdin) {
+			os.Exit(run([]string{"-"}))
+		}
+		startREPL()
+		return
+	}
+
+	switch args[0] {
+	case "run":
+		os.Exit(run(args[1:]))
+	case "repl":
+		startREPL()
+	case "lex":
+		os.Exit(lex(args[1:]))
+	case "parse":
+		os.Exit(parse(args[1:]))
+	case "fmt":
+		os.Exit(formatFiles(args[1:]))
+	case "check":
+		os.Exit(check(args[1:]))
+	case "lsp":
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	case "dap":
+		if err := dap.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	default:
+		// a script run through its shebang line arrives as the first argument
+		if _, err := os.Stat(args[0]); err != nil {
+			fmt.Fprintf(os.Stderr, "inti: unknown command or file %q\n", args[0])
+			flag.Usage()
+			os.Exit(2)
+		}
+		os.Exit(run(args))
+	}
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func startREPL() {
+	user, err := user.Current()
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Hello %s! This is inti \n", user.Username)
+	fmt.Printf("Type in commands\n")
+
+	evalOpts, done, err := runOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer done()
+	opts := []repl.Option{repl.WithEvaluatorOptions(evalOpts...), repl.WithTimeout(*timeout)}
+	if *typeCheck {
+		opts = append(opts, repl.WithTypeCheck())
+	}
+	repl.Start(os.Stdin, os.Stdout, opts...)
+}
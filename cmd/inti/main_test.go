@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// binary is the inti command built for the tests to run.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "inti")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	binary = filepath.Join(dir, "inti")
+	build := exec.Command("go", "build", "-o", binary, ".")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		os.RemoveAll(dir)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+type result struct {
+	stdout, stderr string
+	code           int
+}
+
+// inti runs the built command with args, feeding it stdin.
+func inti(t *testing.T, stdin string, args ...string) result {
+	t.Helper()
+	return runCommand(t, exec.Command(binary, args...), stdin)
+}
+
+func runCommand(t *testing.T, cmd *exec.Cmd, stdin string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	code := 0
+	if exit, ok := err.(*exec.ExitError); ok {
+		code = exit.ExitCode()
+	} else if err != nil {
+		t.Fatalf("running %v: %v", cmd.Args, err)
+	}
+	return result{stdout.String(), stderr.String(), code}
+}
+
+// script writes src to a file in a temporary directory and returns its path.
+func script(t *testing.T, src string) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "script")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "script.inti")
+	if err := ioutil.WriteFile(path, []byte(src), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExitCodes(t *testing.T) {
+	ok := script(t, "puts(1 + 2);\n")
+	runtimeError := script(t, "let a = 1;\na + true;\n")
+	parseError := script(t, "let = 1;\n")
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{[]string{ok}, 0},
+		{[]string{"run", ok}, 0},
+		{[]string{"-e", "1"}, 0},
+		{[]string{runtimeError}, 1},
+		{[]string{parseError}, 1},
+		{[]string{"run", "/does/not/exist.inti"}, 1},
+		{[]string{"-e", "1 +"}, 1},
+		{[]string{"-typecheck", "-e", "1 + true"}, 1},
+		{[]string{"-max-steps", "10", "-e", "let f = fn(n) { f(n + 1) }; f(0)"}, 1},
+		{[]string{"-e", "let f = fn(n) { 1 + f(n + 1) }; f(0)"}, 1},
+		{[]string{"check", ok}, 0},
+		{[]string{"run"}, 2},
+		{[]string{"check"}, 2},
+		{[]string{"nope"}, 2},
+		{[]string{"-allow", "bogus", "-e", "1"}, 2},
+	}
+
+	for _, tt := range tests {
+		res := inti(t, "", tt.args...)
+		if res.code != tt.code {
+			t.Errorf("%v: wrong exit code. want=%d, got=%d\nstderr=%q", tt.args, tt.code, res.code, res.stderr)
+		}
+	}
+}
+
+func TestEvalPrintsValue(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"1 + 2", "3\n"},
+		{`"a" + "b"`, "ab\n"},
+		{"let a = 1;", ""},
+		{"puts(1)", "1\n"},
+	}
+
+	for _, tt := range tests {
+		res := inti(t, "", "-e", tt.expr)
+		if res.stdout != tt.expected {
+			t.Errorf("%s: wrong output. want=%q, got=%q", tt.expr, tt.expected, res.stdout)
+		}
+	}
+}
+
+func TestStdin(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"run", "-", "a", "b"}, "[a, b]\ndone\n"},
+		// with no arguments and piped input, inti runs it rather than
+		// starting the REPL
+		{nil, "[]\ndone\n"},
+	}
+
+	for _, tt := range tests {
+		res := inti(t, "puts(args());\nputs(\"done\");\n", tt.args...)
+		if res.code != 0 || res.stdout != tt.expected {
+			t.Errorf("%v: want=%q, got=%q (exit %d)\nstderr=%q", tt.args, tt.expected, res.stdout, res.code, res.stderr)
+		}
+	}
+}
+
+func TestStdinErrorName(t *testing.T) {
+	res := inti(t, "let = 1;\n", "run", "-")
+	if !strings.HasPrefix(res.stderr, "<stdin>:1:5: ") {
+		t.Errorf("wrong error. got=%q", res.stderr)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	path := script(t, "puts(args());\n")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{path}, "[]\n"},
+		{[]string{path, "a", "b c"}, "[a, b c]\n"},
+		{[]string{"run", path, "-x", "run"}, "[-x, run]\n"},
+		{[]string{"-e", "args()", "a"}, "[a]\n"},
+	}
+
+	for _, tt := range tests {
+		res := inti(t, "", tt.args...)
+		if res.stdout != tt.expected {
+			t.Errorf("%v: wrong output. want=%q, got=%q\nstderr=%q", tt.args, tt.expected, res.stdout, res.stderr)
+		}
+	}
+}
+
+func TestShebang(t *testing.T) {
+	path := script(t, "#!"+binary+"\nputs(args());\n")
+	res := runCommand(t, exec.Command(path, "a", "b"), "")
+	if res.code != 0 || res.stdout != "[a, b]\n" {
+		t.Errorf("want=%q, got=%q (exit %d)\nstderr=%q", "[a, b]\n", res.stdout, res.code, res.stderr)
+	}
+
+	// the shebang line doesn't shift the positions of errors
+	path = script(t, "#!"+binary+"\nlet = 1;\n")
+	res = inti(t, "", path)
+	if want := path + ":2:5: "; !strings.HasPrefix(res.stderr, want) {
+		t.Errorf("wrong error. want prefix %q, got=%q", want, res.stderr)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	path := script(t, "let a = [1];\n\n\nlet [b, c] = a;\n")
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{path}, path + ":4:5: expected 2 elements, got 1\n"},
+		{[]string{"-e", "let [b, c] = [1];"}, "-e:1:5: expected 2 elements, got 1\n"},
+		{[]string{"-e", "let = 1"}, "-e:1:5: "},
+		{[]string{"-typecheck", "-e", "1 + true"}, "-e:1:3: "},
+		{[]string{"-e", "1 + true"}, "-e: type mismatch: INTEGER + BOOLEAN\n"},
+	}
+
+	for _, tt := range tests {
+		res := inti(t, "", tt.args...)
+		if !strings.HasPrefix(res.stderr, tt.expected) {
+			t.Errorf("%v: wrong error. want prefix %q, got=%q", tt.args, tt.expected, res.stderr)
+		}
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	res := inti(t, "", "-e", "let f = fn() { 1 + true }; f()")
+	if !strings.Contains(res.stderr, "\tin f at 1:28\n") {
+		t.Errorf("missing traceback. got=%q", res.stderr)
+	}
+}
+
+func TestREPLFlags(t *testing.T) {
+	res := inti(t, "let f = fn(n) { f(n + 1) }; f(0)\nread_line()\n", "-max-steps", "100", "-deterministic", "repl")
+	for _, want := range []string{"step limit exceeded", "read_line is not available in deterministic mode"} {
+		if !strings.Contains(res.stdout, want) {
+			t.Errorf("output does not contain %q. got=%q", want, res.stdout)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package inti
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts a Go value to an inti object:
+//
+//   - nil and nil pointers become null
+//   - bools, strings and integers of any size become booleans, strings and
+//     integers
+//   - slices and arrays become arrays, and maps become hashes
+//   - structs become hashes keyed by field name, or by the name in an
+//     `inti:"name"` tag; fields tagged `inti:"-"` and unexported fields are
+//     left out
+//   - functions become builtins. They may return nothing, a value, an
+//     error, or a value and an error; a non-nil error fails the call.
+//
+// object.Object values are returned unchanged.
+func ToObject(v interface{}) (object.Object, error) {
+	if v == nil {
+		return evaluator.NULL, nil
+	}
+	return toObject(reflect.ValueOf(v))
+}
+
+func toObject(v reflect.Value) (object.Object, error) {
+	if v.Type().Implements(objectType) {
+		if v.Kind() == reflect.Interface && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return v.Interface().(object.Object), nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return nativeBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &object.Integer{Value: v.Int()}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if v.Uint() > 1<<63-1 {
+			return nil, fmt.Errorf("%d overflows an integer", v.Uint())
+		}
+		return &object.Integer{Value: int64(v.Uint())}, nil
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		return toObject(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := toObject(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return evaluator.NULL, nil
+		}
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair, v.Len())}
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := setPair(hash, iter.Key(), iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Struct:
+		hash := &object.Hash{Pairs: make(map[object.HashKey]object.HashPair)}
+		for i := 0; i < v.NumField(); i++ {
+			name, ok := fieldName(v.Type().Field(i))
+			if !ok {
+				continue
+			}
+			if err := setPair(hash, reflect.ValueOf(name), v.Field(i)); err != nil {
+				return nil, err
+			}
+		}
+		return hash, nil
+	case reflect.Func:
+		return wrapFunc(v)
+	}
+	return nil, fmt.Errorf("cannot convert %s", v.Type())
+}
+
+func setPair(hash *object.Hash, k, v reflect.Value) error {
+	key, err := toObject(k)
+	if err != nil {
+		return fmt.Errorf("key %v: %w", k, err)
+	}
+	hashable, ok := key.(object.Hashable)
+	if !ok {
+		return fmt.Errorf("unusable as hash key: %s", key.Type())
+	}
+	value, err := toObject(v)
+	if err != nil {
+		return fmt.Errorf("value for key %v: %w", k, err)
+	}
+	hash.Pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+	return nil
+}
+
+// fieldName returns the hash key a struct field is stored under, if any.
+func fieldName(f reflect.StructField) (string, bool) {
+	if f.PkgPath != "" {
+		return "", false
+	}
+	switch tag := f.Tag.Get("inti"); tag {
+	case "-":
+		return "", false
+	case "":
+		return f.Name, true
+	default:
+		return tag, true
+	}
+}
+
+// wrapFunc turns a Go function into a builtin converting its arguments and
+// results.
+func wrapFunc(fn reflect.Value) (object.Object, error) {
+	t := fn.Type()
+	returnsErr := t.NumOut() > 0 && t.Out(t.NumOut()-1) == errorType
+	values := t.NumOut()
+	if returnsErr {
+		values--
+	}
+	if values > 1 {
+		return nil, fmt.Errorf("%s returns more than one value", t)
+	}
+
+	return &object.Builtin{Fn: func(args ...object.Object) object.Object {
+		min := t.NumIn()
+		if t.IsVariadic() {
+			min--
+		}
+		if len(args) < min || !t.IsVariadic() && len(args) != min {
+			return &object.Error{Message: fmt.Sprintf("wrong number of arguments. got=%d, want=%d", len(args), min)}
+		}
+		in := make([]reflect.Value, len(args))
+		for i, arg := range args {
+			var pt reflect.Type
+			if i < min {
+				pt = t.In(i)
+			} else {
+				pt = t.In(min).Elem()
+			}
+			v, err := toValue(arg, pt)
+			if err != nil {
+				return &object.Error{Message: fmt.Sprintf("argument %d: %s", i+1, err)}
+			}
+			in[i] = v
+		}
+
+		out := fn.Call(in)
+		if returnsErr {
+			if err := out[len(out)-1]; !err.IsNil() {
+				return &object.Error{Message: err.Interface().(error).Error()}
+			}
+		}
+		if values == 0 {
+			return evaluator.NULL
+		}
+		result, err := toObject(out[0])
+		if err != nil {
+			return &object.Error{Message: fmt.Sprintf("result: %s", err)}
+		}
+		return result
+	}}, nil
+}
+
+// FromObject converts an inti object to a Go value: integers become int64,
+// booleans bool, strings string, null nil, arrays []interface{}, and hashes
+// map[string]interface{} when all their keys are strings or
+// map[interface{}]interface{} otherwise. Functions and other objects are
+// returned unchanged.
+func FromObject(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.Null:
+		return nil
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = FromObject(el)
+		}
+		return elements
+	case *object.Hash:
+		strKeys := make(map[string]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				anyKeys := make(map[interface{}]interface{}, len(obj.Pairs))
+				for _, pair := range obj.Pairs {
+					anyKeys[FromObject(pair.Key)] = FromObject(pair.Value)
+				}
+				return anyKeys
+			}
+			strKeys[key.Value] = FromObject(pair.Value)
+		}
+		return strKeys
+	}
+	return obj
+}
+
+// toValue converts obj to a Go value of type t.
+func toValue(obj object.Object, t reflect.Type) (reflect.Value, error) {
+	// objects pass through to parameters of their own or an interface type,
+	// except interface{}, which gets a native value
+	if ot := reflect.TypeOf(obj); ot.AssignableTo(t) && (t.Kind() != reflect.Interface || t.NumMethod() > 0) {
+		return reflect.ValueOf(obj).Convert(t), nil
+	}
+	v := reflect.New(t).Elem()
+	mismatch := fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		native := FromObject(obj)
+		if native == nil {
+			return v, nil
+		}
+		if !reflect.TypeOf(native).AssignableTo(t) {
+			return v, mismatch
+		}
+		v.Set(reflect.ValueOf(native))
+	case reflect.Bool:
+		b, ok := obj.(*object.Boolean)
+		if !ok {
+			return v, mismatch
+		}
+		v.SetBool(b.Value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return v, mismatch
+		}
+		if v.OverflowInt(i.Value) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetInt(i.Value)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, ok := obj.(*object.Integer)
+		if !ok {
+			return v, mismatch
+		}
+		if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+			return v, fmt.Errorf("%d overflows %s", i.Value, t)
+		}
+		v.SetUint(uint64(i.Value))
+	case reflect.String:
+		s, ok := obj.(*object.String)
+		if !ok {
+			return v, mismatch
+		}
+		v.SetString(s.Value)
+	case reflect.Ptr:
+		if obj == evaluator.NULL {
+			return v, nil
+		}
+		elem, err := toValue(obj, t.Elem())
+		if err != nil {
+			return v, err
+		}
+		v.Set(reflect.New(t.Elem()))
+		v.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if obj == evaluator.NULL && t.Kind() == reflect.Slice {
+			return v, nil
+		}
+		arr, ok := obj.(*object.Array)
+		if !ok {
+			return v, mismatch
+		}
+		if t.Kind() == reflect.Slice {
+			v.Set(reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements)))
+		} else if len(arr.Elements) != t.Len() {
+			return v, fmt.Errorf("cannot use array of length %d as %s", len(arr.Elements), t)
+		}
+		for i, el := range arr.Elements {
+			ev, err := toValue(el, t.Elem())
+			if err != nil {
+				return v, fmt.Errorf("element %d: %w", i, err)
+			}
+			v.Index(i).Set(ev)
+		}
+	case reflect.Map:
+		if obj == evaluator.NULL {
+			return v, nil
+		}
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return v, mismatch
+		}
+		v.Set(reflect.MakeMapWithSize(t, len(hash.Pairs)))
+		for _, pair := range hash.Pairs {
+			key, err := toValue(pair.Key, t.Key())
+			if err != nil {
+				return v, fmt.Errorf("key %s: %w", pair.Key.Inspect(), err)
+			}
+			val, err := toValue(pair.Value, t.Elem())
+			if err != nil {
+				return v, fmt.Errorf("value for key %s: %w", pair.Key.Inspect(), err)
+			}
+			v.SetMapIndex(key, val)
+		}
+	case reflect.Struct:
+		hash, ok := obj.(*object.Hash)
+		if !ok {
+			return v, mismatch
+		}
+		for i := 0; i < t.NumField(); i++ {
+			name, ok := fieldName(t.Field(i))
+			if !ok {
+				continue
+			}
+			key := (&object.String{Value: name}).HashKey()
+			pair, ok := hash.Pairs[key]
+			if !ok {
+				continue
+			}
+			fv, err := toValue(pair.Value, t.Field(i).Type)
+			if err != nil {
+				return v, fmt.Errorf("field %s: %w", name, err)
+			}
+			v.Field(i).Set(fv)
+		}
+	default:
+		return v, mismatch
+	}
+	return v, nil
+}
+
+func nativeBool(b bool) *object.Boolean {
+	if b {
+		return evaluator.TRUE
+	}
+	return evaluator.FALSE
+}
@@ -0,0 +1,281 @@
+package dap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+)
+
+var errTerminated = errors.New("debugging session terminated")
+
+type stepMode int
+
+const (
+	run stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+	pause
+)
+
+// frame is a call in progress. The first frame is the program itself.
+type frame struct {
+	name string
+	env  *object.Environment
+	node ast.Node // statement being run
+}
+
+// debugger is the evaluator hook that stops on breakpoints and steps.
+type debugger struct {
+	mu          sync.Mutex
+	breakpoints map[int]string // line to condition
+	frames      []*frame
+	mode        stepMode
+	stepDepth   int
+	entry       bool
+	terminated  bool
+
+	resume chan stepMode
+	// stopped is called, without the lock held, when the program stops.
+	stopped func(reason, text string)
+	// eval runs conditions and watch expressions; it has no hook.
+	eval *evaluator.Evaluator
+
+	refs    map[int]interface{} // variables references, valid while stopped
+	nextRef int
+}
+
+func newDebugger(eval *evaluator.Evaluator, stopped func(reason, text string)) *debugger {
+	return &debugger{
+		breakpoints: make(map[int]string),
+		frames:      []*frame{{name: "main"}},
+		resume:      make(chan stepMode),
+		stopped:     stopped,
+		eval:        eval,
+		refs:        make(map[int]interface{}),
+	}
+}
+
+func (d *debugger) Before(node ast.Node, env *object.Environment) error {
+	if _, ok := node.(ast.Statement); !ok {
+		return nil
+	}
+
+	d.mu.Lock()
+	if d.terminated {
+		d.mu.Unlock()
+		return errTerminated
+	}
+	top := d.frames[len(d.frames)-1]
+	top.node = node
+	if top.env == nil {
+		top.env = env
+	}
+	reason, text := d.shouldStop(node, env)
+	if reason == "" {
+		d.mu.Unlock()
+		return nil
+	}
+	d.refs = make(map[int]interface{})
+	d.nextRef = 0
+	d.mu.Unlock()
+
+	d.stopped(reason, text)
+	mode, ok := <-d.resume
+	if !ok {
+		return errTerminated
+	}
+
+	d.mu.Lock()
+	d.mode = mode
+	d.stepDepth = len(d.frames)
+	d.mu.Unlock()
+	return nil
+}
+
+// shouldStop returns why the program stops before node, if it does.
+func (d *debugger) shouldStop(node ast.Node, env *object.Environment) (string, string) {
+	depth := len(d.frames)
+	switch {
+	case d.entry:
+		d.entry = false
+		return "entry", ""
+	case d.mode == pause:
+		return "pause", ""
+	case d.mode == stepIn,
+		d.mode == stepOver && depth <= d.stepDepth,
+		d.mode == stepOut && depth < d.stepDepth:
+		return "step", ""
+	}
+
+	cond, ok := d.breakpoints[node.Pos().Line]
+	if !ok {
+		return "", ""
+	}
+	if cond == "" {
+		return "breakpoint", ""
+	}
+	val, err := d.evaluate(cond, env)
+	if err != nil {
+		return "breakpoint", "condition failed: " + err.Error()
+	}
+	if val == evaluator.FALSE || val == evaluator.NULL {
+		return "", ""
+	}
+	return "breakpoint", ""
+}
+
+func (d *debugger) EnterCall(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// builtins such as map call functions without a call expression
+	name := "<anonymous>"
+	if call != nil {
+		name = call.Function.String()
+	}
+	d.frames = append(d.frames, &frame{name: name, env: env})
+}
+
+func (d *debugger) ExitCall(call *ast.CallExpression) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// evaluate runs an expression in env without stopping in it.
+func (d *debugger) evaluate(src string, env *object.Environment) (object.Object, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.Join(p.Errors(), "; "))
+	}
+	if env == nil {
+		env = object.NewEnvironment()
+	}
+	val := d.eval.Eval(program, env)
+	if errObj, ok := val.(*object.Error); ok {
+		return nil, errors.New(errObj.Message)
+	}
+	if val == nil {
+		val = evaluator.NULL
+	}
+	return val, nil
+}
+
+func (d *debugger) setBreakpoints(bps map[int]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.breakpoints = bps
+}
+
+// cont resumes a stopped program.
+func (d *debugger) cont(mode stepMode) {
+	d.resume <- mode
+}
+
+// requestPause stops a running program at its next statement.
+func (d *debugger) requestPause() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.mode = pause
+}
+
+func (d *debugger) terminate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.terminated {
+		d.terminated = true
+		close(d.resume)
+	}
+}
+
+func (d *debugger) stackTrace(path string) []StackFrame {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	frames := []StackFrame{}
+	for i := len(d.frames) - 1; i >= 0; i-- {
+		f := d.frames[i]
+		sf := StackFrame{ID: i + 1, Name: f.name, Source: Source{Path: path}}
+		if f.node != nil {
+			sf.Line, sf.Column = f.node.Pos().Line, f.node.Pos().Column
+		}
+		frames = append(frames, sf)
+	}
+	return frames
+}
+
+func (d *debugger) frameEnv(id int) (*object.Environment, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id < 1 || id > len(d.frames) {
+		return nil, false
+	}
+	return d.frames[id-1].env, true
+}
+
+// scopes lists the environments visible from a frame, innermost first.
+func (d *debugger) scopes(id int) []Scope {
+	env, ok := d.frameEnv(id)
+	scopes := []Scope{}
+	if !ok || env == nil {
+		return scopes
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for e := env; e != nil; e = e.Outer() {
+		name := "Closure"
+		switch {
+		case e.Outer() == nil:
+			name = "Globals"
+		case e == env:
+			name = "Locals"
+		}
+		scopes = append(scopes, Scope{Name: name, VariablesReference: d.ref(e)})
+	}
+	return scopes
+}
+
+func (d *debugger) variables(ref int) []Variable {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	vars := []Variable{}
+	switch v := d.refs[ref].(type) {
+	case *object.Environment:
+		for _, name := range v.Names() {
+			val, _ := v.Get(name)
+			vars = append(vars, d.variable(name, val))
+		}
+	case *object.Array:
+		for i, el := range v.Elements {
+			vars = append(vars, d.variable(fmt.Sprintf("[%d]", i), el))
+		}
+	case *object.Hash:
+		for _, pair := range v.SortedPairs() {
+			vars = append(vars, d.variable(pair.Key.Inspect(), pair.Value))
+		}
+	}
+	return vars
+}
+
+func (d *debugger) variable(name string, val object.Object) Variable {
+	v := Variable{Name: name, Value: val.Inspect(), Type: string(val.Type())}
+	switch val.(type) {
+	case *object.Array, *object.Hash:
+		v.VariablesReference = d.ref(val)
+	}
+	return v
+}
+
+// ref hands out a variables reference. The lock must be held.
+func (d *debugger) ref(v interface{}) int {
+	d.nextRef++
+	d.refs[d.nextRef] = v
+	return d.nextRef
+}
@@ -0,0 +1,383 @@
+// Package dap implements a Debug Adapter Protocol server for inti programs
+// on top of the evaluator's hooks.
+package dap
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/jsonrpc"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+)
+
+type Server struct {
+	in  *jsonrpc.Reader
+	out *jsonrpc.Writer
+
+	mu  sync.Mutex
+	seq int
+
+	path        string
+	program     *ast.Program
+	dbg         *debugger
+	stopOnEntry bool
+	started     bool
+	// lines holds the lines statements start on, where breakpoints can stop.
+	lines map[int]bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{in: jsonrpc.NewReader(in), out: jsonrpc.NewWriter(out)}
+}
+
+// Run serves one debugging session until the client disconnects.
+func (s *Server) Run() error {
+	for {
+		body, err := s.in.Read()
+		if err == io.EOF {
+			s.terminate()
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return err
+		}
+		body2, err := s.handle(&req)
+		if err != nil {
+			s.respond(&req, false, err.Error(), nil)
+		} else {
+			s.respond(&req, true, "", body2)
+		}
+		switch req.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *Server) nextSeq() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	return s.seq
+}
+
+func (s *Server) respond(req *request, success bool, msg string, body interface{}) {
+	s.out.Write(response{
+		Seq:        s.nextSeq(),
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    success,
+		Command:    req.Command,
+		Message:    msg,
+		Body:       body,
+	})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.out.Write(event{Seq: s.nextSeq(), Type: "event", Event: name, Body: body})
+}
+
+func (s *Server) handle(req *request) (interface{}, error) {
+	switch req.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsConditionalBreakpoints:   true,
+			SupportsTerminateRequest:         true,
+		}, nil
+	case "launch":
+		var args LaunchArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := json.Unmarshal(req.Arguments, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args)
+	case "setExceptionBreakpoints":
+		return nil, nil
+	case "configurationDone":
+		return nil, s.start()
+	case "threads":
+		return map[string]interface{}{"threads": []Thread{{ID: mainThread, Name: "main"}}}, nil
+	case "stackTrace":
+		if err := s.needProgram(); err != nil {
+			return nil, err
+		}
+		frames := s.dbg.stackTrace(s.path)
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		var args struct {
+			FrameID int `json:"frameId"`
+		}
+		if err := s.arguments(req, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": s.dbg.scopes(args.FrameID)}, nil
+	case "variables":
+		var args struct {
+			VariablesReference int `json:"variablesReference"`
+		}
+		if err := s.arguments(req, &args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": s.dbg.variables(args.VariablesReference)}, nil
+	case "evaluate":
+		var args EvaluateArguments
+		if err := s.arguments(req, &args); err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		return map[string]interface{}{"allThreadsContinued": true}, s.resume(run)
+	case "next":
+		return nil, s.resume(stepOver)
+	case "stepIn":
+		return nil, s.resume(stepIn)
+	case "stepOut":
+		return nil, s.resume(stepOut)
+	case "pause":
+		if err := s.needProgram(); err != nil {
+			return nil, err
+		}
+		s.dbg.requestPause()
+		return nil, nil
+	case "disconnect", "terminate":
+		s.terminate()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unsupported request %q", req.Command)
+}
+
+func (s *Server) arguments(req *request, args interface{}) error {
+	if err := s.needProgram(); err != nil {
+		return err
+	}
+	return json.Unmarshal(req.Arguments, args)
+}
+
+func (s *Server) needProgram() error {
+	if s.dbg == nil {
+		return fmt.Errorf("no program launched")
+	}
+	return nil
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	src, err := ioutil.ReadFile(args.Program)
+	if err != nil {
+		return err
+	}
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return fmt.Errorf("%s:%s", args.Program, errs[0])
+	}
+
+	s.path, _ = filepath.Abs(args.Program)
+	s.program = program
+	s.stopOnEntry = args.StopOnEntry
+	s.lines = make(map[int]bool)
+	collectLines(program.Statements, s.lines)
+
+	out := &outputWriter{s: s}
+	s.dbg = newDebugger(evaluator.New(evaluator.WithOutput(out)), func(reason, text string) {
+		s.event("stopped", StoppedEventBody{Reason: reason, ThreadID: mainThread, AllThreadsStopped: true, Text: text})
+	})
+	return nil
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) (interface{}, error) {
+	if err := s.needProgram(); err != nil {
+		return nil, err
+	}
+	bps := make(map[int]string)
+	result := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		b := Breakpoint{Line: bp.Line, Verified: s.lines[bp.Line]}
+		if b.Verified {
+			bps[bp.Line] = bp.Condition
+		} else {
+			b.Message = "no statement on this line"
+		}
+		result = append(result, b)
+	}
+	s.dbg.setBreakpoints(bps)
+	return map[string]interface{}{"breakpoints": result}, nil
+}
+
+// start runs the program once configuration is done.
+func (s *Server) start() error {
+	if err := s.needProgram(); err != nil {
+		return err
+	}
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.dbg.entry = s.stopOnEntry
+
+	go func() {
+		ev := evaluator.New(
+			evaluator.WithHook(s.dbg),
+			evaluator.WithOutput(&outputWriter{s: s}),
+			evaluator.WithFile(s.path),
+		)
+		result := ev.Eval(s.program, object.NewEnvironment())
+		code := 0
+		if errObj, ok := result.(*object.Error); ok && errObj.Message != errTerminated.Error() {
+			s.event("output", OutputEventBody{Category: "stderr", Output: errObj.Inspect() + "\n"})
+			code = 1
+		}
+		s.event("exited", ExitedEventBody{ExitCode: code})
+		s.event("terminated", nil)
+	}()
+	return nil
+}
+
+func (s *Server) resume(mode stepMode) error {
+	if err := s.needProgram(); err != nil {
+		return err
+	}
+	go s.dbg.cont(mode)
+	return nil
+}
+
+func (s *Server) terminate() {
+	if s.dbg != nil {
+		s.dbg.terminate()
+	}
+}
+
+func (s *Server) evaluate(args EvaluateArguments) (interface{}, error) {
+	env, _ := s.dbg.frameEnv(args.FrameID)
+	val, err := s.dbg.evaluate(args.Expression, env)
+	if err != nil {
+		return nil, err
+	}
+	s.dbg.mu.Lock()
+	v := s.dbg.variable(args.Expression, val)
+	s.dbg.mu.Unlock()
+	return map[string]interface{}{"result": v.Value, "type": v.Type, "variablesReference": v.VariablesReference}, nil
+}
+
+// outputWriter forwards program output to the client as output events.
+type outputWriter struct {
+	s *Server
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", OutputEventBody{Category: "stdout", Output: string(p)})
+	return len(p), nil
+}
+
+// collectLines records the lines statements start on, including those
+// nested in blocks and function bodies.
+func collectLines(stmts []ast.Statement, lines map[int]bool) {
+	for _, stmt := range stmts {
+		lines[stmt.Pos().Line] = true
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			collectExpressionLines(stmt.Value, lines)
+		case *ast.ReturnStatement:
+			collectExpressionLines(stmt.ReturnValue, lines)
+		case *ast.ExpressionStatement:
+			collectExpressionLines(stmt.Expression, lines)
+		case *ast.ThrowStatement:
+			collectExpressionLines(stmt.Value, lines)
+		case *ast.YieldStatement:
+			collectExpressionLines(stmt.Value, lines)
+		case *ast.OperatorDeclaration:
+			collectExpressionLines(stmt.Value, lines)
+		case *ast.ForStatement:
+			collectExpressionLines(stmt.Iterable, lines)
+			collectLines(stmt.Body.Statements, lines)
+		}
+	}
+}
+
+func collectExpressionLines(e ast.Expression, lines map[int]bool) {
+	switch e := e.(type) {
+	case *ast.IfExpression:
+		collectLines(e.Consequence.Statements, lines)
+		if e.Alternative != nil {
+			collectLines(e.Alternative.Statements, lines)
+		}
+	case *ast.TryExpression:
+		collectLines(e.Block.Statements, lines)
+		if e.Catch != nil {
+			collectLines(e.Catch.Statements, lines)
+		}
+		if e.Finally != nil {
+			collectLines(e.Finally.Statements, lines)
+		}
+	case *ast.MatchExpression:
+		collectExpressionLines(e.Subject, lines)
+		for _, arm := range e.Arms {
+			if arm.Guard != nil {
+				collectExpressionLines(arm.Guard, lines)
+			}
+			collectExpressionLines(arm.Body, lines)
+		}
+	case *ast.SelectExpression:
+		for _, c := range e.Cases {
+			if !c.IsDefault() {
+				collectExpressionLines(c.Channel, lines)
+			}
+			if c.Value != nil {
+				collectExpressionLines(c.Value, lines)
+			}
+			collectExpressionLines(c.Body, lines)
+		}
+	case *ast.SpawnExpression:
+		collectExpressionLines(e.Call, lines)
+	case *ast.FunctionLiteral:
+		collectLines(e.Block.Statements, lines)
+	case *ast.MacroLiteral:
+		collectLines(e.Body.Statements, lines)
+	case *ast.CallExpression:
+		collectExpressionLines(e.Function, lines)
+		for _, a := range e.Args {
+			collectExpressionLines(a, lines)
+		}
+	case *ast.SpreadExpression:
+		collectExpressionLines(e.Value, lines)
+	case *ast.NamedArgument:
+		collectExpressionLines(e.Value, lines)
+	case *ast.InfixExpression:
+		collectExpressionLines(e.Left, lines)
+		collectExpressionLines(e.Right, lines)
+	case *ast.PrefixExpression:
+		collectExpressionLines(e.Right, lines)
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			collectExpressionLines(el, lines)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			collectExpressionLines(pair.Value, lines)
+		}
+	case *ast.IndexExpression:
+		collectExpressionLines(e.Left, lines)
+		collectExpressionLines(e.Index, lines)
+	case *ast.MemberExpression:
+		collectExpressionLines(e.Object, lines)
+	}
+}
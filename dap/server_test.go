@@ -0,0 +1,261 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jarviliam/inti/jsonrpc"
+)
+
+const program = `let add = fn(a, b) {
+	let sum = a + b;
+	sum
+};
+let x = add(1, 2);
+puts(x);
+`
+
+type message struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type client struct {
+	t      *testing.T
+	w      *jsonrpc.Writer
+	r      *jsonrpc.Reader
+	seq    int
+	events []message
+}
+
+func newClient(t *testing.T) *client {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	go func() {
+		NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	c := &client{t: t, w: jsonrpc.NewWriter(clientOut), r: jsonrpc.NewReader(clientIn)}
+	t.Cleanup(func() { clientOut.Close() })
+	return c
+}
+
+func (c *client) read() message {
+	body, err := c.r.Read()
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	return msg
+}
+
+func (c *client) call(command string, args interface{}, result interface{}) {
+	c.seq++
+	seq := c.seq
+	req := map[string]interface{}{"seq": seq, "type": "request", "command": command, "arguments": args}
+	if err := c.w.Write(req); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+		if msg.RequestSeq != seq {
+			c.t.Fatalf("response for %d while waiting for %d", msg.RequestSeq, seq)
+		}
+		if !msg.Success {
+			c.t.Fatalf("%s failed: %s", command, msg.Message)
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Body, result); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// wait returns the next event with the given name, skipping others.
+func (c *client) wait(name string) message {
+	for {
+		var msg message
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.read()
+		}
+		if msg.Type == "event" && msg.Event == name {
+			return msg
+		}
+		if msg.Type == "event" && msg.Event == "terminated" {
+			c.t.Fatalf("terminated while waiting for %s", name)
+		}
+	}
+}
+
+func (c *client) launch(breakpoints []SourceBreakpoint) {
+	c.launchSource(program, breakpoints)
+}
+
+func (c *client) launchSource(src string, breakpoints []SourceBreakpoint) {
+	path := filepath.Join(c.t.TempDir(), "test.inti")
+	if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+		c.t.Fatal(err)
+	}
+	c.call("initialize", map[string]string{"adapterID": "inti"}, nil)
+	c.wait("initialized")
+	c.call("launch", LaunchArguments{Program: path}, nil)
+
+	var bps struct{ Breakpoints []Breakpoint }
+	c.call("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: breakpoints}, &bps)
+	for i, bp := range bps.Breakpoints {
+		if !bp.Verified {
+			c.t.Fatalf("breakpoint %d on line %d not verified", i, bp.Line)
+		}
+	}
+	c.call("configurationDone", nil, nil)
+}
+
+func (c *client) stoppedAt() StackFrame {
+	var stopped StoppedEventBody
+	json.Unmarshal(c.wait("stopped").Body, &stopped)
+	var trace struct{ StackFrames []StackFrame }
+	c.call("stackTrace", map[string]int{"threadId": mainThread}, &trace)
+	return trace.StackFrames[0]
+}
+
+func TestBreakpointAndStepping(t *testing.T) {
+	c := newClient(t)
+	c.launch([]SourceBreakpoint{{Line: 2}})
+
+	var trace struct{ StackFrames []StackFrame }
+	c.wait("stopped")
+	c.call("stackTrace", map[string]int{"threadId": mainThread}, &trace)
+	if len(trace.StackFrames) != 2 {
+		t.Fatalf("wrong number of frames. got=%d", len(trace.StackFrames))
+	}
+	top := trace.StackFrames[0]
+	if top.Name != "add" || top.Line != 2 {
+		t.Fatalf("wrong top frame. got=%s:%d", top.Name, top.Line)
+	}
+
+	var scopes struct{ Scopes []Scope }
+	c.call("scopes", map[string]int{"frameId": top.ID}, &scopes)
+	if scopes.Scopes[0].Name != "Locals" {
+		t.Fatalf("wrong first scope. got=%q", scopes.Scopes[0].Name)
+	}
+	var vars struct{ Variables []Variable }
+	c.call("variables", map[string]int{"variablesReference": scopes.Scopes[0].VariablesReference}, &vars)
+	got := map[string]string{}
+	for _, v := range vars.Variables {
+		got[v.Name] = v.Value
+	}
+	if got["a"] != "1" || got["b"] != "2" {
+		t.Fatalf("wrong locals. got=%v", got)
+	}
+
+	var eval struct{ Result string }
+	c.call("evaluate", EvaluateArguments{Expression: "a * 10 + b", FrameID: top.ID}, &eval)
+	if eval.Result != "12" {
+		t.Fatalf("wrong evaluate result. got=%q", eval.Result)
+	}
+
+	c.call("next", map[string]int{"threadId": mainThread}, nil)
+	if f := c.stoppedAt(); f.Line != 3 {
+		t.Fatalf("next stopped on line %d, want 3", f.Line)
+	}
+	c.call("stepOut", map[string]int{"threadId": mainThread}, nil)
+	if f := c.stoppedAt(); f.Line != 6 || f.Name != "main" {
+		t.Fatalf("stepOut stopped at %s:%d, want main:6", f.Name, f.Line)
+	}
+
+	c.call("continue", map[string]int{"threadId": mainThread}, nil)
+	var out OutputEventBody
+	json.Unmarshal(c.wait("output").Body, &out)
+	if out.Output != "3\n" {
+		t.Fatalf("wrong output. got=%q", out.Output)
+	}
+	c.wait("terminated")
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	tests := []struct {
+		condition string
+		stops     bool
+	}{
+		{"a == 1", true},
+		{"a == 5", false},
+	}
+
+	for _, tt := range tests {
+		c := newClient(t)
+		c.launch([]SourceBreakpoint{{Line: 2, Condition: tt.condition}})
+		for {
+			var msg message
+			if len(c.events) > 0 {
+				msg, c.events = c.events[0], c.events[1:]
+			} else {
+				msg = c.read()
+			}
+			if msg.Event == "stopped" {
+				if !tt.stops {
+					t.Fatalf("%q: stopped when it should not have", tt.condition)
+				}
+				c.call("continue", map[string]int{"threadId": mainThread}, nil)
+				tt.stops = false
+			}
+			if msg.Event == "terminated" {
+				if tt.stops {
+					t.Fatalf("%q: did not stop", tt.condition)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestFunctionCalledByBuiltin(t *testing.T) {
+	c := newClient(t)
+	c.launchSource("let xs = map([1, 2], fn(x) {\n\tx * 2\n});\nputs(xs);\n", []SourceBreakpoint{{Line: 2}})
+
+	if f := c.stoppedAt(); f.Name != "<anonymous>" || f.Line != 2 {
+		t.Fatalf("wrong top frame. got=%s:%d", f.Name, f.Line)
+	}
+	c.call("continue", map[string]int{"threadId": mainThread}, nil)
+	c.stoppedAt()
+	c.call("continue", map[string]int{"threadId": mainThread}, nil)
+	var out OutputEventBody
+	json.Unmarshal(c.wait("output").Body, &out)
+	if out.Output != "[2, 4]\n" {
+		t.Fatalf("wrong output. got=%q", out.Output)
+	}
+	c.wait("terminated")
+}
+
+func TestScriptOperator(t *testing.T) {
+	c := newClient(t)
+	c.launchSource("infixl 6 <+> = fn(a, b) {\n\ta + b\n};\nputs(1 <+> 2);\n", []SourceBreakpoint{{Line: 2}})
+
+	if f := c.stoppedAt(); f.Name != "<+>" || f.Line != 2 {
+		t.Fatalf("wrong top frame. got=%s:%d", f.Name, f.Line)
+	}
+	c.call("continue", map[string]int{"threadId": mainThread}, nil)
+	var out OutputEventBody
+	json.Unmarshal(c.wait("output").Body, &out)
+	if out.Output != "3\n" {
+		t.Fatalf("wrong output. got=%q", out.Output)
+	}
+	c.wait("terminated")
+}
@@ -0,0 +1,37 @@
+package evaluator
+
+import (
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// annotationTypes maps the names accepted in type annotations to the object
+// types they admit.
+var annotationTypes = map[string][]object.ObjectType{
+	"int":      {object.INTEGER_OBJ},
+	"bool":     {object.BOOLEAN_OBJ},
+	"string":   {object.STRING_OBJ},
+	"array":    {object.ARRAY_OBJ},
+	"hash":     {object.HASH_OBJ},
+	"fn":       {object.FUNCTION_OBJ, object.BUILTIN_OBJ},
+	"null":     {object.NULL_OBJ},
+	"iterator": {object.ITERATOR_OBJ},
+}
+
+// checkAnnotation returns an error when val does not match the annotation.
+// A nil annotation matches anything.
+func checkAnnotation(t *ast.TypeAnnotation, val object.Object, what string) *object.Error {
+	if t == nil {
+		return nil
+	}
+	allowed, ok := annotationTypes[t.Name]
+	if !ok {
+		return newError("unknown type %q for %s", t.Name, what)
+	}
+	for _, ot := range allowed {
+		if val.Type() == ot {
+			return nil
+		}
+	}
+	return newError("%s: expected %s, got %s", what, allowed[0], val.Type())
+}
@@ -0,0 +1,119 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// namedArg is an argument passed by name, as in f(b: 3).
+type namedArg struct {
+	name  *ast.Identifier
+	value object.Object
+}
+
+// evalArguments evaluates the arguments of a call, expanding spread arrays
+// into the positional ones.
+func (e *Evaluator) evalArguments(exps []ast.Expression, env *object.Environment) ([]object.Object, []namedArg, object.Object) {
+	var args []object.Object
+	var named []namedArg
+	for _, exp := range exps {
+		switch exp := exp.(type) {
+		case *ast.SpreadExpression:
+			val := e.Eval(exp.Value, env)
+			if isError(val) {
+				return nil, nil, val
+			}
+			arr, ok := val.(*object.Array)
+			if !ok {
+				return nil, nil, newError("%s: cannot spread %s", exp.Pos(), val.Type())
+			}
+			args = append(args, arr.Elements...)
+		case *ast.NamedArgument:
+			val := e.Eval(exp.Value, env)
+			if isError(val) {
+				return nil, nil, val
+			}
+			named = append(named, namedArg{name: exp.Name, value: val})
+		default:
+			val := e.Eval(exp, env)
+			if isError(val) {
+				return nil, nil, val
+			}
+			args = append(args, val)
+		}
+	}
+	return args, named, nil
+}
+
+// bindArguments matches the arguments of call to the params of fn. The
+// values of params left to their defaults are nil.
+func bindArguments(call *ast.CallExpression, fn *object.Function, args []object.Object, named []namedArg) ([]object.Object, *object.Error) {
+	params := fn.Params
+	vals := make([]object.Object, len(params))
+	fixed := len(params)
+	if fixed > 0 && params[fixed-1].Variadic {
+		fixed--
+		rest := []object.Object{}
+		if len(args) > fixed {
+			rest = append(rest, args[fixed:]...)
+			args = args[:fixed]
+		}
+		vals[fixed] = &object.Array{Elements: rest}
+	}
+	if len(args) > fixed {
+		return nil, callError(call, "wrong number of arguments: want=%d, got=%d", fixed, len(args))
+	}
+	copy(vals, args)
+	for _, arg := range named {
+		i := paramIndex(params, arg.name.Value)
+		switch {
+		case i < 0:
+			return nil, newError("%s: unknown parameter %s", arg.name.Pos(), arg.name.Value)
+		case params[i].Variadic:
+			return nil, newError("%s: variadic parameter %s cannot be named", arg.name.Pos(), arg.name.Value)
+		case vals[i] != nil:
+			return nil, newError("%s: parameter %s is given more than once", arg.name.Pos(), arg.name.Value)
+		}
+		vals[i] = arg.value
+	}
+	for i, param := range params[:fixed] {
+		if vals[i] != nil || param.Default != nil {
+			continue
+		}
+		if len(named) == 0 && !hasDefaults(params) {
+			return nil, callError(call, "wrong number of arguments: want=%d, got=%d", fixed, len(args))
+		}
+		return nil, callError(call, "missing argument for parameter %s", param.Pattern)
+	}
+	return vals, nil
+}
+
+// callError returns an error about the arguments of call, prefixed with
+// its position. Calls made by builtins and hosts have none.
+func callError(call *ast.CallExpression, format string, a ...interface{}) *object.Error {
+	msg := fmt.Sprintf(format, a...)
+	if call == nil {
+		return newError("%s", msg)
+	}
+	return newError("%s: %s", call.Pos(), msg)
+}
+
+func paramIndex(params []*ast.Param, name string) int {
+	for i, param := range params {
+		if ident, ok := param.Name(); ok && ident.Value == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func hasDefaults(params []*ast.Param) bool {
+	for _, param := range params {
+		if param.Default != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/jarviliam/inti/object"
+)
+
+// builtins are the builtin functions that need no evaluator state.
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.String:
+				return &object.Integer{Value: int64(len(arg.Value))}
+			case *object.Array:
+				return &object.Integer{Value: int64(len(arg.Elements))}
+			case *object.Hash:
+				return &object.Integer{Value: int64(len(arg.Pairs))}
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"first": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArg("first", args)
+			if err != nil {
+				return err
+			}
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return NULL
+		},
+	},
+	"last": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArg("last", args)
+			if err != nil {
+				return err
+			}
+			if length := len(arr.Elements); length > 0 {
+				return arr.Elements[length-1]
+			}
+			return NULL
+		},
+	},
+	"rest": {
+		Fn: func(args ...object.Object) object.Object {
+			arr, err := arrayArg("rest", args)
+			if err != nil {
+				return err
+			}
+			length := len(arr.Elements)
+			if length == 0 {
+				return NULL
+			}
+			elements := make([]object.Object, length-1)
+			copy(elements, arr.Elements[1:])
+			return &object.Array{Elements: elements}
+		},
+	},
+	"push": {
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, ok := args[0].(*object.Array)
+			if !ok {
+				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+			}
+			length := len(arr.Elements)
+			elements := make([]object.Object, length+1)
+			copy(elements, arr.Elements)
+			elements[length] = args[1]
+			return &object.Array{Elements: elements}
+		},
+	},
+	// quote is evaluated where it is called, unquote by quote
+	"quote": {
+		Fn: func(args ...object.Object) object.Object {
+			return newError("quote must be called by name")
+		},
+	},
+	"unquote": {
+		Fn: func(args ...object.Object) object.Object {
+			return newError("unquote outside of quote")
+		},
+	},
+}
+
+// newBuiltins returns the builtins available to e: the pure ones and the
+// privileged ones it has the capability for.
+func (e *Evaluator) newBuiltins() map[string]*object.Builtin {
+	b := make(map[string]*object.Builtin, len(builtins)+len(builtinCapabilities))
+	for name, fn := range builtins {
+		b[name] = fn
+	}
+	for name, fn := range e.privileged() {
+		c := builtinCapabilities[name]
+		if c != CapPure && e.caps&c == 0 || e.withdrawn(name) {
+			continue
+		}
+		if inputBuiltins[name] {
+			fn = e.recorded(name, fn)
+		}
+		if e.audit != nil && c != CapPure {
+			name, fn := name, fn
+			b[name] = &object.Builtin{Fn: func(args ...object.Object) object.Object {
+				e.audit(AuditEvent{Builtin: name, Capability: c, Args: args})
+				return fn(args...)
+			}}
+			continue
+		}
+		b[name] = &object.Builtin{Fn: fn}
+	}
+	return b
+}
+
+// BuiltinNames returns the names of all builtin functions, whatever
+// capabilities they need, sorted.
+func BuiltinNames() []string {
+	names := make([]string, 0, len(builtins)+len(builtinCapabilities))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	for name := range builtinCapabilities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func arrayArg(name string, args []object.Object) (*object.Array, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	return arr, nil
+}
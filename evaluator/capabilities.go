@@ -0,0 +1,293 @@
+package evaluator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jarviliam/inti/object"
+)
+
+// Capability is a set of kinds of access to the world outside the
+// evaluator that builtins may need. Builtins needing a capability the
+// evaluator was not granted are absent.
+type Capability uint
+
+const (
+	CapIO Capability = 1 << iota
+	CapFS
+	CapEnv
+	CapTime
+	CapNet
+
+	// CapPure grants nothing: only builtins computing on their arguments
+	// are present.
+	CapPure Capability = 0
+	CapAll             = CapIO | CapFS | CapEnv | CapTime | CapNet
+)
+
+var capabilityNames = []struct {
+	cap  Capability
+	name string
+}{
+	{CapIO, "io"},
+	{CapFS, "fs"},
+	{CapEnv, "env"},
+	{CapTime, "time"},
+	{CapNet, "net"},
+}
+
+func (c Capability) String() string {
+	if c == CapPure {
+		return "pure"
+	}
+	var names []string
+	for _, cn := range capabilityNames {
+		if c&cn.cap != 0 {
+			names = append(names, cn.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseCapabilities parses a comma separated list of capability names, as
+// printed by Capability.String. "all" grants every capability.
+func ParseCapabilities(s string) (Capability, error) {
+	var c Capability
+	for _, name := range strings.Split(s, ",") {
+		switch name = strings.TrimSpace(name); name {
+		case "pure", "":
+			continue
+		case "all":
+			c |= CapAll
+			continue
+		}
+		found := false
+		for _, cn := range capabilityNames {
+			if cn.name == name {
+				c |= cn.cap
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown capability %q", name)
+		}
+	}
+	return c, nil
+}
+
+// builtinCapabilities holds the capability each builtin bound to an
+// evaluator needs. Those needing one are privileged. args needs none: the
+// host chose to pass the arguments, so even pure and deterministic scripts
+// may read them.
+var builtinCapabilities = map[string]Capability{
+	"puts":       CapIO,
+	"read_line":  CapIO,
+	"read_file":  CapFS,
+	"write_file": CapFS,
+	"env":        CapEnv,
+	"now":        CapTime,
+	"sleep":      CapTime,
+	"http_get":   CapNet,
+	"args":       CapPure,
+	"random":     CapPure,
+	"next":       CapPure,
+	"collect":    CapPure,
+	"take":       CapPure,
+	"map":        CapPure,
+	"filter":     CapPure,
+	"await":      CapPure,
+	"channel":    CapPure,
+	"send":       CapPure,
+	"receive":    CapPure,
+	"close":      CapPure,
+}
+
+// AuditEvent records a call of a privileged builtin.
+type AuditEvent struct {
+	Builtin    string
+	Capability Capability
+	Args       []object.Object
+}
+
+// WithCapabilities sets the capabilities granted to scripts. It defaults to
+// CapAll.
+func WithCapabilities(c Capability) Option {
+	return func(e *Evaluator) { e.caps = c }
+}
+
+// WithAudit calls audit before each call of a privileged builtin.
+func WithAudit(audit func(AuditEvent)) Option {
+	return func(e *Evaluator) { e.audit = audit }
+}
+
+// WithInput sets where read_line reads from. It defaults to os.Stdin.
+func WithInput(r io.Reader) Option {
+	return func(e *Evaluator) { e.in = bufio.NewReader(r) }
+}
+
+// privileged returns the builtins bound to e, most of which need a
+// capability.
+func (e *Evaluator) privileged() map[string]object.BuiltinFunction {
+	fns := map[string]object.BuiltinFunction{
+		"puts": func(args ...object.Object) object.Object {
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			for _, arg := range args {
+				fmt.Fprintln(e.out, arg.Inspect())
+			}
+			return NULL
+		},
+		"read_line": func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			e.mu.Lock()
+			line, err := e.in.ReadString('\n')
+			e.mu.Unlock()
+			if err == io.EOF && line == "" {
+				return NULL
+			}
+			if err != nil && err != io.EOF {
+				return newError("read_line: %s", err)
+			}
+			return &object.String{Value: strings.TrimSuffix(line, "\n")}
+		},
+		"read_file": func(args ...object.Object) object.Object {
+			path, err := stringArgs("read_file", args, 1)
+			if err != nil {
+				return err
+			}
+			data, rerr := ioutil.ReadFile(path[0])
+			if rerr != nil {
+				return newError("read_file: %s", rerr)
+			}
+			return &object.String{Value: string(data)}
+		},
+		"write_file": func(args ...object.Object) object.Object {
+			strs, err := stringArgs("write_file", args, 2)
+			if err != nil {
+				return err
+			}
+			if werr := ioutil.WriteFile(strs[0], []byte(strs[1]), 0644); werr != nil {
+				return newError("write_file: %s", werr)
+			}
+			return NULL
+		},
+		"env": func(args ...object.Object) object.Object {
+			name, err := stringArgs("env", args, 1)
+			if err != nil {
+				return err
+			}
+			val, ok := os.LookupEnv(name[0])
+			if !ok {
+				return NULL
+			}
+			return &object.String{Value: val}
+		},
+		"args": func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			elements := make([]object.Object, len(e.args))
+			for i, arg := range e.args {
+				elements[i] = &object.String{Value: arg}
+			}
+			return &object.Array{Elements: elements}
+		},
+		"now": func(args ...object.Object) object.Object {
+			if len(args) != 0 {
+				return newError("wrong number of arguments. got=%d, want=0", len(args))
+			}
+			return &object.Integer{Value: e.clock.Now().UnixNano() / int64(time.Millisecond)}
+		},
+		"sleep": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ms, ok := args[0].(*object.Integer)
+			if !ok {
+				return newError("argument to `sleep` must be INTEGER, got %s", args[0].Type())
+			}
+			if err := e.clock.Sleep(e.ctx, time.Duration(ms.Value)*time.Millisecond); err != nil {
+				return causeError(err)
+			}
+			return NULL
+		},
+		"random": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			n, ok := args[0].(*object.Integer)
+			if !ok || n.Value <= 0 {
+				return newError("argument to `random` must be a positive INTEGER, got %s", args[0].Inspect())
+			}
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			return &object.Integer{Value: e.rand.Int63n(n.Value)}
+		},
+		"http_get": func(args ...object.Object) object.Object {
+			url, err := stringArgs("http_get", args, 1)
+			if err != nil {
+				return err
+			}
+			req, rerr := http.NewRequestWithContext(e.ctx, "GET", url[0], nil)
+			if rerr != nil {
+				return newError("http_get: %s", rerr)
+			}
+			resp, rerr := http.DefaultClient.Do(req)
+			if rerr != nil {
+				return newError("http_get: %s", rerr)
+			}
+			defer resp.Body.Close()
+			body, rerr := ioutil.ReadAll(resp.Body)
+			if rerr != nil {
+				return newError("http_get: %s", rerr)
+			}
+			if resp.StatusCode >= 400 {
+				return newError("http_get: %s", resp.Status)
+			}
+			return &object.String{Value: string(body)}
+		},
+	}
+	for name, fn := range e.iteratorBuiltins() {
+		fns[name] = fn
+	}
+	for name, fn := range e.concurrencyBuiltins() {
+		fns[name] = fn
+	}
+	return fns
+}
+
+// deniedError reports a call of a builtin needing a capability e lacks, or
+// one deterministic mode withdraws.
+func (e *Evaluator) deniedError(name string) (*object.Error, bool) {
+	if e.withdrawn(name) {
+		return newError("%s is not available in deterministic mode without replayed input", name), true
+	}
+	c, ok := builtinCapabilities[name]
+	if !ok || c == CapPure || e.caps&c != 0 {
+		return nil, false
+	}
+	return newError("capability denied: %s needs %s", name, c), true
+}
+
+func stringArgs(name string, args []object.Object, n int) ([]string, *object.Error) {
+	if len(args) != n {
+		return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), n)
+	}
+	strs := make([]string, n)
+	for i, arg := range args {
+		s, ok := arg.(*object.String)
+		if !ok {
+			return nil, newError("argument to `%s` must be STRING, got %s", name, arg.Type())
+		}
+		strs[i] = s.Value
+	}
+	return strs, nil
+}
@@ -0,0 +1,247 @@
+package evaluator
+
+import (
+	"reflect"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// evalSpawnExpression evaluates the function and arguments of a spawned
+// call, then makes the call on a fork of e running on a goroutine of its
+// own. Deterministic mode has no spawn, as tasks are scheduled freely.
+func (e *Evaluator) evalSpawnExpression(node *ast.SpawnExpression, env *object.Environment) object.Object {
+	if e.deterministic {
+		return newError("%s: spawn is not available in deterministic mode", node.Pos())
+	}
+	function := e.Eval(node.Call.Function, env)
+	if isError(function) {
+		return function
+	}
+	args, named, err := e.evalArguments(node.Call.Args, env)
+	if err != nil {
+		return err
+	}
+	task := &object.Task{Done: make(chan struct{})}
+	f := e.fork()
+	f.depth = 0
+	go func() {
+		task.Result = f.applyFunction(node.Call, function, args, named)
+		close(task.Done)
+	}()
+	return task
+}
+
+// evalSelectExpression waits for the first case of a select able to go
+// ahead, picking among those ready at random, or the first in deterministic
+// mode, and evaluates its body. It stops waiting with an error once the
+// context is done.
+func (e *Evaluator) evalSelectExpression(node *ast.SelectExpression, env *object.Environment, tail bool) object.Object {
+	cases := make([]reflect.SelectCase, 0, len(node.Cases)+1)
+	for _, c := range node.Cases {
+		if c.IsDefault() {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+			continue
+		}
+		val := e.Eval(c.Channel, env)
+		if isError(val) {
+			return val
+		}
+		ch, ok := val.(*object.Channel)
+		if !ok {
+			return newError("%s: cannot select on %s", c.Channel.Pos(), val.Type())
+		}
+		sc := reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch.C)}
+		if c.Value != nil {
+			v := e.Eval(c.Value, env)
+			if isError(v) {
+				return v
+			}
+			sc.Dir, sc.Send = reflect.SelectSend, reflect.ValueOf(v)
+		}
+		cases = append(cases, sc)
+	}
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(e.ctx.Done())})
+
+	chosen, recv, ok, err := e.selectCases(cases)
+	if err != nil {
+		return err
+	}
+	if chosen == len(node.Cases) {
+		return causeError(e.ctx.Err())
+	}
+	c := node.Cases[chosen]
+	scope := object.NewEnclosedEnvironment(env)
+	if c.Var != nil {
+		var val object.Object = NULL
+		if ok {
+			val = recv.Interface().(object.Object)
+		}
+		scope.Set(c.Var.Value, val)
+	}
+	return e.evalIn(c.Body, scope, tail)
+}
+
+func (e *Evaluator) selectCases(cases []reflect.SelectCase) (chosen int, recv reflect.Value, ok bool, err *object.Error) {
+	defer func() {
+		if recover() != nil {
+			err = newError("send on closed channel")
+		}
+	}()
+	if e.deterministic {
+		// try the cases in order before waiting, which without spawn only
+		// ends with the context
+		for i, c := range cases {
+			if c.Dir == reflect.SelectDefault {
+				continue
+			}
+			try := []reflect.SelectCase{c, {Dir: reflect.SelectDefault}}
+			if ready, recv, ok := reflect.Select(try); ready == 0 {
+				return i, recv, ok, nil
+			}
+		}
+	}
+	chosen, recv, ok = reflect.Select(cases)
+	return chosen, recv, ok, nil
+}
+
+// evalForChannel runs a for loop over the values received from ch until it
+// is closed.
+func (e *Evaluator) evalForChannel(node *ast.ForStatement, ch *object.Channel, env *object.Environment) object.Object {
+	for {
+		var el object.Object
+		select {
+		case val, ok := <-ch.C:
+			if !ok {
+				return NULL
+			}
+			el = val
+		case <-e.ctx.Done():
+			return causeError(e.ctx.Err())
+		}
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(node.Var.Value, el)
+		result := e.Eval(node.Body, scope)
+		switch result := result.(type) {
+		case *object.Error, *object.ReturnValue:
+			return result
+		case *branch:
+			if result == breakBranch {
+				return NULL
+			}
+		}
+	}
+}
+
+// concurrencyBuiltins returns the builtins working on tasks and channels.
+// Those that wait stop with an error once the context is done.
+func (e *Evaluator) concurrencyBuiltins() map[string]object.BuiltinFunction {
+	return map[string]object.BuiltinFunction{
+		"await": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			task, ok := args[0].(*object.Task)
+			if !ok {
+				return newError("argument to `await` must be TASK, got %s", args[0].Type())
+			}
+			select {
+			case <-task.Done:
+			case <-e.ctx.Done():
+				return causeError(e.ctx.Err())
+			}
+			if err, ok := task.Result.(*object.Error); ok {
+				// each await unwinds with its own copy, adding to its trace
+				raised := *err
+				raised.Trace = append([]string(nil), err.Trace...)
+				return &raised
+			}
+			return task.Result
+		},
+		"channel": func(args ...object.Object) object.Object {
+			if len(args) > 1 {
+				return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+			}
+			size := int64(0)
+			if len(args) == 1 {
+				n, ok := args[0].(*object.Integer)
+				if !ok || n.Value < 0 {
+					return newError("argument to `channel` must be a non-negative INTEGER, got %s", args[0].Inspect())
+				}
+				size = n.Value
+			}
+			return &object.Channel{C: make(chan object.Object, size)}
+		},
+		"send": func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			ch, err := channelArg("send", args[0])
+			if err != nil {
+				return err
+			}
+			return e.send(ch, args[1])
+		},
+		"receive": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ch, err := channelArg("receive", args[0])
+			if err != nil {
+				return err
+			}
+			select {
+			case val, ok := <-ch.C:
+				if !ok {
+					return NULL
+				}
+				return val
+			case <-e.ctx.Done():
+				return causeError(e.ctx.Err())
+			}
+		},
+		"close": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			ch, err := channelArg("close", args[0])
+			if err != nil {
+				return err
+			}
+			return closeChannel(ch)
+		},
+	}
+}
+
+// send sends val on ch, reporting an error if ch is or gets closed.
+func (e *Evaluator) send(ch *object.Channel, val object.Object) (result object.Object) {
+	defer func() {
+		if recover() != nil {
+			result = newError("send on closed channel")
+		}
+	}()
+	select {
+	case ch.C <- val:
+		return NULL
+	case <-e.ctx.Done():
+		return causeError(e.ctx.Err())
+	}
+}
+
+func closeChannel(ch *object.Channel) (result object.Object) {
+	defer func() {
+		if recover() != nil {
+			result = newError("close of closed channel")
+		}
+	}()
+	close(ch.C)
+	return NULL
+}
+
+func channelArg(name string, arg object.Object) (*object.Channel, *object.Error) {
+	ch, ok := arg.(*object.Channel)
+	if !ok {
+		return nil, newError("argument to `%s` must be CHANNEL, got %s", name, arg.Type())
+	}
+	return ch, nil
+}
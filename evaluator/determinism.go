@@ -0,0 +1,212 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jarviliam/inti/object"
+)
+
+// Clock is the time source of the now and sleep builtins.
+type Clock interface {
+	Now() time.Time
+	// Sleep waits for d, returning early with ctx.Err() if ctx is done.
+	Sleep(ctx context.Context, d time.Duration) error
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) Sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// VirtualClock is a Clock whose time only moves when a script sleeps, which
+// returns at once.
+type VirtualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{now: start}
+}
+
+func (c *VirtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *VirtualClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return nil
+}
+
+// DeterministicEpoch is the time virtual clocks start at in deterministic
+// mode.
+var DeterministicEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// nondeterministic are the capabilities withdrawn in deterministic mode.
+// Time stays, as it is virtual.
+const nondeterministic = CapFS | CapEnv | CapNet
+
+func WithClock(c Clock) Option {
+	return func(e *Evaluator) { e.clock = c }
+}
+
+// WithSeed seeds the random builtin. It is seeded from the time by default.
+func WithSeed(seed int64) Option {
+	return func(e *Evaluator) { e.rand = rand.New(rand.NewSource(seed)) }
+}
+
+// WithDeterministic makes runs repeatable: random is seeded with seed, the
+// clock is virtual and starts at DeterministicEpoch, and the fs, env and net
+// capabilities are withdrawn. read_line is withdrawn too unless WithReplay
+// supplies the lines it returns. Hashes always iterate in a stable order,
+// select takes the first case ready and spawn is an error.
+func WithDeterministic(seed int64) Option {
+	return func(e *Evaluator) {
+		WithSeed(seed)(e)
+		e.clock = NewVirtualClock(DeterministicEpoch)
+		e.deterministic = true
+	}
+}
+
+// inputBuiltins are the builtins whose results come from outside the
+// program, which are recorded and replayed.
+var inputBuiltins = map[string]bool{
+	"read_line": true,
+	"read_file": true,
+	"env":       true,
+	"args":      true,
+	"now":       true,
+	"random":    true,
+	"http_get":  true,
+}
+
+// withdrawn reports whether deterministic mode withdraws the builtin name
+// although e has the capability it needs. read_line reads live input, so it
+// is only left when its results are replayed.
+func (e *Evaluator) withdrawn(name string) bool {
+	return e.deterministic && e.replay == nil && name == "read_line"
+}
+
+// WithRecord writes the result of each call of a builtin taking input from
+// outside the program to w, one JSON object per line, for WithReplay.
+func WithRecord(w io.Writer) Option {
+	return func(e *Evaluator) { e.record = json.NewEncoder(w) }
+}
+
+// WithReplay makes builtins taking input from outside the program return
+// the results recorded by WithRecord in r instead, in order.
+func WithReplay(r io.Reader) Option {
+	return func(e *Evaluator) { e.replay = json.NewDecoder(r) }
+}
+
+type recordEntry struct {
+	Builtin string        `json:"builtin"`
+	Result  recordedValue `json:"result"`
+}
+
+// recordedValue is an object a builtin returned, in JSON.
+type recordedValue struct {
+	Type     object.ObjectType `json:"type"`
+	Int      int64             `json:"int,omitempty"`
+	String   string            `json:"string,omitempty"`
+	Elements []recordedValue   `json:"elements,omitempty"`
+}
+
+// recorded wraps the input builtin name to record or replay its results.
+func (e *Evaluator) recorded(name string, fn object.BuiltinFunction) object.BuiltinFunction {
+	switch {
+	case e.replay != nil:
+		return func(args ...object.Object) object.Object {
+			var entry recordEntry
+			e.mu.Lock()
+			err := e.replay.Decode(&entry)
+			e.mu.Unlock()
+			if err == io.EOF {
+				return newError("replay: no result recorded for call of %s", name)
+			} else if err != nil {
+				return newError("replay: %s", err)
+			}
+			if entry.Builtin != name {
+				return newError("replay: call of %s, but %s was recorded", name, entry.Builtin)
+			}
+			return entry.Result.object()
+		}
+	case e.record != nil:
+		return func(args ...object.Object) object.Object {
+			result := fn(args...)
+			v, err := recordValue(result)
+			if err == nil {
+				e.mu.Lock()
+				err = e.record.Encode(recordEntry{Builtin: name, Result: v})
+				e.mu.Unlock()
+			}
+			if err != nil {
+				return newError("record: %s", err)
+			}
+			return result
+		}
+	}
+	return fn
+}
+
+func recordValue(obj object.Object) (recordedValue, error) {
+	v := recordedValue{Type: obj.Type()}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		v.Int = obj.Value
+	case *object.String:
+		v.String = obj.Value
+	case *object.Error:
+		v.String = obj.Message
+	case *object.Null:
+	case *object.Array:
+		for _, el := range obj.Elements {
+			ev, err := recordValue(el)
+			if err != nil {
+				return v, err
+			}
+			v.Elements = append(v.Elements, ev)
+		}
+	default:
+		return v, fmt.Errorf("cannot record %s", obj.Type())
+	}
+	return v, nil
+}
+
+func (v recordedValue) object() object.Object {
+	switch v.Type {
+	case object.INTEGER_OBJ:
+		return &object.Integer{Value: v.Int}
+	case object.STRING_OBJ:
+		return &object.String{Value: v.String}
+	case object.ERROR_OBJ:
+		return &object.Error{Message: v.String}
+	case object.ARRAY_OBJ:
+		elements := make([]object.Object, len(v.Elements))
+		for i, ev := range v.Elements {
+			elements[i] = ev.object()
+		}
+		return &object.Array{Elements: elements}
+	}
+	return NULL
+}
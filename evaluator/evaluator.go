@@ -1,8 +1,20 @@
 package evaluator
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
 	"github.com/jarviliam/inti/ast"
 	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
 )
 
 var (
@@ -11,27 +23,331 @@ var (
 	FALSE = &object.Boolean{Value: false}
 )
 
-func Eval(node ast.Node) object.Object {
+// Hook observes evaluation. Before is called ahead of every statement and
+// expression; returning an error stops evaluation with that error.
+type Hook interface {
+	Before(node ast.Node, env *object.Environment) error
+}
+
+// CallHook may be implemented by a Hook to follow calls of user functions.
+// env holds the bound arguments. call is nil for calls made through Apply.
+type CallHook interface {
+	EnterCall(call *ast.CallExpression, fn *object.Function, env *object.Environment)
+	ExitCall(call *ast.CallExpression)
+}
+
+type Evaluator struct {
+	hook     Hook
+	out      io.Writer
+	in       *bufio.Reader
+	args     []string
+	builtins map[string]*object.Builtin
+	caps     Capability
+	audit    func(AuditEvent)
+
+	clock         Clock
+	rand          *rand.Rand
+	deterministic bool
+	record        *json.Encoder
+	replay        *json.Decoder
+
+	// mu guards what forks of the evaluator share: the output, input and
+	// random source, the record and replay streams and the module cache.
+	mu *sync.Mutex
+
+	file       string
+	searchPath []string
+	// ops holds the operators imported files are parsed with.
+	ops *parser.Operators
+	// modules caches imported modules by absolute path, including those
+	// still being evaluated.
+	modules map[string]*moduleEntry
+	// moduleFiles maps the global environment of each imported module to
+	// its file, so imports in its functions resolve against it wherever
+	// they are called from.
+	moduleFiles map[*object.Environment]string
+	// loading holds the files being imported, innermost last.
+	loading []string
+
+	// tries counts the try expressions being evaluated in the current
+	// function, in which returns are not tail calls.
+	tries int
+	// gen is the generator whose body e evaluates, if any.
+	gen *generator
+	// generators holds the generators started by the current EvalContext or
+	// Apply call. It is nil outside of one.
+	generators *generators
+	// operators implements the operators added by WithOperator.
+	operators map[string]object.BuiltinFunction
+	// expanding is set while a macro call is being expanded.
+	expanding bool
+	// gensym counts the names made fresh by macro expansions.
+	gensym *int64
+
+	ctx    context.Context
+	limits Limits
+	budget *budget
+	depth  int
+}
+
+type Option func(*Evaluator)
+
+func WithHook(h Hook) Option {
+	return func(e *Evaluator) { e.hook = h }
+}
+
+// WithOutput sets where puts writes. It defaults to os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(e *Evaluator) { e.out = w }
+}
+
+// WithArgs sets the script arguments returned by the args builtin.
+func WithArgs(args []string) Option {
+	return func(e *Evaluator) { e.args = args }
+}
+
+func New(opts ...Option) *Evaluator {
+	e := &Evaluator{
+		out:         os.Stdout,
+		in:          bufio.NewReader(os.Stdin),
+		caps:        CapAll,
+		clock:       realClock{},
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		ctx:         context.Background(),
+		searchPath:  filepath.SplitList(os.Getenv("INTI_PATH")),
+		modules:     make(map[string]*moduleEntry),
+		moduleFiles: make(map[*object.Environment]string),
+		mu:          &sync.Mutex{},
+		budget:      &budget{},
+		gensym:      new(int64),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.deterministic {
+		e.caps &^= nondeterministic
+	}
+	e.builtins = e.newBuiltins()
+	return e
+}
+
+// fork returns a copy of e for evaluating on another goroutine. It shares
+// e's options, budget and module cache but not its call state, and has
+// builtins of its own bound to it.
+func (e *Evaluator) fork() *Evaluator {
+	f := *e
+	f.tries, f.gen = 0, nil
+	f.loading = append([]string(nil), e.loading...)
+	f.builtins = f.newBuiltins()
+	return &f
+}
+
+// Eval evaluates node in env using an evaluator with default options.
+func Eval(node ast.Node, env *object.Environment) object.Object {
+	return New().Eval(node, env)
+}
+
+func (e *Evaluator) Eval(node ast.Node, env *object.Environment) object.Object {
+	return e.evalIn(node, env, false)
+}
+
+// evalIn evaluates node. tail is set when node is in tail position in a
+// function body, where calls are not made but returned as tail calls for
+// the caller to make, so that they do not grow the Go stack.
+func (e *Evaluator) evalIn(node ast.Node, env *object.Environment, tail bool) object.Object {
+	if err := e.step(); err != nil {
+		return err
+	}
+	result := e.eval(node, env, tail)
+	if err := e.allocate(node, result); err != nil {
+		return err
+	}
+	return result
+}
+
+func (e *Evaluator) eval(node ast.Node, env *object.Environment, tail bool) object.Object {
+	if e.hook != nil {
+		if _, ok := node.(*ast.Program); !ok {
+			if err := e.hook.Before(node, env); err != nil {
+				return newError("%s", err)
+			}
+		}
+	}
+
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalStatements(node.Statements)
+		program, err := e.ExpandMacros(node, env)
+		if err != nil {
+			return err
+		}
+		return e.evalProgram(program.Statements, env)
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression)
+		return e.evalIn(node.Expression, env, tail)
+	case *ast.BlockStatement:
+		return e.evalBlockStatement(node, env, tail)
+	case *ast.LetStatement:
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		if node.Pattern != nil {
+			if err := e.destructure(node.Pattern, val, env); err != nil {
+				return err
+			}
+			return nil
+		}
+		if err := checkAnnotation(node.Name.Type, val, "let "+node.Name.Value); err != nil {
+			return err
+		}
+		env.Set(node.Name.Value, val)
+	case *ast.ReturnStatement:
+		// the value returned is in tail position unless a try encloses it
+		val := e.evalIn(node.ReturnValue, env, e.tries == 0)
+		if isError(val) {
+			return val
+		}
+		return &object.ReturnValue{Value: val}
+	case *ast.YieldStatement:
+		return e.evalYieldStatement(node, env)
+	case *ast.OperatorDeclaration:
+		return e.evalOperatorDeclaration(node, env)
+	case *ast.ThrowStatement:
+		val := e.Eval(node.Value, env)
+		if isError(val) {
+			return val
+		}
+		return thrown(val)
+	case *ast.TryExpression:
+		return e.evalTryExpression(node, env)
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env, tail)
+	case *ast.SpawnExpression:
+		return e.evalSpawnExpression(node, env)
+	case *ast.SelectExpression:
+		return e.evalSelectExpression(node, env, tail)
+	case *ast.ForStatement:
+		return e.evalForStatement(node, env)
+	case *ast.BranchStatement:
+		if node.Token.Literal == "break" {
+			return breakBranch
+		}
+		return continueBranch
 	case *ast.PrefixExpression:
-		right := Eval(node.Right)
+		right := e.Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		if result, ok := e.evalOperator(node, node.Operator, []object.Object{right}, env); ok {
+			return result
+		}
 		return evalPrefixExpression(node.Operator, right)
+	case *ast.InfixExpression:
+		left := e.Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		right := e.Eval(node.Right, env)
+		if isError(right) {
+			return right
+		}
+		if result, ok := e.evalOperator(node, node.Operator, []object.Object{left, right}, env); ok {
+			return result
+		}
+		return evalInfixExpression(node.Operator, left, right)
+	case *ast.IfExpression:
+		return e.evalIfExpression(node, env, tail)
+	case *ast.Identifier:
+		return e.evalIdentifier(node, env)
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
 	case *ast.Boolean:
 		return nativeBoolToObject(node.Value)
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+	case *ast.HashLiteral:
+		return e.evalHashLiteral(node, env)
+	case *ast.IndexExpression:
+		left := e.Eval(node.Left, env)
+		if isError(left) {
+			return left
+		}
+		index := e.Eval(node.Index, env)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+	case *ast.ImportExpression:
+		return e.evalImport(node.Path, env)
+	case *ast.ImportStatement:
+		return e.evalImportStatement(node, env)
+	case *ast.MemberExpression:
+		obj := e.Eval(node.Object, env)
+		if isError(obj) {
+			return obj
+		}
+		if ev, ok := obj.(*object.ErrorValue); ok {
+			return errorMember(ev, node.Member)
+		}
+		return evalMemberExpression(obj, node.Member)
+	case *ast.FunctionLiteral:
+		return &object.Function{Params: node.Params, Generator: node.Generator, ReturnType: node.ReturnType, Block: node.Block, Env: env}
+	case *ast.MacroLiteral:
+		return newError("%s: macros can only be bound by top-level lets", node.Pos())
+	case *ast.CallExpression:
+		if isCallOf(node, "quote") {
+			if _, ok := env.Get("quote"); !ok {
+				return e.evalQuote(node, env)
+			}
+		}
+		function := e.Eval(node.Function, env)
+		if isError(function) {
+			return function
+		}
+		args, named, err := e.evalArguments(node.Args, env)
+		if err != nil {
+			return err
+		}
+		if tail {
+			return &tailCall{call: node, fn: function, args: args, named: named}
+		}
+		return e.applyFunction(node, function, args, named)
 	}
 	return nil
 }
 
-func evalStatements(stmts []ast.Statement) object.Object {
+func (e *Evaluator) evalProgram(stmts []ast.Statement, env *object.Environment) object.Object {
 	var result object.Object
 	for _, statement := range stmts {
-		result = Eval(statement)
+		result = e.Eval(statement, env)
+
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			if tc, ok := result.Value.(*tailCall); ok {
+				return e.applyFunction(tc.call, tc.fn, tc.args, tc.named)
+			}
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+func (e *Evaluator) evalBlockStatement(block *ast.BlockStatement, env *object.Environment, tail bool) object.Object {
+	var result object.Object
+	for i, statement := range block.Statements {
+		result = e.evalIn(statement, env, tail && i == len(block.Statements)-1)
+
+		switch result.(type) {
+		case *object.ReturnValue, *object.Error, *branch:
+			return result
+		}
 	}
 	return result
 }
@@ -43,12 +359,35 @@ func nativeBoolToObject(in bool) *object.Boolean {
 	return FALSE
 }
 
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+func isError(obj object.Object) bool {
+	return obj != nil && obj.Type() == object.ERROR_OBJ
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj {
+	case NULL:
+		return false
+	case TRUE:
+		return true
+	case FALSE:
+		return false
+	default:
+		return true
+	}
+}
+
 func evalPrefixExpression(op string, right object.Object) object.Object {
 	switch op {
 	case "!":
 		return evalBangOperatorExpression(right)
+	case "-":
+		return evalMinusPrefixOperatorExpression(right)
 	default:
-		return NULL
+		return newError("unknown operator: %s%s", op, right.Type())
 	}
 }
 
@@ -64,3 +403,260 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 		return FALSE
 	}
 }
+
+func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
+	if right.Type() != object.INTEGER_OBJ {
+		return newError("unknown operator: -%s", right.Type())
+	}
+	value := right.(*object.Integer).Value
+	return &object.Integer{Value: -value}
+}
+
+func evalInfixExpression(op string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
+		return evalIntegerInfixExpression(op, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(op, left, right)
+	case op == "==":
+		return nativeBoolToObject(left == right)
+	case op == "!=":
+		return nativeBoolToObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), op, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+func evalIntegerInfixExpression(op string, left, right object.Object) object.Object {
+	l := left.(*object.Integer).Value
+	r := right.(*object.Integer).Value
+
+	switch op {
+	case "+":
+		return &object.Integer{Value: l + r}
+	case "-":
+		return &object.Integer{Value: l - r}
+	case "*":
+		return &object.Integer{Value: l * r}
+	case "/":
+		if r == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: l / r}
+	case "<":
+		return nativeBoolToObject(l < r)
+	case ">":
+		return nativeBoolToObject(l > r)
+	case "==":
+		return nativeBoolToObject(l == r)
+	case "!=":
+		return nativeBoolToObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+func evalStringInfixExpression(op string, left, right object.Object) object.Object {
+	l := left.(*object.String).Value
+	r := right.(*object.String).Value
+
+	switch op {
+	case "+":
+		return &object.String{Value: l + r}
+	case "==":
+		return nativeBoolToObject(l == r)
+	case "!=":
+		return nativeBoolToObject(l != r)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+func (e *Evaluator) evalIfExpression(ie *ast.IfExpression, env *object.Environment, tail bool) object.Object {
+	condition := e.Eval(ie.Condition, env)
+	if isError(condition) {
+		return condition
+	}
+	if isTruthy(condition) {
+		return e.evalIn(ie.Consequence, env, tail)
+	} else if ie.Alternative != nil {
+		return e.evalIn(ie.Alternative, env, tail)
+	}
+	return NULL
+}
+
+func (e *Evaluator) evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin, ok := e.builtins[node.Value]; ok {
+		return builtin
+	}
+	if err, ok := e.deniedError(node.Value); ok {
+		return err
+	}
+	return newError("identifier not found: " + node.Value)
+}
+
+func (e *Evaluator) evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
+	var result []object.Object
+	for _, exp := range exps {
+		evaluated := e.Eval(exp, env)
+		if isError(evaluated) {
+			return []object.Object{evaluated}
+		}
+		result = append(result, evaluated)
+	}
+	return result
+}
+
+func (e *Evaluator) evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for _, pair := range node.Pairs {
+		key := e.Eval(pair.Key, env)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		value := e.Eval(pair.Value, env)
+		if isError(value) {
+			return value
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[i]
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// applyFunction calls fn, then the functions it tail calls in turn, until
+// one returns a value.
+func (e *Evaluator) applyFunction(call *ast.CallExpression, fn object.Object, args []object.Object, named []namedArg) object.Object {
+	// return types are checked on the final value, once per distinct
+	// annotation in a run of calls
+	var returnTypes []*ast.TypeAnnotation
+	for {
+		var result object.Object
+		switch f := fn.(type) {
+		case *object.Function:
+			result = e.callFunction(call, f, args, named)
+			if f.ReturnType != nil && (len(returnTypes) == 0 || returnTypes[len(returnTypes)-1] != f.ReturnType) {
+				returnTypes = append(returnTypes, f.ReturnType)
+			}
+		case *object.Builtin:
+			if len(named) > 0 {
+				result = newError("%s: builtin functions take no named arguments", named[0].name.Pos())
+				break
+			}
+			result = f.Fn(args...)
+		default:
+			return newError("not a function: %s", fn.Type())
+		}
+		if tc, ok := result.(*tailCall); ok {
+			call, fn, args, named = tc.call, tc.fn, tc.args, tc.named
+			continue
+		}
+		if err, ok := result.(*object.Error); ok {
+			traceCall(err, call)
+			return err
+		}
+		for _, rt := range returnTypes {
+			if err := checkAnnotation(rt, result, "return value"); err != nil {
+				return err
+			}
+		}
+		return result
+	}
+}
+
+// callFunction evaluates the body of fn, returning its value or the call
+// it ends in.
+func (e *Evaluator) callFunction(call *ast.CallExpression, fn *object.Function, args []object.Object, named []namedArg) object.Object {
+	vals, err := bindArguments(call, fn, args, named)
+	if err != nil {
+		return err
+	}
+	defer e.exitCall()
+	if err := e.enterCall(); err != nil {
+		return err
+	}
+	tries := e.tries
+	e.tries = 0
+	defer func() { e.tries = tries }()
+	env := object.NewEnclosedEnvironment(fn.Env)
+	for i, param := range fn.Params {
+		val := vals[i]
+		if val == nil {
+			// defaults see the params before them
+			if val = e.Eval(param.Default, env); isError(val) {
+				return val
+			}
+		}
+		if ident, ok := param.Name(); ok && ident.Type != nil {
+			if err := checkAnnotation(ident.Type, val, "argument "+ident.Value); err != nil {
+				return err
+			}
+		}
+		if err := e.bindPattern(param.Pattern, val, env); err != nil {
+			return err
+		}
+	}
+	if fn.Generator {
+		return e.newGenerator(fn, env)
+	}
+	if ch, ok := e.hook.(CallHook); ok {
+		ch.EnterCall(call, fn, env)
+		defer ch.ExitCall(call)
+	}
+	return unwrapReturnValue(e.evalIn(fn.Block, env, true))
+}
+
+// tailCall is a call in tail position, made by applyFunction once the
+// function containing it has returned.
+type tailCall struct {
+	call  *ast.CallExpression
+	fn    object.Object
+	args  []object.Object
+	named []namedArg
+}
+
+func (t *tailCall) Type() object.ObjectType { return "TAIL_CALL" }
+func (t *tailCall) Inspect() string         { return "tail call" }
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	if obj == nil {
+		return NULL
+	}
+	return obj
+}
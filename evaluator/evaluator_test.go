@@ -1,8 +1,20 @@
 package evaluator
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jarviliam/inti/ast"
 	"github.com/jarviliam/inti/lexer"
 	"github.com/jarviliam/inti/object"
 	"github.com/jarviliam/inti/parser"
@@ -15,6 +27,10 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}{
 		{input: "5", expected: 5},
 		{input: "10", expected: 10},
+		{input: "-5", expected: -5},
+		{input: "5 + 5 + 5 + 5 - 10", expected: 10},
+		{input: "2 * (5 + 10)", expected: 30},
+		{input: "50 / 2 * 2 + 10", expected: 60},
 	}
 	for _, tC := range testCases {
 		evaluated := testEval(tC.input)
@@ -28,6 +44,10 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}{
 		{input: "true", expected: true},
 		{input: "false", expected: false},
+		{input: "1 < 2", expected: true},
+		{input: "1 == 2", expected: false},
+		{input: "(1 < 2) == true", expected: true},
+		{input: `"a" == "a"`, expected: true},
 	}
 	for _, tC := range testCases {
 		evaluated := testEval(tC.input)
@@ -49,11 +69,242 @@ func TestBangOp(t *testing.T) {
 	}
 }
 
+func TestIfElseExpressions(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp interface{}
+	}{
+		{"if (true) { 10 }", 10},
+		{"if (false) { 10 }", nil},
+		{"if (1 < 2) { 10 } else { 20 }", 10},
+		{"if (1 > 2) { 10 } else { 20 }", 20},
+	}
+	for _, tc := range tests {
+		evaluated := testEval(tc.in)
+		if integer, ok := tc.exp.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("object is not NULL. got=%T (%+v)", evaluated, evaluated)
+		}
+	}
+}
+
+func TestReturnStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp int64
+	}{
+		{"return 10; 9;", 10},
+		{"9; return 2 * 5; 9;", 10},
+		{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+	}
+	for _, tc := range tests {
+		testIntegerObject(t, testEval(tc.in), tc.exp)
+	}
+}
+
+func TestErrorHandling(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp string
+	}{
+		{"5 + true;", "type mismatch: INTEGER + BOOLEAN"},
+		{"-true", "unknown operator: -BOOLEAN"},
+		{"if (10 > 1) { true + false; }", "unknown operator: BOOLEAN + BOOLEAN"},
+		{"foobar", "identifier not found: foobar"},
+		{`"Hello" - "World"`, "unknown operator: STRING - STRING"},
+		{`{"name": "inti"}[fn(x) { x }];`, "unusable as hash key: FUNCTION"},
+		{"fn(x) { x }(1, 2)", "1:12: wrong number of arguments: want=1, got=2"},
+	}
+	for _, tc := range tests {
+		testErrorObject(t, testEval(tc.in), tc.exp)
+	}
+}
+
+func TestLetStatements(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp int64
+	}{
+		{"let a = 5; a;", 5},
+		{"let a = 5 * 5; a;", 25},
+		{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+	}
+	for _, tc := range tests {
+		testIntegerObject(t, testEval(tc.in), tc.exp)
+	}
+}
+
+func TestFunctionApplication(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp int64
+	}{
+		{"let identity = fn(x) { x; }; identity(5);", 5},
+		{"let double = fn(x) { return x * 2; }; double(5);", 10},
+		{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+		{"fn(x) { x; }(5)", 5},
+		{"let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(2);", 4},
+	}
+	for _, tc := range tests {
+		testIntegerObject(t, testEval(tc.in), tc.exp)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	evaluated := testEval(`"Hello" + " " + "World!"`)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len([1, 2, 3])`, 3},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`first([1, 2, 3])`, 1},
+		{`last([1, 2, 3])`, 3},
+		{`len(rest([1, 2, 3]))`, 2},
+		{`last(push([1], 2))`, 2},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+	}
+	for _, tc := range tests {
+		evaluated := testEval(tc.in)
+		switch exp := tc.exp.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(exp))
+		case string:
+			testErrorObject(t, evaluated, exp)
+		}
+	}
+}
+
+func TestArrayAndHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][3]", nil},
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+	}
+	for _, tc := range tests {
+		evaluated := testEval(tc.in)
+		if integer, ok := tc.exp.(int); ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else if evaluated != NULL {
+			t.Errorf("%q: object is not NULL. got=%T (%+v)", tc.in, evaluated, evaluated)
+		}
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		in  string
+		exp interface{}
+	}{
+		{"let x: int = 5; x", 5},
+		{`let x: int = "five";`, "let x: expected INTEGER, got STRING"},
+		{"let add = fn(a: int, b: int) -> int { a + b }; add(1, 2)", 3},
+		{`let add = fn(a: int, b: int) { a + b }; add(1, "2")`, "argument b: expected INTEGER, got STRING"},
+		{"let f = fn(a) -> bool { a }; f(1)", "return value: expected BOOLEAN, got INTEGER"},
+		{"let f = fn(a) -> int { return a; }; f(1)", 1},
+		{"let apply = fn(f: fn, x) { f(x) }; apply(len, [1])", 1},
+		{"let apply = fn(f: fn, x) { f(x) }; apply(1, [1])", "argument f: expected FUNCTION, got INTEGER"},
+	}
+	for _, tc := range tests {
+		evaluated := testEval(tc.in)
+		switch exp := tc.exp.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(exp))
+		case string:
+			testErrorObject(t, evaluated, exp)
+		}
+	}
+}
+
+type recordingHook struct {
+	nodes []string
+	calls []string
+}
+
+func (h *recordingHook) Before(node ast.Node, env *object.Environment) error {
+	if _, ok := node.(ast.Statement); ok {
+		h.nodes = append(h.nodes, node.String())
+	}
+	if ident, ok := node.(*ast.Identifier); ok && ident.Value == "stop" {
+		return errors.New("stopped by hook")
+	}
+	return nil
+}
+
+func (h *recordingHook) EnterCall(call *ast.CallExpression, fn *object.Function, env *object.Environment) {
+	x, _ := env.Get("x")
+	h.calls = append(h.calls, "enter "+call.Function.String()+" x="+x.Inspect())
+}
+
+func (h *recordingHook) ExitCall(call *ast.CallExpression) {
+	h.calls = append(h.calls, "exit "+call.Function.String())
+}
+
+func TestHook(t *testing.T) {
+	h := &recordingHook{}
+	program := parser.New(lexer.New("let f = fn(x) { x * 2 }; f(3);")).ParseProgram()
+	out := New(WithHook(h)).Eval(program, object.NewEnvironment())
+	testIntegerObject(t, out, 6)
+
+	expectedNodes := []string{"let f = fn(x)(x * 2);", "f(3)", "(x * 2)"}
+	if strings.Join(h.nodes, "|") != strings.Join(expectedNodes, "|") {
+		t.Errorf("wrong statements seen. want=%q, got=%q", expectedNodes, h.nodes)
+	}
+	expectedCalls := []string{"enter f x=3", "exit f"}
+	if strings.Join(h.calls, "|") != strings.Join(expectedCalls, "|") {
+		t.Errorf("wrong calls seen. want=%q, got=%q", expectedCalls, h.calls)
+	}
+
+	program = parser.New(lexer.New("1 + stop")).ParseProgram()
+	out = New(WithHook(h)).Eval(program, object.NewEnvironment())
+	testErrorObject(t, out, "stopped by hook")
+}
+
+func TestPutsWritesToOutput(t *testing.T) {
+	var out bytes.Buffer
+	program := parser.New(lexer.New(`puts("hello", 1)`)).ParseProgram()
+	New(WithOutput(&out)).Eval(program, object.NewEnvironment())
+	if out.String() != "hello\n1\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+}
+
+func TestArgs(t *testing.T) {
+	program := parser.New(lexer.New(`let a = args(); len(a) + len(a[1])`)).ParseProgram()
+	result := New(WithArgs([]string{"x", "yz"})).Eval(program, object.NewEnvironment())
+	testIntegerObject(t, result, 4)
+
+	program = parser.New(lexer.New(`len(args())`)).ParseProgram()
+	testIntegerObject(t, New().Eval(program, object.NewEnvironment()), 0)
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
-	return Eval(program)
+	env := object.NewEnvironment()
+	return Eval(program, env)
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expectd int64) bool {
@@ -80,3 +331,848 @@ func testBooleanObject(t *testing.T, obj object.Object, expectd bool) bool {
 	}
 	return true
 }
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("no error object returned. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestImports(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib")
+	files := map[string]string{
+		"main.inti":        `let m = import "./util"; let n = import "util"; m.double(n.base)`,
+		"util.inti":        `puts("loading util"); export let base = 21; let twice = fn(x) { x * 2 }; export let double = fn(x) { twice(x) };`,
+		"lib/strings.inti": `export let greet = fn(name) { "hi " + name };`,
+		"lib/lazy.inti":    `export let load = fn() { let s = import "./strings"; s.greet("lazy") };`,
+		"deferred.inti":    `let l = import "lazy"; l.load()`,
+		"tasks.inti":       `let a = spawn fn() { import "./util" }(); let b = spawn fn() { import "./util" }(); await(a).base + await(b).base`,
+		"selective.inti":   `import { double, base as b } from "./util"; double(b) + 1`,
+		"private.inti":     `import { base, twice } from "./util"`,
+		"absent.inti":      "let m = import \"./util\";\nimport { nope } from \"./util\"",
+		"privmember.inti":  `let m = import "./util"; m.twice(1)`,
+		"search.inti":      `let s = import "strings"; s.greet("bob")`,
+		"cycle_a.inti":     `import "./cycle_b"`,
+		"cycle_b.inti":     `import "./cycle_c"`,
+		"cycle_c.inti":     `import "./cycle_a"`,
+		"bad.inti":         `let x = ;`,
+		"missing.inti":     `let m = import "./util"; m.triple`,
+		"notfound.inti":    `import "./nope"`,
+		"member.inti":      `let x = 1; x.y`,
+		"hostop.inti":      `let m = import "./useop"; m.combine(1, 2)`,
+		"useop.inti":       `export let combine = fn(a, b) { a ?? b + 1 };`,
+	}
+	os.Mkdir(lib, 0755)
+	for name, src := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file     string
+		expected interface{}
+	}{
+		{"main.inti", 42},
+		{"search.inti", "hi bob"},
+		{"deferred.inti", "hi lazy"},
+		{"tasks.inti", 42},
+		{"cycle_a.inti", "import cycle: " + strings.Join([]string{
+			filepath.Join(dir, "cycle_a.inti"),
+			filepath.Join(dir, "cycle_b.inti"),
+			filepath.Join(dir, "cycle_c.inti"),
+			filepath.Join(dir, "cycle_a.inti"),
+		}, " -> ")},
+		{"selective.inti", 43},
+		{"private.inti", `1:16: twice is not exported by module "./util"`},
+		{"absent.inti", `2:10: module "./util" has no member nope`},
+		{"privmember.inti", `1:28: twice is not exported by module "./util"`},
+		{"missing.inti", `1:28: module "./util" has no member triple`},
+		{"notfound.inti", `import "./nope": no file ` + filepath.Join(dir, "nope.inti")},
+		{"member.inti", "member access not supported: INTEGER"},
+		// imported files parse the operators the importer does
+		{"hostop.inti", 13},
+	}
+
+	hook := WithOperator("??", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value*10 + args[1].(*object.Integer).Value}
+	})
+	for _, tt := range tests {
+		var out bytes.Buffer
+		path := filepath.Join(dir, tt.file)
+		src, _ := ioutil.ReadFile(path)
+		ops := parser.NewOperators()
+		ops.Infix("??", 5, parser.AssocLeft)
+		program := parser.New(lexer.New(string(src)), parser.WithOperators(ops)).ParseProgram()
+		ev := New(WithFile(path), WithSearchPath([]string{lib}), WithOutput(&out), WithOperatorTable(ops), hook)
+		result := ev.Eval(program, object.NewEnvironment())
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case string:
+			if str, ok := result.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("%s: wrong value. want=%q, got=%q", tt.file, expected, str.Value)
+				}
+				continue
+			}
+			testErrorObject(t, result, expected)
+		}
+		if (tt.file == "main.inti" || tt.file == "selective.inti" || tt.file == "tasks.inti") && out.String() != "loading util\n" {
+			t.Errorf("util was not loaded exactly once. output=%q", out.String())
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	loop := `let f = fn(n) { f(n + 1) }; f(0)`
+	tests := []struct {
+		input    string
+		limits   Limits
+		expected error
+	}{
+		{loop, Limits{Steps: 1000}, ErrStepLimit},
+		{`let f = fn(n) { 1 + f(n + 1) }; f(0)`, Limits{CallDepth: 50}, ErrCallDepthLimit},
+		{`let f = fn(xs) { f(push(xs, 1)) }; f([])`, Limits{Allocations: 1000}, ErrAllocationLimit},
+		{`let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(50)`, Limits{CallDepth: 51}, nil},
+		// call depth is limited by default, but calls in tail position
+		// don't count towards it
+		{`let f = fn(n) { 1 + f(n + 1) }; f(0)`, Limits{}, ErrCallDepthLimit},
+		{`let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(5000)`, Limits{}, nil},
+		{`let f = fn(n) { if (n > 0) { f(n - 1) } else { 0 } }; f(100000)`, Limits{}, nil},
+		{`let f = fn(n) { if (n > 0) { 1 + f(n - 1) } else { 0 } }; f(20000)`, Limits{CallDepth: -1}, nil},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		ev := New(WithLimits(tt.limits))
+		result := ev.EvalContext(context.Background(), program, object.NewEnvironment())
+		errObj, ok := result.(*object.Error)
+		if tt.expected == nil {
+			if ok {
+				t.Errorf("%+v: unexpected error %s", tt.limits, errObj.Message)
+			}
+			continue
+		}
+		if !ok || errObj.Cause != tt.expected {
+			t.Errorf("%+v: expected %v, got %s", tt.limits, tt.expected, result.Inspect())
+		}
+	}
+}
+
+func TestEvalContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	program := parser.New(lexer.New(`let f = fn(n) { if (n > 0) { f(n - 1) } else { f(n + 1) } }; f(0)`)).ParseProgram()
+	result := New().EvalContext(ctx, program, object.NewEnvironment())
+	if errObj, ok := result.(*object.Error); !ok || errObj.Cause != context.DeadlineExceeded {
+		t.Errorf("expected evaluation to time out, got %s", result.Inspect())
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.txt")
+	os.Setenv("INTI_TEST_VAR", "set")
+	defer os.Unsetenv("INTI_TEST_VAR")
+
+	tests := []struct {
+		input    string
+		caps     Capability
+		expected interface{}
+	}{
+		{`len("abc")`, CapPure, 3},
+		{`puts(1)`, CapPure, "capability denied: puts needs io"},
+		{`let p = read_file; 1`, CapIO, "capability denied: read_file needs fs"},
+		{`http_get("http://localhost")`, CapAll &^ CapNet, "capability denied: http_get needs net"},
+		{`env("INTI_TEST_VAR")`, CapEnv, "set"},
+		{`write_file("` + path + `", "hi"); read_file("` + path + `")`, CapFS, "hi"},
+		{`let puts = fn(x) { x }; puts(2)`, CapPure, 2},
+	}
+
+	for _, tt := range tests {
+		ev := New(WithCapabilities(tt.caps), WithOutput(ioutil.Discard))
+		result := ev.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, result, int64(expected))
+		case string:
+			if str, ok := result.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("%s: wrong value. want=%q, got=%q", tt.input, expected, str.Value)
+				}
+				continue
+			}
+			testErrorObject(t, result, expected)
+		}
+	}
+}
+
+func TestAudit(t *testing.T) {
+	var audit []string
+	ev := New(WithOutput(ioutil.Discard), WithAudit(func(a AuditEvent) {
+		var args []string
+		for _, arg := range a.Args {
+			args = append(args, arg.Inspect())
+		}
+		audit = append(audit, fmt.Sprintf("%s(%s) %s", a.Builtin, strings.Join(args, ", "), a.Capability))
+	}))
+	ev.Eval(parser.New(lexer.New(`puts(len([1]), "a"); env("NOPE"); len(args())`)).ParseProgram(), object.NewEnvironment())
+
+	expected := []string{"puts(1, a) io", "env(NOPE) env"}
+	if strings.Join(audit, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong audit log.\nwant=%q\ngot=%q", expected, audit)
+	}
+}
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Capability
+	}{
+		{"pure", CapPure},
+		{"io, fs", CapIO | CapFS},
+		{"all", CapAll},
+		{"time,net,env", CapTime | CapNet | CapEnv},
+	}
+	for _, tt := range tests {
+		c, err := ParseCapabilities(tt.input)
+		if err != nil || c != tt.expected {
+			t.Errorf("ParseCapabilities(%q) = %s, %v. want %s", tt.input, c, err, tt.expected)
+		}
+	}
+	if _, err := ParseCapabilities("disk"); err == nil {
+		t.Errorf("expected an error for an unknown capability")
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	input := `let t = now(); sleep(1500);
+puts([random(100), random(100), random(100)], now() - t, t, {"b": 2, 1: "x", true: 0, "a": 1});
+puts(args());
+env("HOME")`
+	run := func() (string, object.Object) {
+		var out bytes.Buffer
+		ev := New(WithDeterministic(42), WithOutput(&out), WithArgs([]string{"a"}))
+		result := ev.Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+		return out.String(), result
+	}
+
+	first, result := run()
+	testErrorObject(t, result, "capability denied: env needs env")
+	second, _ := run()
+	if first != second {
+		t.Errorf("runs differ:\n%s\n%s", first, second)
+	}
+	lines := strings.Split(first, "\n")
+	if len(lines) < 5 || lines[1] != "1500" || lines[2] != "946684800000" || lines[3] != "{true: 0, 1: x, a: 1, b: 2}" || lines[4] != "[a]" {
+		t.Errorf("wrong output %q", first)
+	}
+}
+
+func TestDeterministicInput(t *testing.T) {
+	program := parser.New(lexer.New(`read_line()`)).ParseProgram()
+	ev := New(WithDeterministic(1), WithInput(strings.NewReader("live\n")))
+	testErrorObject(t, ev.Eval(program, object.NewEnvironment()),
+		"read_line is not available in deterministic mode without replayed input")
+
+	var log bytes.Buffer
+	New(WithRecord(&log), WithInput(strings.NewReader("recorded\n"))).Eval(program, object.NewEnvironment())
+	ev = New(WithDeterministic(1), WithReplay(&log), WithInput(strings.NewReader("live\n")))
+	if got := ev.Eval(program, object.NewEnvironment()); got.Inspect() != "recorded" {
+		t.Errorf("wrong replayed line. got=%s", got.Inspect())
+	}
+}
+
+func TestDeterministicConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = channel(1); let b = channel(1); send(a, 1); send(b, 2); select { receive(a) as x => x, receive(b) as y => y }`, 1},
+		{`let a = channel(1); let b = channel(1); send(b, 2); select { receive(a) as x => x, receive(b) as y => y }`, 2},
+		{`let a = channel(1); let b = channel(1); select { send(a, 1) => 1, send(b, 2) => 2 }`, 1},
+		{`let a = channel(); select { receive(a) => 1, _ => 2 }`, 2},
+		{`let f = fn() { 1 }; await(spawn f())`, "1:27: spawn is not available in deterministic mode"},
+	}
+
+	for _, tt := range tests {
+		program := parser.New(lexer.New(tt.input)).ParseProgram()
+		for i := 0; i < 30; i++ {
+			got := New(WithDeterministic(1)).Eval(program, object.NewEnvironment())
+			switch expected := tt.expected.(type) {
+			case int:
+				if !testIntegerObject(t, got, int64(expected)) {
+					t.Fatalf("%q: run %d differs", tt.input, i)
+				}
+			case string:
+				testErrorObject(t, got, expected)
+			}
+		}
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	input := `[env("INTI_REPLAY"), random(1000000), args()]`
+	program := parser.New(lexer.New(input)).ParseProgram()
+
+	os.Setenv("INTI_REPLAY", "recorded")
+	defer os.Unsetenv("INTI_REPLAY")
+	var log bytes.Buffer
+	recorded := New(WithRecord(&log), WithArgs([]string{"a"})).Eval(program, object.NewEnvironment())
+
+	os.Setenv("INTI_REPLAY", "changed")
+	replayed := New(WithReplay(bytes.NewReader(log.Bytes()))).Eval(program, object.NewEnvironment())
+	if recorded.Inspect() != replayed.Inspect() {
+		t.Errorf("replay differs. recorded=%s, replayed=%s", recorded.Inspect(), replayed.Inspect())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`now()`, "replay: call of now, but env was recorded"},
+		{`env("X"); random(2); args(); args()`, "replay: no result recorded for call of args"},
+	}
+	for _, tt := range tests {
+		ev := New(WithReplay(bytes.NewReader(log.Bytes())))
+		testErrorObject(t, ev.Eval(parser.New(lexer.New(tt.input)).ParseProgram(), object.NewEnvironment()), tt.expected)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// a stack that grew with each call would overflow this
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`let countdown = fn(n) { if (n == 0) { 0 } else { countdown(n - 1) } }; countdown(1000000)`, 0},
+		{`let sum = fn(n, acc) { if (n == 0) { return acc; } return sum(n - 1, acc + n); }; sum(100000, 0)`, 5000050000},
+		{`let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };
+if (even(100001)) { 1 } else { 2 }`, 2},
+		{`let f = fn(n) -> int { if (n > 0) { f(n - 1) } else { len("abc") } }; f(100000)`, 3},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(`let f = fn(n) -> int { if (n > 0) { f(n - 1) } else { "x" } }; f(10)`),
+		"return value: expected INTEGER, got STRING")
+}
+
+func TestExceptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`try { throw "boom" } catch (e) { e.message }`, "boom"},
+		{`try { throw "boom" } catch (e) { e.kind }`, "Error"},
+		{`try { 1 / 0 } catch (e) { e.kind + ": " + e.message }`, "RuntimeError: division by zero"},
+		{`try { throw {"kind": "NotFound", "message": "no x", "key": "x"} } catch (e) { e.kind + e.message + e.value["key"] }`, "NotFoundno xx"},
+		{`try { throw 5 } catch (e) { e.value }`, 5},
+		{`try { 1 } catch (e) { 2 }`, 1},
+		{`let f = fn(x) { 1 + g(x) }; let g = fn(x) { throw x };
+try { f("a") } catch (e) { e.trace[0] + "; " + e.trace[1] }`, "g at 1:21; f at 2:7"},
+		{`let e = try { try { throw "in" } catch (e) { throw e } } catch (e) { e }; e.message`, "in"},
+		{`let e = 5; try { throw "x" } catch (e) { 1 }; e`, 5},
+		{`try { throw "x" } catch (e) { let y = 1 }; y`, "identifier not found: y"},
+		{`let g = fn() { for (x in [1, 2, 3, 4]) { try { if (x == 2) { continue } if (x == 4) { break } } finally { yield x } } };
+let xs = collect(g()); xs[0] * 1000 + xs[1] * 100 + xs[2] * 10 + xs[3]`, 1234},
+		{`let f = fn() { try { return 1 } finally { return 2 } }; f()`, 2},
+		{`try { throw "a" } finally { 1 }; 2`, "a"},
+		{`let g = fn() { for (c in "abc") { yield c } }; let cs = collect(g()); cs[2] + cs[1] + cs[0]`, "cba"},
+		{`let g = fn() { for (k in {"b": 1, "a": 2}) { yield k } }; let ks = collect(g()); ks[0] + ks[1]`, "ab"},
+		{`let x = 5; for (x in [1, 2, 3]) {}; x`, 5},
+		{`for (x in [1]) { let y = x }; y`, "identifier not found: y"},
+		{`let g = fn() { for (x in [1, 2]) { yield fn() { x } } }; let fs = collect(g()); fs[0]() + fs[1]() * 10`, 21},
+		{`let f = fn(xs) { for (x in xs) { if (x > 1) { return x } } 0 }; f([1, 5, 7])`, 5},
+		{`let loop = fn(n) { try { if (n == 0) { throw "done" } loop(n - 1) } catch (e) { e.message } }; loop(5)`, "done"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			if str, ok := got.(*object.String); ok {
+				if str.Value != expected {
+					t.Errorf("%q: got %q, want %q", tt.input, str.Value, expected)
+				}
+			} else {
+				testErrorObject(t, got, expected)
+			}
+		}
+	}
+
+	testErrorObject(t, testEval(`for (x in 5) {}`), "1:11: cannot iterate over INTEGER")
+	testErrorObject(t, testEval(`try { throw "x" } catch (e) { e.line }`), "1:33: error has no member line")
+
+	var out bytes.Buffer
+	program := parser.New(lexer.New(`let f = fn() { try { return 1 } finally { puts("finally") } }; f()`)).ParseProgram()
+	testIntegerObject(t, New(WithOutput(&out)).Eval(program, object.NewEnvironment()), 1)
+	if out.String() != "finally\n" {
+		t.Errorf("finally did not run on return, output %q", out.String())
+	}
+
+	// limits cannot be caught
+	ev := New(WithLimits(Limits{Steps: 100}))
+	program = parser.New(lexer.New(`let spin = fn() { spin() }; try { spin() } catch (e) { 1 } finally { 2 }`)).ParseProgram()
+	result := ev.EvalContext(context.Background(), program, object.NewEnvironment())
+	if err, ok := result.(*object.Error); !ok || !errors.Is(err.Cause, ErrStepLimit) {
+		t.Errorf("expected the step limit to escape try, got %v", result.Inspect())
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`match (2) { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match ("b") { "a" => 1, x => x + "!" }`, "b!"},
+		{`match (true) { false => 0, true => 1 }`, 1},
+		{`match (-3) { -3 => 1, _ => 2 }`, 1},
+		{`match ([1, 2, 3]) { [] => 0, [h, ...t] => h + len(t) }`, 3},
+		{`match ([1, 2]) { [a] => a, [a, b] => a + b, _ => 0 }`, 3},
+		{`match ([1]) { [a, b, ...r] => 1, [...r] => len(r) }`, 1},
+		{`match ({"name": "x", "age": 3}) { {"age": a, "name": "y"} => 0, {"age": a} => a }`, 3},
+		{`match ({"p": [1, {"q": 5}]}) { {"p": [_, {"q": q}]} => q }`, 5},
+		{`match (7) { n if n > 10 => "big", n if n > 5 => "medium", _ => "small" }`, "medium"},
+		{`let sum = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + sum(t) } }; sum([1, 2, 3, 4])`, 10},
+		{`let x = 1; match (2) { x => x }; x`, 1},
+		{`match ("1") { 1 => "int", _ => "other" }`, "other"},
+		{`try { match (3) { 1 => 1 } } catch (e) { e.kind + ": " + e.message }`, "MatchError: 1:7: no match arm matched 3"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			if str, ok := got.(*object.String); !ok || str.Value != expected {
+				t.Errorf("%q: got %s, want %q", tt.input, got.Inspect(), expected)
+			}
+		}
+	}
+
+	// arms in tail position are tail calls
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	testIntegerObject(t, testEval(`let count = fn(n) { match (n) { 0 => 0, _ => count(n - 1) } }; count(100000)`), 0)
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let [a, b, ...rest] = [1, 2, 3, 4]; a + b + len(rest)`, 5},
+		{`let [a, ...rest] = [1]; len(rest)`, 0},
+		{`let [_, [x, y]] = [1, [2, 3]]; x * y`, 6},
+		{`let {name, age: years} = {"name": "ann", "age": 30}; years`, 30},
+		{`let {"k": [v], 1: w} = {"k": [5], 1: 2}; v + w`, 7},
+		{`let dist = fn([x, y], {scale}) { (x + y) * scale }; dist([1, 2], {"scale": 10})`, 30},
+		{`let first = fn([h, ..._]) { h }; first([9, 8])`, 9},
+		{`let [a, b] = [1, 2, 3];`, "1:5: expected 2 elements, got 3"},
+		{`let [a, b, ...c] = [1];`, "1:5: expected at least 2 elements, got 1"},
+		{`let [a] = 1;`, "1:5: cannot destructure INTEGER as an array"},
+		{`let {a} = [1];`, "1:5: cannot destructure ARRAY as a hash"},
+		{`let {name} = {"nom": 1};`, `1:6: hash has no key "name"`},
+		{`let {1: a} = {};`, `1:6: hash has no key 1`},
+		{`let f = fn([x, y]) { x }; f([1])`, "1:12: expected 2 elements, got 1"},
+		{`let [1, a] = [2, 3];`, "1:6: expected 1, got 2"},
+		// a let that fails part way through binds none of its names
+		{`let a = 1; try { let {x: a, y} = {"x": 2} } catch (e) {}; a`, 1},
+		{`let a = 1; try { let [a, b, [c]] = [2, 3, 4] } catch (e) {}; b`, "identifier not found: b"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let g = fn() { yield 1; yield 2; yield 3 }; let h = fn() { for (x in g()) { yield x * 10 } }; collect(h())`, []int64{10, 20, 30}},
+		{`let g = fn() { yield 1 }; let x = 5; for (x in g()) {}; x`, 5},
+		{`let g = fn(a) { yield a; yield a + 1 }; let it = g(5); next(it) * next(it)`, 30},
+		{`let g = fn() { yield 1 }; let it = g(); next(it); next(it)`, nil},
+		{`let nat = fn(n) { yield n; for (x in nat(n + 1)) { yield x } }; collect(take(nat(1), 4))`, []int64{1, 2, 3, 4}},
+		{`let nat = fn(n) { yield n; for (x in nat(n + 1)) { yield x } }; collect(take(filter(map(nat(0), fn(x) { x * x }), fn(x) { x > 10 }), 2))`, []int64{16, 25}},
+		{`let g = fn() { yield 1; return 5; yield 2 }; len(collect(g()))`, 1},
+		{`let g = fn() { yield 1; throw "boom" }; for (x in g()) {}`, "boom"},
+		{`let g = fn() { yield 1; throw "boom" }; try { collect(g()) } catch (e) { len(e.message) }`, 4},
+		{`let g = fn() { try { yield 1 } catch (e) { yield 2 } }; for (x in g()) { break }; 1`, 1},
+		{`map([1, 2], fn(x) { x * 2 })`, []int64{2, 4}},
+		{`filter([1, 2, 3], fn(x) { x > 1 })`, []int64{2, 3}},
+		{`take([1, 2, 3], 2)`, []int64{1, 2}},
+		{`let g = fn() -> iterator { yield 1 }; next(g())`, 1},
+		{`next([1])`, "argument to `next` must be ITERATOR, got ARRAY"},
+		{`map(1, fn(x) { x })`, "argument to `map` must be ARRAY or ITERATOR, got INTEGER"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		case []int64:
+			arr, ok := got.(*object.Array)
+			if !ok || len(arr.Elements) != len(expected) {
+				t.Errorf("%q: expected %v, got %s", tt.input, expected, got.Inspect())
+				continue
+			}
+			for i, el := range arr.Elements {
+				testIntegerObject(t, el, expected[i])
+			}
+		case nil:
+			if got != NULL {
+				t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, got, got)
+			}
+		}
+	}
+}
+
+func TestGeneratorCleanup(t *testing.T) {
+	var out bytes.Buffer
+	input := `let g = fn() { try { yield 1; yield 2 } finally { puts("closed") } };
+for (x in g()) { puts(x); break }
+for (x in take(g(), 2)) { puts(x) }`
+	New(WithOutput(&out)).Eval(parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if out.String() != "1\nclosed\n1\n2\nclosed\n" {
+		t.Errorf("wrong output. got=%q", out.String())
+	}
+
+	// stopped loops, as well as dropped iterators, release their goroutines
+	before := runtime.NumGoroutine()
+	for _, input := range []string{
+		`let g = fn() { yield 1; yield 2 }; for (x in g()) { break }`,
+		`let g = fn() { yield 1; yield 2 }; let f = fn() { for (x in g()) { return x } }; f()`,
+		`let g = fn() { yield 1; yield 2 }; collect(take(g(), 1))`,
+		`let g = fn() { yield 1; yield 2 }; for (x in g()) { throw "x" }`,
+		`let g = fn() { yield 1; yield 2 }; next(g())`,
+	} {
+		testEval(input)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine() - before; n > 0 {
+		t.Errorf("%d generator goroutines leaked", n)
+	}
+}
+
+func TestGeneratorsClosedWhenEvalContextReturns(t *testing.T) {
+	// iterators kept in globals stay reachable from their own bodies, so
+	// only closing them when the evaluation ends releases their goroutines
+	input := `let g = fn() { try { yield 1; yield 2 } finally { puts("closed") } };
+let it = g();
+next(it);`
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		var out bytes.Buffer
+		env := object.NewEnvironment()
+		ev := New(WithOutput(&out))
+		ev.EvalContext(context.Background(), parser.New(lexer.New(input)).ParseProgram(), env)
+		if out.String() != "closed\n" {
+			t.Fatalf("wrong output. got=%q", out.String())
+		}
+		// the closed iterator yields nothing more
+		it, _ := env.Get("it")
+		if got := ev.Apply(context.Background(), ev.builtins["next"], it); got != NULL {
+			t.Fatalf("closed iterator yielded %s", got.Inspect())
+		}
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine() - before; n > 0 {
+		t.Errorf("%d generator goroutines leaked", n)
+	}
+}
+
+func TestGeneratorReentry(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let g = fn() { yield next(it) }; let it = g(); next(it)`, "generator already running"},
+		{`let g = fn() { yield collect(it) }; let it = g(); next(it)`, "generator already running"},
+		{`let g = fn() { for (x in it) { yield x } }; let it = g(); next(it)`, "1:16: generator already running"},
+		{`let g = fn() { yield try { next(it) } catch (e) { e.message } }; let it = g(); next(it)`, "generator already running"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		if str, ok := got.(*object.String); ok {
+			if str.Value != tt.expected {
+				t.Errorf("%q: got %q, want %q", tt.input, str.Value, tt.expected)
+			}
+		} else {
+			testErrorObject(t, got, tt.expected)
+		}
+	}
+
+	// a task taking a turn the body waits on stops with the context
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	input := `let g = fn() { yield await(spawn fn() { next(it) }()) }; let it = g(); next(it)`
+	result := New().EvalContext(ctx, parser.New(lexer.New(input)).ParseProgram(), object.NewEnvironment())
+	if err, ok := result.(*object.Error); !ok || !errors.Is(err.Cause, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to stop the evaluation, got %s", result.Inspect())
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn(a, b = 2) { a * b }; f(3)`, 6},
+		{`let f = fn(a, b = 2) { a * b }; f(3, 4)`, 12},
+		{`let f = fn(a, b = a + 1) { b }; f(4)`, 5},
+		{`let f = fn(a, ...rest) { a + len(rest) }; f(1) + f(1, 2, 3)`, 4},
+		{`let f = fn(...xs) { xs }; len(f())`, 0},
+		{`let f = fn(a, b, c) { a * 100 + b * 10 + c }; f(...[1, 2], 3)`, 123},
+		{`let f = fn(a, b, c) { a * 100 + b * 10 + c }; f(1, ...[2, 3])`, 123},
+		{`let f = fn(a, b = 2, c = 3) { a * 100 + b * 10 + c }; f(1, c: 5)`, 125},
+		{`let f = fn(a, b) { a - b }; f(b: 1, a: 3)`, 2},
+		{`let f = fn(a, ...r) { len(r) }; f(...[1, 2, 3])`, 2},
+		{`let f = fn([x, y] = [1, 2]) { x + y }; f()`, 3},
+		{`len(...["abc"])`, 3},
+		{`let f = fn(a, b) { a }; f(1, 2, 3)`, "1:26: wrong number of arguments: want=2, got=3"},
+		{`let f = fn(a, b) { a }; f(1)`, "1:26: wrong number of arguments: want=2, got=1"},
+		{`let f = fn(a, b = 1) { a }; f(b: 2)`, "1:30: missing argument for parameter a"},
+		{`map([1], fn(a, b) { a })`, "wrong number of arguments: want=2, got=1"},
+		{`let f = fn(a) { a }; f(1, c: 2)`, "1:27: unknown parameter c"},
+		{`let f = fn(a, b) { a }; f(1, a: 2)`, "1:30: parameter a is given more than once"},
+		{`let f = fn(a, b) { a }; f(b: 1, b: 2)`, "1:33: parameter b is given more than once"},
+		{`let f = fn(...r) { r }; f(r: 1)`, "1:27: variadic parameter r cannot be named"},
+		{`let f = fn(a) { a }; f(...1)`, "1:24: cannot spread INTEGER"},
+		{`len(s: "a")`, "1:5: builtin functions take no named arguments"},
+		{`let f = fn(a: int = "x") { a }; f()`, "argument a: expected INTEGER, got STRING"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		}
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let t = spawn fn(a, b) { a * b }(6, 7); await(t)`, 42},
+		{`let c = channel(); spawn fn() { send(c, 1); send(c, 2); close(c) }(); let g = fn() { for (x in c) { yield x } }; let xs = collect(g()); xs[0] * 10 + xs[1]`, 12},
+		{`let c = channel(1); send(c, 1); close(c); let x = 5; for (x in c) {}; x`, 5},
+		{`let c = channel(1); send(c, 5); receive(c)`, 5},
+		{`let c = channel(); close(c); receive(c)`, nil},
+		{`let c = channel(); select { receive(c) as x => x, _ => 3 }`, 3},
+		{`let c = channel(1); send(c, 4); select { receive(c) as x => x * 2, _ => 3 }`, 8},
+		{`let c = channel(1); select { send(c, 9) => receive(c) }`, 9},
+		{`let c = channel(); close(c); select { receive(c) as x => x }`, nil},
+		{`let c = channel(); let d = channel(); spawn fn() { send(d, receive(c) + 1) }(); send(c, 1); receive(d)`, 2},
+		{`let g = fn() { for (x in [1, 2, 3, 4]) { yield x } }; let it = map(g(), fn(x) { x }); let a = spawn collect(it); let b = spawn collect(it); len(await(a)) + len(await(b))`, 4},
+		{`let t = spawn fn() { throw "boom" }(); await(t)`, "boom"},
+		{`let t = spawn fn() { throw "boom" }(); try { await(t) } catch (e) { len(e.message) }`, 4},
+		{`let c = channel(); close(c); close(c)`, "close of closed channel"},
+		{`let c = channel(); close(c); send(c, 1)`, "send on closed channel"},
+		{`let c = channel(); close(c); select { send(c, 1) => 1 }`, "send on closed channel"},
+		{`select { receive(1) => 1 }`, "1:18: cannot select on INTEGER"},
+		{`await(1)`, "argument to `await` must be TASK, got INTEGER"},
+		{`channel(-1)`, "argument to `channel` must be a non-negative INTEGER, got -1"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		case nil:
+			if got != NULL {
+				t.Errorf("%q: object is not NULL. got=%T (%+v)", tt.input, got, got)
+			}
+		}
+	}
+}
+
+func TestConcurrencyCancelled(t *testing.T) {
+	for _, input := range []string{
+		`receive(channel())`,
+		`send(channel(), 1)`,
+		`await(spawn fn() { receive(channel()) }())`,
+		`select { receive(channel()) => 1 }`,
+		`for (x in channel()) {}`,
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		program := parser.New(lexer.New(input)).ParseProgram()
+		result := New().EvalContext(ctx, program, object.NewEnvironment())
+		if errObj, ok := result.(*object.Error); !ok || errObj.Cause != context.DeadlineExceeded {
+			t.Errorf("%q: expected evaluation to time out, got %s", input, result.Inspect())
+		}
+		cancel()
+	}
+}
+
+func TestOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`infixl 6 <+> = fn(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 123},
+		{`infixr 6 <-> = fn(a, b) { a - b }; 10 <-> 4 <-> 3`, 9},
+		{`infixl 8 ** = fn(a, b) { if (b == 0) { 1 } else { a * a ** (b - 1) } }; 2 ** 3 * 2`, 16},
+		{`infixl 6 <+> = fn(a, b) { throw "boom" }; try { 1 <+> 2 } catch (e) { len(e.message) }`, 4},
+		{`infixl 6 <+> = 1; 1 <+> 2`, "not a function: INTEGER"},
+		{`infixl 6 <+> = fn(a, b) { a }; let f = fn() { let g = fn(x) { x <+> 2 }; g(5) }; f()`, 5},
+		{`infixl 5 ?? = fn(a, b) { a }; 1 ?? 2`, 1},
+	}
+	ops := parser.NewOperators()
+	ops.Infix("??", 5, parser.AssocLeft)
+	hook := WithOperator("??", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: 7}
+	})
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		got := New(hook).Eval(p.ParseProgram(), object.NewEnvironment())
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		}
+	}
+
+	// without a declaration, operators added to the parser use the hook
+	p := parser.New(lexer.New(`1 ?? 2 + 3`), parser.WithOperators(ops))
+	testIntegerObject(t, New(hook).Eval(p.ParseProgram(), object.NewEnvironment()), 7)
+	p = parser.New(lexer.New(`1 ?? 2`), parser.WithOperators(ops))
+	testErrorObject(t, New().Eval(p.ParseProgram(), object.NewEnvironment()), "unknown operator: INTEGER ?? INTEGER")
+
+	// errors raised by operators are traced to where they were applied
+	p = parser.New(lexer.New(`infixl 6 <+> = fn(a, b) { a + true }; 1 <+> 2`))
+	errObj, ok := New().Eval(p.ParseProgram(), object.NewEnvironment()).(*object.Error)
+	if !ok || strings.Join(errObj.Trace, "\n") != "<+> at 1:41" {
+		t.Errorf("wrong trace. got=%+v", errObj)
+	}
+}
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(foobar + barfoo)`, `(foobar + barfoo)`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`let x = 8; quote(unquote(x) + unquote("a") + unquote(1 > 2))`, `((8 + "a") + false)`},
+		{`let q = quote(4 + 4); quote(unquote(q) * unquote([1, q]))`, `((4 + 4) * [1, (4 + 4)])`},
+	}
+	for _, tt := range tests {
+		quote, ok := testEval(tt.input).(*object.Quote)
+		if !ok {
+			t.Errorf("%q: expected a quote, got %T", tt.input, testEval(tt.input))
+			continue
+		}
+		if got := quote.Node.String(); got != tt.expected {
+			t.Errorf("%q: wrong quote. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(unquote(fn() { 1 }))`, "1:7: cannot unquote FUNCTION"},
+		{`quote(unquote(x))`, "identifier not found: x"},
+		{`unquote(1)`, "unquote outside of quote"},
+		{`let q = quote; q(1)`, "quote must be called by name"},
+		{`quote(1, 2)`, "wrong number of arguments. got=2, want=1"},
+	}
+	for _, tt := range errTests {
+		testErrorObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let unless = macro(cond, a, b) { quote(if (!(unquote(cond))) { unquote(a) } else { unquote(b) }) };
+		  unless(10 > 5, 1 / 0, 2)`, 2},
+		{`let twice = macro(x) { quote(unquote(x) + unquote(x)) };
+		  let four = macro(x) { quote(twice(twice(unquote(x)))) };
+		  four(3)`, 12},
+		// the let the macro introduces does not capture the caller's t
+		{`let add = macro(a, b) { quote(fn() { let t = unquote(a); t + unquote(b) }()) };
+		  let t = 100; add(1, t)`, 101},
+		{`let apply = macro(body) { quote(fn(x) { unquote(body) }(1)) };
+		  let x = 5; apply(x * 2)`, 10},
+		{`let square = macro(x) { quote(unquote(x) * unquote(x)) };
+		  let f = fn(n) { square(n + 1) }; f(2) + f(3)`, 25},
+		{`let m = macro() { let n = 3; quote(unquote(n) * 2) }; m()`, 6},
+		// only the names bound in the quote are renamed, not free references
+		// to bindings of the same name outside it
+		{`let x = 10; let m = macro(a) { quote([fn(x) { x }(unquote(a)), x]) }; let r = m(1); r[0] * 100 + r[1]`, 110},
+		{`let m = macro(a) { quote(fn() { let y = unquote(a); let f = fn(y) { y * 2 }; f(y) + y }()) }; let y = 1; m(y + 2)`, 9},
+		{`let m = macro(a) { quote(match (unquote(a)) { [x, y] => x + y, x => x }) }; let x = 5; m([x, 2]) + m(x)`, 12},
+		{`let m = macro(x) { 1 }; m(2)`, "1:25: macro m must return a quote, got INTEGER"},
+		{`let m = macro(x) { quote(x) }; m()`, "1:32: macro m takes 1 arguments, got 0"},
+		{`let m = macro() { quote(m()) }; m()`, "macro expansion deeper than 100"},
+		{`let f = fn() { macro(x) { x } }; f()`, "1:16: macros can only be bound by top-level lets"},
+	}
+	for _, tt := range tests {
+		got := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, got, int64(expected))
+		case string:
+			testErrorObject(t, got, expected)
+		}
+	}
+
+	// each expansion gets names of its own, and the program parsed is left
+	// as it was
+	input := `let add = macro(a) { quote(fn() { let t = unquote(a); t }()) }; add(1) + add(2)`
+	program := parser.New(lexer.New(input)).ParseProgram()
+	before := program.String()
+	expanded, err := New().ExpandMacros(program, object.NewEnvironment())
+	if err != nil {
+		t.Fatal(err.Message)
+	}
+	if got, want := expanded.String(), "(fn()let t_1 = 1;t_1() + fn()let t_2 = 2;t_2())"; got != want {
+		t.Errorf("wrong expansion. want=%q, got=%q", want, got)
+	}
+	if program.String() != before {
+		t.Errorf("program changed by expansion. got=%q", program.String())
+	}
+}
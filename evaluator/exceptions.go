@@ -0,0 +1,187 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// branch is a break or continue leaving the statements up to its loop.
+type branch struct {
+	tok string
+}
+
+func (b *branch) Type() object.ObjectType { return "BRANCH" }
+func (b *branch) Inspect() string         { return b.tok }
+
+var (
+	breakBranch    = &branch{tok: "break"}
+	continueBranch = &branch{tok: "continue"}
+)
+
+// thrown turns the value of a throw statement into the error raised. Caught
+// errors are raised again as they were; hashes may set the message and kind.
+func thrown(val object.Object) *object.Error {
+	switch val := val.(type) {
+	case *object.ErrorValue:
+		return val.Err
+	case *object.String:
+		return &object.Error{Message: val.Value, Kind: "Error"}
+	case *object.Hash:
+		err := &object.Error{Message: val.Inspect(), Kind: "Error", Value: val}
+		if msg, ok := hashString(val, "message"); ok {
+			err.Message = msg
+		}
+		if kind, ok := hashString(val, "kind"); ok {
+			err.Kind = kind
+		}
+		return err
+	}
+	return &object.Error{Message: val.Inspect(), Kind: "Error", Value: val}
+}
+
+func hashString(h *object.Hash, key string) (string, bool) {
+	pair, ok := h.Pairs[(&object.String{Value: key}).HashKey()]
+	if !ok {
+		return "", false
+	}
+	s, ok := pair.Value.(*object.String)
+	if !ok {
+		return "", false
+	}
+	return s.Value, true
+}
+
+// catchable reports whether obj is an error scripts may catch. Errors
+// stopping evaluation on behalf of the host are not.
+func catchable(obj object.Object) bool {
+	err, ok := obj.(*object.Error)
+	return ok && err.Cause == nil
+}
+
+// evalTryExpression evaluates a try. Calls in it are never tail calls, as
+// they must be made before it catches errors and runs finally.
+func (e *Evaluator) evalTryExpression(node *ast.TryExpression, env *object.Environment) object.Object {
+	e.tries++
+	result := e.Eval(node.Block, env)
+	if node.Catch != nil && catchable(result) {
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(node.Param.Value, &object.ErrorValue{Err: result.(*object.Error)})
+		result = e.Eval(node.Catch, scope)
+	}
+	e.tries--
+	if node.Finally == nil {
+		return result
+	}
+	// finally ends the try early only if it raises an error, returns or
+	// branches itself; otherwise the try ends as it would have
+	if fin := e.Eval(node.Finally, env); fin != nil {
+		switch fin.(type) {
+		case *object.Error, *object.ReturnValue, *branch:
+			return fin
+		}
+	}
+	return result
+}
+
+func (e *Evaluator) evalForStatement(node *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := e.Eval(node.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+	var elements []object.Object
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		elements = iterable.Elements
+	case *object.Hash:
+		for _, pair := range iterable.SortedPairs() {
+			elements = append(elements, pair.Key)
+		}
+	case *object.String:
+		for _, r := range iterable.Value {
+			elements = append(elements, &object.String{Value: string(r)})
+		}
+	case *object.Iterator:
+		return e.evalForIterator(node, iterable, env)
+	case *object.Channel:
+		return e.evalForChannel(node, iterable, env)
+	default:
+		return newError("%s: cannot iterate over %s", node.Iterable.Pos(), iterable.Type())
+	}
+	for _, el := range elements {
+		// each pass binds the variable in a scope of its own, so it does
+		// not outlive the loop and closures made in the body keep theirs
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(node.Var.Value, el)
+		result := e.Eval(node.Body, scope)
+		switch result := result.(type) {
+		case *object.Error, *object.ReturnValue:
+			return result
+		case *branch:
+			if result == breakBranch {
+				return NULL
+			}
+		}
+	}
+	return NULL
+}
+
+// evalForIterator runs a for loop over the values of it as they are
+// produced, closing it if the loop stops early.
+func (e *Evaluator) evalForIterator(node *ast.ForStatement, it *object.Iterator, env *object.Environment) object.Object {
+	if e.running(it) {
+		return newError("%s: generator already running", node.Pos())
+	}
+	defer closeIterator(it)
+	for {
+		el, ok := it.Next()
+		if !ok {
+			return NULL
+		}
+		if isError(el) {
+			return el
+		}
+		scope := object.NewEnclosedEnvironment(env)
+		scope.Set(node.Var.Value, el)
+		result := e.Eval(node.Body, scope)
+		switch result := result.(type) {
+		case *object.Error, *object.ReturnValue:
+			return result
+		case *branch:
+			if result == breakBranch {
+				return NULL
+			}
+		}
+	}
+}
+
+// errorMember returns a member of a caught error.
+func errorMember(ev *object.ErrorValue, name *ast.Identifier) object.Object {
+	switch name.Value {
+	case "message":
+		return &object.String{Value: ev.Err.Message}
+	case "kind":
+		return &object.String{Value: ev.Err.ErrorKind()}
+	case "trace":
+		trace := make([]object.Object, len(ev.Err.Trace))
+		for i, frame := range ev.Err.Trace {
+			trace[i] = &object.String{Value: frame}
+		}
+		return &object.Array{Elements: trace}
+	case "value":
+		if ev.Err.Value == nil {
+			return NULL
+		}
+		return ev.Err.Value
+	}
+	return newError("%s: error has no member %s", name.Pos(), name.Value)
+}
+
+// traceCall records in err that it unwound call.
+func traceCall(err *object.Error, call *ast.CallExpression) {
+	if call == nil || err.Cause != nil {
+		return
+	}
+	err.Trace = append(err.Trace, fmt.Sprintf("%s at %s", call.Function, call.Function.Pos()))
+}
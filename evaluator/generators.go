@@ -0,0 +1,258 @@
+package evaluator
+
+import (
+	"errors"
+	"reflect"
+	"runtime"
+	"sync"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// errGeneratorClosed is the Cause of the error unwinding the body of a
+// generator closed before it finished. Its finally blocks run, but it
+// cannot be caught.
+var errGeneratorClosed = errors.New("generator closed")
+
+// generator evaluates the body of a generator function on a goroutine of
+// its own. The body and its caller take turns, handing over through
+// channels, so only one of them evaluates at a time.
+type generator struct {
+	// e evaluates the body. It is a fork of the evaluator that called the
+	// generator function, so the body runs under the context and limits of
+	// that call.
+	e   *Evaluator
+	fn  *object.Function
+	env *object.Environment
+	// it is the address of the iterator over the values the body yields.
+	// It is not a pointer, since the body's goroutine keeps g reachable and
+	// the iterator would then never be garbage collected.
+	it uintptr
+
+	// resume carries true to run the body to its next yield, and false to
+	// close it.
+	resume chan bool
+	// values carries the values yielded, then any error the body ends in.
+	// It is closed once the body has ended.
+	values chan object.Object
+	// abandoned is closed if the body is left suspended where it cannot be
+	// closed: when the iterator is garbage collected, or is in use by a
+	// task when the call that started it returns. Its goroutine then exits
+	// without evaluating anything more, so its finally blocks do not run.
+	abandoned chan struct{}
+	abandon   sync.Once
+	// live is the set g belongs to until it is done.
+	live *generators
+
+	// turns makes tasks sharing the iterator take turns. It holds a value
+	// while one has the iterator.
+	turns         chan struct{}
+	started, done bool
+	// stopped is set on the body's goroutine once it has been closed.
+	stopped bool
+}
+
+// newGenerator returns an iterator over the values yielded by the body of
+// fn, evaluated in env. The body starts on the first call of Next.
+func (e *Evaluator) newGenerator(fn *object.Function, env *object.Environment) *object.Iterator {
+	g := &generator{
+		fn:        fn,
+		env:       env,
+		resume:    make(chan bool, 1),
+		values:    make(chan object.Object),
+		abandoned: make(chan struct{}),
+		live:      e.generators,
+		turns:     make(chan struct{}, 1),
+	}
+	g.e = e.fork()
+	g.e.gen = g
+	g.live.add(g)
+	it := &object.Iterator{Next: g.next, Close: g.close}
+	g.it = reflect.ValueOf(it).Pointer()
+	// generators started by Eval belong to no set, so they are left to the
+	// garbage collector
+	runtime.SetFinalizer(it, func(*object.Iterator) { g.abandonBody() })
+	return it
+}
+
+func (g *generator) next() (object.Object, bool) {
+	select {
+	case g.turns <- struct{}{}:
+	case <-g.e.ctx.Done():
+		return causeError(g.e.ctx.Err()), true
+	}
+	defer func() { <-g.turns }()
+	if g.done {
+		return nil, false
+	}
+	val, ok := g.turn(true)
+	if !ok || isError(val) {
+		g.finish()
+	}
+	return val, ok
+}
+
+// close unwinds a suspended body, waiting for it to end. Values it yields
+// or errors it raises meanwhile are dropped. If the context is done first,
+// the body is abandoned instead.
+func (g *generator) close() {
+	select {
+	case g.turns <- struct{}{}:
+	case <-g.e.ctx.Done():
+		g.abandonBody()
+		return
+	}
+	defer func() { <-g.turns }()
+	g.closeBody()
+}
+
+// running reports whether it is the iterator of the generator whose body e
+// is evaluating. The body can neither take values from its own iterator nor
+// close it, as it would wait for itself to yield.
+func (e *Evaluator) running(it *object.Iterator) bool {
+	return e.gen != nil && e.gen.it == reflect.ValueOf(it).Pointer()
+}
+
+func (g *generator) closeBody() {
+	if g.done {
+		return
+	}
+	g.finish()
+	if !g.started {
+		return
+	}
+	for _, ok := g.turn(false); ok; _, ok = <-g.values {
+	}
+}
+
+// shutdown closes g unless a task has it, in which case its body is
+// abandoned rather than waiting for the task.
+func (g *generator) shutdown() {
+	select {
+	case g.turns <- struct{}{}:
+		g.closeBody()
+		<-g.turns
+	default:
+		g.abandonBody()
+	}
+}
+
+func (g *generator) abandonBody() {
+	g.abandon.Do(func() { close(g.abandoned) })
+}
+
+func (g *generator) finish() {
+	g.done = true
+	g.live.remove(g)
+}
+
+// generators is the set of generators started by one EvalContext or Apply
+// call that are not yet done, which are closed when it returns. Iterators
+// kept in globals would otherwise leave their bodies suspended for good.
+type generators struct {
+	mu   sync.Mutex
+	live map[*generator]bool
+}
+
+func newGenerators() *generators {
+	return &generators{live: make(map[*generator]bool)}
+}
+
+func (s *generators) add(g *generator) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.live[g] = true
+}
+
+func (s *generators) remove(g *generator) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.live, g)
+}
+
+// closeAll closes the generators in s, including any started by the
+// finally blocks of those it closes.
+func (s *generators) closeAll() {
+	for {
+		var g *generator
+		s.mu.Lock()
+		for g = range s.live {
+			break
+		}
+		delete(s.live, g)
+		s.mu.Unlock()
+		if g == nil {
+			return
+		}
+		g.shutdown()
+	}
+}
+
+// turn hands over to the body, starting it if need be, and waits for it to
+// yield or end.
+func (g *generator) turn(resume bool) (object.Object, bool) {
+	if g.started {
+		g.resume <- resume
+	} else {
+		g.started = true
+		go g.run()
+	}
+	val, ok := <-g.values
+	return val, ok
+}
+
+func (g *generator) run() {
+	defer close(g.values)
+	result := unwrapReturnValue(g.e.evalIn(g.fn.Block, g.env, true))
+	if tc, ok := result.(*tailCall); ok {
+		result = g.e.applyFunction(tc.call, tc.fn, tc.args, tc.named)
+	}
+	if err, ok := result.(*object.Error); ok && err.Cause != errGeneratorClosed {
+		g.values <- err
+	}
+}
+
+// yield hands val to the caller and waits to be resumed, returning an error
+// to unwind the body if it is closed instead.
+func (g *generator) yield(val object.Object) *object.Error {
+	if !g.stopped {
+		g.values <- val
+		select {
+		case resume := <-g.resume:
+			g.stopped = !resume
+		case <-g.abandoned:
+			runtime.Goexit()
+		}
+	}
+	if g.stopped {
+		return &object.Error{Message: errGeneratorClosed.Error(), Cause: errGeneratorClosed}
+	}
+	return nil
+}
+
+func (e *Evaluator) evalYieldStatement(node *ast.YieldStatement, env *object.Environment) object.Object {
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	if e.gen == nil {
+		return newError("%s: yield outside of a generator", node.Pos())
+	}
+	if err := e.gen.yield(val); err != nil {
+		return err
+	}
+	return nil
+}
+
+func closeIterator(it *object.Iterator) {
+	if it.Close != nil {
+		it.Close()
+	}
+}
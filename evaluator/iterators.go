@@ -0,0 +1,189 @@
+package evaluator
+
+import (
+	"sync"
+
+	"github.com/jarviliam/inti/object"
+)
+
+// iteratorBuiltins returns the builtins consuming iterators. Those also
+// taking arrays return arrays for them; for iterators they return iterators
+// doing their work lazily, as values are wanted, on a fork of e as whichever
+// task wants them.
+func (e *Evaluator) iteratorBuiltins() map[string]object.BuiltinFunction {
+	return map[string]object.BuiltinFunction{
+		"next": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			it, ok := args[0].(*object.Iterator)
+			if !ok {
+				return newError("argument to `next` must be ITERATOR, got %s", args[0].Type())
+			}
+			if e.running(it) {
+				return newError("generator already running")
+			}
+			val, ok := it.Next()
+			if !ok {
+				return NULL
+			}
+			return val
+		},
+		"collect": func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.Array:
+				return arg
+			case *object.Iterator:
+				if e.running(arg) {
+					return newError("generator already running")
+				}
+				elements := []object.Object{}
+				for {
+					val, ok := arg.Next()
+					if !ok {
+						return &object.Array{Elements: elements}
+					}
+					if isError(val) {
+						return val
+					}
+					elements = append(elements, val)
+				}
+			}
+			return newError("argument to `collect` must be ARRAY or ITERATOR, got %s", args[0].Type())
+		},
+		"take": func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			n, ok := args[1].(*object.Integer)
+			if !ok {
+				return newError("second argument to `take` must be INTEGER, got %s", args[1].Type())
+			}
+			switch arg := args[0].(type) {
+			case *object.Array:
+				if n.Value < int64(len(arg.Elements)) {
+					return &object.Array{Elements: arg.Elements[:max(n.Value, 0)]}
+				}
+				return arg
+			case *object.Iterator:
+				return takeIterator(arg, n.Value)
+			}
+			return newError("argument to `take` must be ARRAY or ITERATOR, got %s", args[0].Type())
+		},
+		"map": func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			f := args[1]
+			switch arg := args[0].(type) {
+			case *object.Array:
+				elements := make([]object.Object, len(arg.Elements))
+				for i, el := range arg.Elements {
+					val := e.applyFunction(nil, f, []object.Object{el}, nil)
+					if isError(val) {
+						return val
+					}
+					elements[i] = val
+				}
+				return &object.Array{Elements: elements}
+			case *object.Iterator:
+				fe := e.fork()
+				return locked(&object.Iterator{
+					Next: func() (object.Object, bool) {
+						val, ok := arg.Next()
+						if !ok || isError(val) {
+							return val, ok
+						}
+						return fe.applyFunction(nil, f, []object.Object{val}, nil), true
+					},
+					Close: func() { closeIterator(arg) },
+				})
+			}
+			return newError("argument to `map` must be ARRAY or ITERATOR, got %s", args[0].Type())
+		},
+		"filter": func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			f := args[1]
+			switch arg := args[0].(type) {
+			case *object.Array:
+				elements := []object.Object{}
+				for _, el := range arg.Elements {
+					keep := e.applyFunction(nil, f, []object.Object{el}, nil)
+					if isError(keep) {
+						return keep
+					}
+					if isTruthy(keep) {
+						elements = append(elements, el)
+					}
+				}
+				return &object.Array{Elements: elements}
+			case *object.Iterator:
+				fe := e.fork()
+				return locked(&object.Iterator{
+					Next: func() (object.Object, bool) {
+						for {
+							val, ok := arg.Next()
+							if !ok || isError(val) {
+								return val, ok
+							}
+							keep := fe.applyFunction(nil, f, []object.Object{val}, nil)
+							if isError(keep) {
+								return keep, true
+							}
+							if isTruthy(keep) {
+								return val, true
+							}
+						}
+					},
+					Close: func() { closeIterator(arg) },
+				})
+			}
+			return newError("argument to `filter` must be ARRAY or ITERATOR, got %s", args[0].Type())
+		},
+	}
+}
+
+// takeIterator returns an iterator over the first n values of it, closing
+// it once they have been taken.
+func takeIterator(it *object.Iterator, n int64) *object.Iterator {
+	return locked(&object.Iterator{
+		Next: func() (object.Object, bool) {
+			if n <= 0 {
+				closeIterator(it)
+				return nil, false
+			}
+			n--
+			return it.Next()
+		},
+		Close: func() { closeIterator(it) },
+	})
+}
+
+// locked returns it made safe for tasks sharing it, which take turns.
+func locked(it *object.Iterator) *object.Iterator {
+	var mu sync.Mutex
+	return &object.Iterator{
+		Next: func() (object.Object, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			return it.Next()
+		},
+		Close: func() {
+			mu.Lock()
+			defer mu.Unlock()
+			closeIterator(it)
+		},
+	}
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,146 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// Errors set as the Cause of the error objects returned when a limit is
+// exceeded.
+var (
+	ErrStepLimit       = errors.New("step limit exceeded")
+	ErrCallDepthLimit  = errors.New("call depth limit exceeded")
+	ErrAllocationLimit = errors.New("allocation limit exceeded")
+)
+
+// Limits bounds the work a single EvalContext or Apply call may do. Zero
+// fields mean no limit, except CallDepth.
+type Limits struct {
+	// Steps is the number of statements and expressions evaluated.
+	Steps int
+	// CallDepth is the number of function calls in progress at once. Zero
+	// means DefaultCallDepth, and a negative depth means no limit, which
+	// lets deep recursion overflow the Go stack and crash the process.
+	CallDepth int
+	// Allocations is the number of objects created, counting each element
+	// of arrays and hashes.
+	Allocations int
+}
+
+// DefaultCallDepth is the call depth limit applied unless Limits sets
+// another. It is well below the depth at which the Go stack overflows.
+const DefaultCallDepth = 10000
+
+// budget counts the steps and allocations made towards the limits by one
+// EvalContext or Apply call, across the tasks and generators it starts.
+type budget struct {
+	steps, allocs int64
+}
+
+// contextCheckInterval is how many steps pass between checks of the
+// context, which are too slow to make at every step.
+const contextCheckInterval = 1024
+
+func WithLimits(l Limits) Option {
+	return func(e *Evaluator) { e.limits = l }
+}
+
+// EvalContext evaluates node in env like Eval, stopping with an error whose
+// Cause is ctx.Err() once ctx is done. Limits are counted afresh.
+// Generators it starts that are still suspended when it returns are closed,
+// so iterators it leaves behind yield nothing more.
+func (e *Evaluator) EvalContext(ctx context.Context, node ast.Node, env *object.Environment) object.Object {
+	return e.withContext(ctx, func() object.Object { return e.Eval(node, env) })
+}
+
+// Apply calls fn, a function or builtin, with args under ctx and the
+// evaluator's limits. Hosts use it to call back into scripts. Like
+// EvalContext, it closes the generators it starts when it returns.
+func (e *Evaluator) Apply(ctx context.Context, fn object.Object, args ...object.Object) object.Object {
+	return e.withContext(ctx, func() object.Object { return e.applyFunction(nil, fn, args, nil) })
+}
+
+func (e *Evaluator) withContext(ctx context.Context, f func() object.Object) object.Object {
+	if err := ctx.Err(); err != nil {
+		return causeError(err)
+	}
+	prev, prevGenerators := e.ctx, e.generators
+	e.ctx, e.budget, e.depth, e.generators = ctx, &budget{}, 0, newGenerators()
+	defer func() {
+		e.generators.closeAll()
+		e.ctx, e.generators = prev, prevGenerators
+	}()
+	return f()
+}
+
+// step counts a step, checking the step limit and, periodically, the
+// context.
+func (e *Evaluator) step() *object.Error {
+	steps := atomic.AddInt64(&e.budget.steps, 1)
+	if e.limits.Steps > 0 && steps > int64(e.limits.Steps) {
+		return limitError(ErrStepLimit, e.limits.Steps)
+	}
+	if steps%contextCheckInterval == 0 {
+		if err := e.ctx.Err(); err != nil {
+			return causeError(err)
+		}
+	}
+	return nil
+}
+
+// allocate counts the objects evaluating node created to produce result.
+func (e *Evaluator) allocate(node ast.Node, result object.Object) *object.Error {
+	if e.limits.Allocations == 0 {
+		return nil
+	}
+	switch node.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.PrefixExpression, *ast.InfixExpression,
+		*ast.FunctionLiteral, *ast.ArrayLiteral, *ast.HashLiteral, *ast.CallExpression:
+	default:
+		return nil
+	}
+	var n int64
+	switch result := result.(type) {
+	case *object.Integer, *object.String, *object.Function:
+		n = 1
+	case *object.Array:
+		n = 1 + int64(len(result.Elements))
+	case *object.Hash:
+		n = 1 + int64(len(result.Pairs))
+	}
+	if atomic.AddInt64(&e.budget.allocs, n) > int64(e.limits.Allocations) {
+		return limitError(ErrAllocationLimit, e.limits.Allocations)
+	}
+	return nil
+}
+
+// enterCall counts a call in progress. The caller must call exitCall when
+// it returns.
+func (e *Evaluator) enterCall() *object.Error {
+	e.depth++
+	limit := e.limits.CallDepth
+	if limit == 0 {
+		limit = DefaultCallDepth
+	}
+	if limit > 0 && e.depth > limit {
+		return limitError(ErrCallDepthLimit, limit)
+	}
+	return nil
+}
+
+func (e *Evaluator) exitCall() {
+	e.depth--
+}
+
+func limitError(err error, limit int) *object.Error {
+	return &object.Error{Message: fmt.Sprintf("%s (limit %d)", err, limit), Cause: err}
+}
+
+func causeError(err error) *object.Error {
+	return &object.Error{Message: err.Error(), Cause: err}
+}
@@ -0,0 +1,259 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/resolver"
+	"github.com/jarviliam/inti/token"
+)
+
+// maxExpansionDepth bounds how deeply macro expansions may expand to
+// further macro calls.
+const maxExpansionDepth = 100
+
+// evalQuote returns the argument of a call of quote unevaluated, with the
+// unquote calls in it replaced by their values. During macro expansion the
+// names it binds are renamed so as not to capture those of the code
+// spliced into it.
+func (e *Evaluator) evalQuote(call *ast.CallExpression, env *object.Environment) object.Object {
+	if len(call.Args) != 1 {
+		return newError("wrong number of arguments. got=%d, want=1", len(call.Args))
+	}
+	var err *object.Error
+	spliced := make(map[ast.Node]bool)
+	node := ast.Modify(call.Args[0], func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil || !isCallOf(call, "unquote") || len(call.Args) != 1 {
+			return node
+		}
+		val := e.Eval(call.Args[0], env)
+		if isError(val) {
+			err = val.(*object.Error)
+			return node
+		}
+		var n ast.Node
+		if n, err = unquoted(val, call.Function.Pos()); err != nil {
+			return node
+		}
+		spliced[n] = true
+		return n
+	})
+	if err != nil {
+		return err
+	}
+	if e.expanding {
+		e.rename(node, spliced)
+	}
+	return &object.Quote{Node: node}
+}
+
+func isCallOf(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// unquoted returns the code for val, placed at pos.
+func unquoted(val object.Object, pos token.Position) (ast.Expression, *object.Error) {
+	switch val := val.(type) {
+	case *object.Quote:
+		if exp, ok := val.Node.(ast.Expression); ok {
+			return exp, nil
+		}
+	case *object.Integer:
+		lit := strconv.FormatInt(val.Value, 10)
+		return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: lit, Pos: pos}, Value: val.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: val.Value, Pos: pos}, Value: val.Value}, nil
+	case *object.Boolean:
+		t := token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
+		if !val.Value {
+			t.Type, t.Literal = token.FALSE, "false"
+		}
+		return &ast.Boolean{Token: t, Value: val.Value}, nil
+	case *object.Array:
+		arr := &ast.ArrayLiteral{Token: token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}}
+		for _, el := range val.Elements {
+			exp, err := unquoted(el, pos)
+			if err != nil {
+				return nil, err
+			}
+			arr.Elements = append(arr.Elements, exp)
+		}
+		return arr, nil
+	}
+	return nil, newError("%s: cannot unquote %s", pos, val.Type())
+}
+
+// rename gives each name bound in node, outside the spliced nodes, a fresh
+// name no script can write, as identifiers hold no digits. Only the
+// identifiers the resolver finds referring to those bindings are renamed,
+// so free names keep referring to where the quote is spliced.
+func (e *Evaluator) rename(node ast.Node, spliced map[ast.Node]bool) {
+	expr, ok := node.(ast.Expression)
+	if !ok {
+		return
+	}
+	var idents []*ast.Identifier
+	own := make(map[*ast.Identifier]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if spliced[n] {
+			return false
+		}
+		if ident, ok := n.(*ast.Identifier); ok {
+			idents = append(idents, ident)
+			own[ident] = true
+		}
+		return true
+	})
+	program := &ast.Program{Statements: []ast.Statement{&ast.ExpressionStatement{Expression: expr}}}
+	res := resolver.Resolve(program)
+	fresh := make(map[*resolver.Definition]string)
+	for _, ident := range idents {
+		d, ok := res.DefinitionOf(ident)
+		if !ok || !own[d.Ident] {
+			continue
+		}
+		if _, ok := fresh[d]; !ok {
+			fresh[d] = fmt.Sprintf("%s_%d", d.Name, atomic.AddInt64(e.gensym, 1))
+		}
+	}
+	for _, ident := range idents {
+		if d, ok := res.DefinitionOf(ident); ok {
+			if name, ok := fresh[d]; ok {
+				ident.Value = name
+			}
+		}
+	}
+}
+
+// ExpandMacros defines the macros bound by the top-level lets of program
+// in env and returns program without those lets and with each call of a
+// macro in env replaced by its expansion.
+func (e *Evaluator) ExpandMacros(program *ast.Program, env *object.Environment) (*ast.Program, *object.Error) {
+	program = defineMacros(program, env)
+	if !callsMacro(program, env) {
+		return program, nil
+	}
+	node, err := e.expand(program, env, 0)
+	if err != nil {
+		return nil, err
+	}
+	return node.(*ast.Program), nil
+}
+
+func defineMacros(program *ast.Program, env *object.Environment) *ast.Program {
+	var stmts []ast.Statement
+	for i, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		var macro *ast.MacroLiteral
+		if ok {
+			macro, ok = let.Value.(*ast.MacroLiteral)
+		}
+		if !ok || let.Pattern != nil {
+			if stmts != nil {
+				stmts = append(stmts, stmt)
+			}
+			continue
+		}
+		if stmts == nil {
+			stmts = append([]ast.Statement{}, program.Statements[:i]...)
+		}
+		env.Set(let.Name.Value, &object.Macro{Params: macro.Params, Body: macro.Body, Env: env})
+	}
+	if stmts == nil {
+		return program
+	}
+	return &ast.Program{Statements: stmts}
+}
+
+func macroCalled(call *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	ident, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+	val, ok := env.Get(ident.Value)
+	if !ok {
+		return nil, false
+	}
+	macro, ok := val.(*object.Macro)
+	return macro, ok
+}
+
+func callsMacro(node ast.Node, env *object.Environment) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, ok := n.(*ast.CallExpression); ok {
+			if _, ok := macroCalled(call, env); ok {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// expand returns a copy of node with its macro calls expanded, as are the
+// macro calls in their expansions.
+func (e *Evaluator) expand(node ast.Node, env *object.Environment, depth int) (ast.Node, *object.Error) {
+	if depth > maxExpansionDepth {
+		return nil, newError("macro expansion deeper than %d", maxExpansionDepth)
+	}
+	var err *object.Error
+	expanded := ast.Modify(node, func(node ast.Node) ast.Node {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || err != nil {
+			return node
+		}
+		macro, ok := macroCalled(call, env)
+		if !ok {
+			return node
+		}
+		var exp ast.Node
+		if exp, err = e.expandCall(call, macro); err != nil {
+			return node
+		}
+		if callsMacro(exp, env) {
+			if exp, err = e.expand(exp, env, depth+1); err != nil {
+				return node
+			}
+		}
+		return exp
+	})
+	return expanded, err
+}
+
+func (e *Evaluator) expandCall(call *ast.CallExpression, macro *object.Macro) (ast.Node, *object.Error) {
+	name := call.Function.String()
+	if len(call.Args) != len(macro.Params) {
+		return nil, newError("%s: macro %s takes %d arguments, got %d", call.Function.Pos(), name, len(macro.Params), len(call.Args))
+	}
+	fn := &object.Function{Params: make([]*ast.Param, len(macro.Params)), Block: macro.Body, Env: macro.Env}
+	args := make([]object.Object, len(call.Args))
+	for i, param := range macro.Params {
+		fn.Params[i] = &ast.Param{Pattern: param}
+		args[i] = &object.Quote{Node: call.Args[i]}
+	}
+	expanding := e.expanding
+	e.expanding = true
+	result := e.applyFunction(call, fn, args, nil)
+	e.expanding = expanding
+	if err, ok := result.(*object.Error); ok {
+		return nil, err
+	}
+	quote, ok := result.(*object.Quote)
+	if !ok {
+		return nil, newError("%s: macro %s must return a quote, got %s", call.Function.Pos(), name, typeOf(result))
+	}
+	return quote.Node, nil
+}
+
+func typeOf(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return object.NULL_OBJ
+	}
+	return obj.Type()
+}
@@ -0,0 +1,243 @@
+package evaluator
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+)
+
+// WithFile names the file being evaluated. Relative imports resolve against
+// its directory, or against the working directory without it.
+func WithFile(path string) Option {
+	return func(e *Evaluator) { e.file = path }
+}
+
+// WithSearchPath sets the directories searched for imports that do not
+// start with ./ or ../. It defaults to the list in INTI_PATH.
+func WithSearchPath(dirs []string) Option {
+	return func(e *Evaluator) { e.searchPath = dirs }
+}
+
+// WithOperatorTable makes imported files parse the operators in ops, as
+// the importing script does, and add those they declare to it.
+func WithOperatorTable(ops *parser.Operators) Option {
+	return func(e *Evaluator) { e.ops = ops }
+}
+
+// moduleEntry is a module in the cache. Tasks importing a module another
+// task is evaluating wait for it rather than evaluating it again.
+type moduleEntry struct {
+	// done is closed once the module has been evaluated.
+	done chan struct{}
+	mod  *object.Module
+	err  object.Object
+}
+
+// evalImport evaluates the file named by an import in env the first time
+// it is imported, and returns its module.
+func (e *Evaluator) evalImport(name string, env *object.Environment) object.Object {
+	path, err := e.resolveImport(name, env)
+	if err != nil {
+		return newError("import %q: %s", name, err)
+	}
+
+	chain := e.loading
+	if e.file != "" {
+		if main, err := filepath.Abs(e.file); err == nil {
+			chain = append([]string{main}, chain...)
+		}
+	}
+	for i, loading := range chain {
+		if loading == path {
+			var cycle []string
+			for _, p := range chain[i:] {
+				cycle = append(cycle, displayPath(p))
+			}
+			cycle = append(cycle, displayPath(path))
+			return newError("import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	e.mu.Lock()
+	entry, ok := e.modules[path]
+	if !ok {
+		entry = &moduleEntry{done: make(chan struct{})}
+		e.modules[path] = entry
+	}
+	e.mu.Unlock()
+	if ok {
+		select {
+		case <-entry.done:
+		case <-e.ctx.Done():
+			return causeError(e.ctx.Err())
+		}
+		if entry.err != nil {
+			return entry.err
+		}
+		return entry.mod
+	}
+
+	entry.mod, entry.err = e.loadModule(name, path)
+	if entry.err != nil {
+		// failed imports are not cached, so a later import tries again
+		e.mu.Lock()
+		delete(e.modules, path)
+		e.mu.Unlock()
+	}
+	close(entry.done)
+	if entry.err != nil {
+		return entry.err
+	}
+	return entry.mod
+}
+
+// loadModule parses and evaluates the file at path.
+func (e *Evaluator) loadModule(name, path string) (*object.Module, object.Object) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, newError("import %q: %s", name, err)
+	}
+	var opts []parser.Option
+	if e.ops != nil {
+		opts = append(opts, parser.WithOperators(e.ops))
+	}
+	p := parser.New(lexer.New(string(src)), opts...)
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return nil, newError("import %q: %s:%s", name, displayPath(path), errs[0])
+	}
+
+	env := object.NewEnvironment()
+	e.mu.Lock()
+	e.moduleFiles[env] = path
+	e.mu.Unlock()
+	e.loading = append(e.loading, path)
+	result := e.Eval(program, env)
+	e.loading = e.loading[:len(e.loading)-1]
+	if isError(result) {
+		return nil, result
+	}
+	mod := &object.Module{Path: name, Env: env, Exports: make(map[string]bool)}
+	for _, stmt := range program.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok && let.Exported {
+			for _, name := range let.Names() {
+				mod.Exports[name.Value] = true
+			}
+		}
+	}
+	return mod, nil
+}
+
+// evalImportStatement binds the names an import statement lists in env.
+func (e *Evaluator) evalImportStatement(node *ast.ImportStatement, env *object.Environment) object.Object {
+	obj := e.evalImport(node.Path, env)
+	if isError(obj) {
+		return obj
+	}
+	mod := obj.(*object.Module)
+	for _, spec := range node.Specs {
+		val, err := member(mod, spec.Name)
+		if err != nil {
+			return err
+		}
+		env.Set(spec.Local().Value, val)
+	}
+	return nil
+}
+
+// resolveImport finds the file an import in env names and returns its
+// absolute path. Paths starting with ./ or ../ are relative to the importing
+// file; others are looked for next to it and then in each search path
+// directory.
+func (e *Evaluator) resolveImport(path string, env *object.Environment) (string, error) {
+	if filepath.Ext(path) == "" {
+		path += ".inti"
+	}
+	var candidates []string
+	switch {
+	case filepath.IsAbs(path):
+		candidates = []string{path}
+	case strings.HasPrefix(path, "./"), strings.HasPrefix(path, "../"):
+		candidates = []string{filepath.Join(e.importerDir(env), path)}
+	default:
+		candidates = []string{filepath.Join(e.importerDir(env), path)}
+		for _, dir := range e.searchPath {
+			candidates = append(candidates, filepath.Join(dir, path))
+		}
+	}
+
+	for _, c := range candidates {
+		if info, err := os.Stat(c); err == nil && !info.IsDir() {
+			return filepath.Abs(c)
+		}
+	}
+	tried := make([]string, len(candidates))
+	for i, c := range candidates {
+		tried[i] = displayPath(c)
+	}
+	return "", fmt.Errorf("no file %s", strings.Join(tried, " or "))
+}
+
+// importerDir returns the directory of the file whose code runs in env:
+// the module owning its global environment, or else the file being
+// evaluated.
+func (e *Evaluator) importerDir(env *object.Environment) string {
+	for env.Outer() != nil {
+		env = env.Outer()
+	}
+	e.mu.Lock()
+	file, ok := e.moduleFiles[env]
+	e.mu.Unlock()
+	if ok {
+		return filepath.Dir(file)
+	}
+	if e.file != "" {
+		return filepath.Dir(e.file)
+	}
+	return "."
+}
+
+// displayPath shortens path to be relative to the working directory when it
+// is inside it.
+func displayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+func evalMemberExpression(obj object.Object, name *ast.Identifier) object.Object {
+	mod, ok := obj.(*object.Module)
+	if !ok {
+		return newError("member access not supported: %s", obj.Type())
+	}
+	val, err := member(mod, name)
+	if err != nil {
+		return err
+	}
+	return val
+}
+
+// member looks up the exported binding name in mod, reporting a missing or
+// unexported name at its position.
+func member(mod *object.Module, name *ast.Identifier) (object.Object, *object.Error) {
+	if val, ok := mod.Member(name.Value); ok {
+		return val, nil
+	}
+	if _, bound := mod.Env.Get(name.Value); bound {
+		return nil, newError("%s: %s is not exported by module %q", name.Pos(), name.Value, mod.Path)
+	}
+	return nil, newError("%s: module %q has no member %s", name.Pos(), mod.Path, name.Value)
+}
@@ -0,0 +1,65 @@
+package evaluator
+
+import (
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// WithOperator implements the operator symbol, added to the language with
+// parser.Operators, by fn, which is passed its operands. Scripts declaring
+// the operator themselves override it.
+func WithOperator(symbol string, fn object.BuiltinFunction) Option {
+	return func(e *Evaluator) {
+		if e.operators == nil {
+			e.operators = make(map[string]object.BuiltinFunction)
+		}
+		e.operators[symbol] = fn
+	}
+}
+
+func builtinOperator(op string) bool {
+	switch op {
+	case "+", "-", "*", "/", "<", ">", "==", "!=", "!":
+		return true
+	}
+	return false
+}
+
+// evalOperator applies the operator op of node, added to the language, to
+// args, reporting false if op is built in or has no implementation. Scripts
+// implement operators by binding functions to their symbols.
+func (e *Evaluator) evalOperator(node ast.Expression, op string, args []object.Object, env *object.Environment) (object.Object, bool) {
+	if builtinOperator(op) {
+		return nil, false
+	}
+	if fn, ok := env.Get(op); ok {
+		return e.applyFunction(operatorCall(node, op), fn, args, nil), true
+	}
+	if fn, ok := e.operators[op]; ok {
+		return e.applyFunction(operatorCall(node, op), &object.Builtin{Fn: fn}, args, nil), true
+	}
+	return nil, false
+}
+
+// operatorCall returns the call of the function implementing the operator
+// of node, so that hooks and traces see it named by its symbol.
+func operatorCall(node ast.Expression, op string) *ast.CallExpression {
+	call := &ast.CallExpression{}
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		call.Token, call.Args = node.Token, []ast.Expression{node.Right}
+	case *ast.InfixExpression:
+		call.Token, call.Args = node.Token, []ast.Expression{node.Left, node.Right}
+	}
+	call.Function = &ast.Identifier{Token: call.Token, Value: op}
+	return call
+}
+
+func (e *Evaluator) evalOperatorDeclaration(node *ast.OperatorDeclaration, env *object.Environment) object.Object {
+	val := e.Eval(node.Value, env)
+	if isError(val) {
+		return val
+	}
+	env.Set(node.Operator, val)
+	return nil
+}
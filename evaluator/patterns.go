@@ -0,0 +1,130 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/object"
+)
+
+// evalMatchExpression evaluates the first arm matching the subject, in a
+// scope holding the names its pattern binds.
+func (e *Evaluator) evalMatchExpression(node *ast.MatchExpression, env *object.Environment, tail bool) object.Object {
+	subject := e.Eval(node.Subject, env)
+	if isError(subject) {
+		return subject
+	}
+	for _, arm := range node.Arms {
+		scope := object.NewEnclosedEnvironment(env)
+		if e.bindPattern(arm.Pattern, subject, scope) != nil {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := e.Eval(arm.Guard, scope)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		return e.evalIn(arm.Body, scope, tail)
+	}
+	return &object.Error{
+		Message: fmt.Sprintf("%s: no match arm matched %s", node.Pos(), subject.Inspect()),
+		Kind:    "MatchError",
+	}
+}
+
+// bindPattern binds the names in pat to the parts of val in env, or
+// reports where val does not match pat.
+func (e *Evaluator) bindPattern(pat ast.Pattern, val object.Object, env *object.Environment) *object.Error {
+	switch pat := pat.(type) {
+	case *ast.Identifier:
+		if pat.Value != "_" {
+			env.Set(pat.Value, val)
+		}
+	case *ast.LiteralPattern:
+		lit := e.Eval(pat.Value, env)
+		if !objectsEqual(lit, val) {
+			return newError("%s: expected %s, got %s", pat.Pos(), pat.Value, val.Inspect())
+		}
+	case *ast.ArrayPattern:
+		arr, ok := val.(*object.Array)
+		if !ok {
+			return newError("%s: cannot destructure %s as an array", pat.Pos(), val.Type())
+		}
+		switch n := len(pat.Elements); {
+		case pat.Rest == nil && len(arr.Elements) != n:
+			return newError("%s: expected %d elements, got %d", pat.Pos(), n, len(arr.Elements))
+		case len(arr.Elements) < n:
+			return newError("%s: expected at least %d elements, got %d", pat.Pos(), n, len(arr.Elements))
+		}
+		for i, el := range pat.Elements {
+			if err := e.bindPattern(el, arr.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pat.Rest != nil && pat.Rest.Value != "_" {
+			rest := make([]object.Object, len(arr.Elements)-len(pat.Elements))
+			copy(rest, arr.Elements[len(pat.Elements):])
+			env.Set(pat.Rest.Value, &object.Array{Elements: rest})
+		}
+	case *ast.HashPattern:
+		hash, ok := val.(*object.Hash)
+		if !ok {
+			return newError("%s: cannot destructure %s as a hash", pat.Pos(), val.Type())
+		}
+		for _, pair := range pat.Pairs {
+			var key object.Object
+			if name, ok := pair.Key.(*ast.Identifier); ok {
+				key = &object.String{Value: name.Value}
+			} else {
+				key = e.Eval(pair.Key, env)
+			}
+			found, ok := hash.Pairs[key.(object.Hashable).HashKey()]
+			if !ok {
+				if _, ok := key.(*object.String); ok {
+					return newError("%s: hash has no key %q", pair.Key.Pos(), key.Inspect())
+				}
+				return newError("%s: hash has no key %s", pair.Key.Pos(), key.Inspect())
+			}
+			if err := e.bindPattern(pair.Value, found.Value, env); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// destructure binds the names in pat to the parts of val in env only if
+// val matches pat as a whole, so that a let failing part way through binds
+// none of them.
+func (e *Evaluator) destructure(pat ast.Pattern, val object.Object, env *object.Environment) *object.Error {
+	scratch := object.NewEnclosedEnvironment(env)
+	if err := e.bindPattern(pat, val, scratch); err != nil {
+		return err
+	}
+	for _, name := range scratch.Names() {
+		bound, _ := scratch.Get(name)
+		env.Set(name, bound)
+	}
+	return nil
+}
+
+// objectsEqual reports whether a and b are equal integers, strings or
+// booleans.
+func objectsEqual(a, b object.Object) bool {
+	switch a := a.(type) {
+	case *object.Integer:
+		b, ok := b.(*object.Integer)
+		return ok && a.Value == b.Value
+	case *object.String:
+		b, ok := b.(*object.String)
+		return ok && a.Value == b.Value
+	case *object.Boolean:
+		b, ok := b.(*object.Boolean)
+		return ok && a.Value == b.Value
+	}
+	return false
+}
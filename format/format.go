@@ -0,0 +1,464 @@
+package format
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+)
+
+const indent = "\t"
+
+// Program returns the canonical source text of program, one statement per
+// line with blocks indented by tabs.
+func Program(program *ast.Program) string {
+	p := &printer{}
+	p.statements(program.Statements)
+	return p.out.String()
+}
+
+// Shebang returns the #! line src starts with, including its newline, or
+// "". The lexer skips it, so callers formatting a whole file put it back.
+func Shebang(src string) string {
+	if !strings.HasPrefix(src, "#!") {
+		return ""
+	}
+	if i := strings.IndexByte(src, '\n'); i >= 0 {
+		return src[:i+1]
+	}
+	return src + "\n"
+}
+
+// Node returns the canonical source text of a single node.
+func Node(node ast.Node) string {
+	p := &printer{}
+	switch node := node.(type) {
+	case *ast.Program:
+		p.statements(node.Statements)
+	case ast.Statement:
+		p.statement(node)
+	case ast.Expression:
+		p.expression(node, lowest)
+	}
+	return p.out.String()
+}
+
+type printer struct {
+	out   bytes.Buffer
+	depth int
+	// operators holds the operators declared so far.
+	operators map[string]*ast.OperatorDeclaration
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+func (p *printer) newline() {
+	p.out.WriteString("\n")
+	p.out.WriteString(strings.Repeat(indent, p.depth))
+}
+
+func (p *printer) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		if i > 0 {
+			p.newline()
+		}
+		p.statement(stmt)
+		if needsSemicolon(stmt, stmts[i+1:]) {
+			p.write(";")
+		}
+	}
+	if len(stmts) > 0 && p.depth == 0 {
+		p.write("\n")
+	}
+}
+
+// needsSemicolon reports whether stmt must be terminated for the statements
+// after it to parse back as separate statements. Loops never need one. if,
+// try, match and select expressions end in a brace and only need one when the next
+// statement could continue them.
+func needsSemicolon(stmt ast.Statement, rest []ast.Statement) bool {
+	if _, ok := stmt.(*ast.ForStatement); ok {
+		return false
+	}
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return true
+	}
+	switch es.Expression.(type) {
+	case *ast.IfExpression, *ast.TryExpression, *ast.MatchExpression, *ast.SelectExpression:
+	default:
+		return true
+	}
+	if len(rest) == 0 {
+		return false
+	}
+	switch rest[0].TokenLiteral() {
+	case "(", "[", "-":
+		return true
+	}
+	return false
+}
+
+func (p *printer) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt.Exported {
+			p.write("export ")
+		}
+		p.write("let ")
+		if stmt.Pattern != nil {
+			p.pattern(stmt.Pattern)
+		} else {
+			p.identifier(stmt.Name)
+		}
+		p.write(" = ")
+		p.expression(stmt.Value, lowest)
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue, lowest)
+		}
+	case *ast.ImportStatement:
+		p.write("import { ")
+		for i, spec := range stmt.Specs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(spec.Name.Value)
+			if spec.Alias != nil {
+				p.write(" as " + spec.Alias.Value)
+			}
+		}
+		p.write(" } from " + Quote(stmt.Path))
+	case *ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Value, lowest)
+	case *ast.YieldStatement:
+		p.write("yield ")
+		p.expression(stmt.Value, lowest)
+	case *ast.OperatorDeclaration:
+		if p.operators == nil {
+			p.operators = make(map[string]*ast.OperatorDeclaration)
+		}
+		p.operators[stmt.Operator] = stmt
+		p.write(stmt.Token.Literal + " " + strconv.Itoa(stmt.Precedence) + " " + stmt.Operator + " = ")
+		p.expression(stmt.Value, lowest)
+	case *ast.ForStatement:
+		p.write("for (" + stmt.Var.Value + " in ")
+		p.expression(stmt.Iterable, lowest)
+		p.write(") ")
+		p.block(stmt.Body)
+	case *ast.BranchStatement:
+		p.write(stmt.Token.Literal)
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, lowest)
+	}
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if len(b.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+	p.write("{")
+	p.depth++
+	p.newline()
+	p.statements(b.Statements)
+	p.depth--
+	p.newline()
+	p.write("}")
+}
+
+func (p *printer) pattern(pat ast.Pattern) {
+	switch pat := pat.(type) {
+	case *ast.Identifier:
+		p.identifier(pat)
+	case *ast.LiteralPattern:
+		p.expression(pat.Value, lowest)
+	case *ast.ArrayPattern:
+		p.write("[")
+		for i, el := range pat.Elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.pattern(el)
+		}
+		if pat.Rest != nil {
+			if len(pat.Elements) > 0 {
+				p.write(", ")
+			}
+			p.write("..." + pat.Rest.Value)
+		}
+		p.write("]")
+	case *ast.HashPattern:
+		p.write("{")
+		for i, pair := range pat.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			if k, ok := pair.Key.(*ast.Identifier); ok && ast.Pattern(k) == pair.Value {
+				p.write(k.Value)
+				continue
+			}
+			p.expression(pair.Key, lowest)
+			p.write(": ")
+			p.pattern(pair.Value)
+		}
+		p.write("}")
+	}
+}
+
+func (p *printer) identifier(i *ast.Identifier) {
+	p.write(i.Value)
+	if i.Type != nil {
+		p.write(": " + i.Type.Name)
+	}
+}
+
+// precedences are on the parser's scale, on which declared operators take
+// levels 0 to 9.
+const (
+	lowest      = -1
+	equals      = 4
+	lessGreater = 5
+	sum         = 6
+	product     = 7
+	prefix      = 10
+	call        = 11
+)
+
+var precedences = map[string]int{
+	"==": equals,
+	"!=": equals,
+	"<":  lessGreater,
+	">":  lessGreater,
+	"+":  sum,
+	"-":  sum,
+	"*":  product,
+	"/":  product,
+}
+
+// expression prints e, parenthesised when it binds looser than prec.
+func (p *printer) expression(e ast.Expression, prec int) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.identifier(e)
+	case *ast.IntegerLiteral:
+		p.write(e.Token.Literal)
+	case *ast.Boolean:
+		p.write(e.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(Quote(e.Value))
+	case *ast.PrefixExpression:
+		if prec > prefix {
+			p.write("(")
+		}
+		p.write(e.Operator)
+		p.expression(e.Right, prefix)
+		if prec > prefix {
+			p.write(")")
+		}
+	case *ast.InfixExpression:
+		own, ok := precedences[e.Operator]
+		// operators are left associative unless declared infixr, so an
+		// equal operand on the other side needs parens
+		left, right := own, own+1
+		if decl, declared := p.operators[e.Operator]; !ok && declared {
+			own = decl.Precedence
+			left, right = own, own+1
+			if decl.Token.Literal == "infixr" {
+				left, right = own+1, own
+			}
+		} else if !ok {
+			// the precedence of operators added by the host is unknown, so
+			// they and their operands are parenthesised
+			own, left, right = lowest, prefix, prefix
+		}
+		if own < prec {
+			p.write("(")
+		}
+		p.expression(e.Left, left)
+		p.write(" " + e.Operator + " ")
+		p.expression(e.Right, right)
+		if own < prec {
+			p.write(")")
+		}
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition, lowest)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+	case *ast.TryExpression:
+		p.write("try ")
+		p.block(e.Block)
+		if e.Catch != nil {
+			p.write(" catch (" + e.Param.Value + ") ")
+			p.block(e.Catch)
+		}
+		if e.Finally != nil {
+			p.write(" finally ")
+			p.block(e.Finally)
+		}
+	case *ast.MatchExpression:
+		p.write("match (")
+		p.expression(e.Subject, lowest)
+		p.write(") {")
+		p.depth++
+		for _, arm := range e.Arms {
+			p.newline()
+			p.pattern(arm.Pattern)
+			if arm.Guard != nil {
+				p.write(" if ")
+				p.expression(arm.Guard, lowest)
+			}
+			p.write(" => ")
+			p.expression(arm.Body, lowest)
+			p.write(",")
+		}
+		p.depth--
+		p.newline()
+		p.write("}")
+	case *ast.SelectExpression:
+		p.write("select {")
+		p.depth++
+		for _, c := range e.Cases {
+			p.newline()
+			switch {
+			case c.IsDefault():
+				p.write("_")
+			case c.Value != nil:
+				p.write("send(")
+				p.expression(c.Channel, lowest)
+				p.write(", ")
+				p.expression(c.Value, lowest)
+				p.write(")")
+			default:
+				p.write("receive(")
+				p.expression(c.Channel, lowest)
+				p.write(")")
+				if c.Var != nil {
+					p.write(" as " + c.Var.Value)
+				}
+			}
+			p.write(" => ")
+			p.expression(c.Body, lowest)
+			p.write(",")
+		}
+		p.depth--
+		p.newline()
+		p.write("}")
+	case *ast.SpawnExpression:
+		if prec > prefix {
+			p.write("(")
+		}
+		p.write("spawn ")
+		p.expression(e.Call, prefix)
+		if prec > prefix {
+			p.write(")")
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range e.Params {
+			if i > 0 {
+				p.write(", ")
+			}
+			if param.Variadic {
+				p.write("...")
+			}
+			p.pattern(param.Pattern)
+			if param.Default != nil {
+				p.write(" = ")
+				p.expression(param.Default, lowest)
+			}
+		}
+		p.write(") ")
+		if e.ReturnType != nil {
+			p.write("-> " + e.ReturnType.Name + " ")
+		}
+		p.block(e.Block)
+	case *ast.MacroLiteral:
+		p.write("macro(")
+		for i, param := range e.Params {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.write(param.Value)
+		}
+		p.write(") ")
+		p.block(e.Body)
+	case *ast.CallExpression:
+		p.expression(e.Function, call)
+		p.write("(")
+		p.list(e.Args)
+		p.write(")")
+	case *ast.SpreadExpression:
+		p.write("...")
+		p.expression(e.Value, lowest)
+	case *ast.NamedArgument:
+		p.write(e.Name.Value + ": ")
+		p.expression(e.Value, lowest)
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.list(e.Elements)
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, pair := range e.Pairs {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(pair.Key, lowest)
+			p.write(": ")
+			p.expression(pair.Value, lowest)
+		}
+		p.write("}")
+	case *ast.IndexExpression:
+		p.expression(e.Left, call)
+		p.write("[")
+		p.expression(e.Index, lowest)
+		p.write("]")
+	case *ast.ImportExpression:
+		p.write("import " + Quote(e.Path))
+	case *ast.MemberExpression:
+		p.expression(e.Object, call)
+		p.write("." + e.Member.Value)
+	}
+}
+
+func (p *printer) list(exps []ast.Expression) {
+	for i, e := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(e, lowest)
+	}
+}
+
+// Quote returns s as a string literal the lexer reads back unchanged.
+func Quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
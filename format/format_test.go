@@ -0,0 +1,114 @@
+package format
+
+import (
+	"testing"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/parser"
+)
+
+func TestProgram(t *testing.T) {
+	input := `let add=fn(a:int,b)->int{if(a<b){return a+b*2}else{(a-b)-(a-b)}};
+let xs=[1,2,add(1,2)];let h={"a\"b":-(1+2),"c":xs[0]}
+if (true) {1}; -5;
+puts(fn(x){x}(1));let m=import "lib/m";m.f(m.xs[0])
+import{a,b as c}from "lib/m"
+export let d=c`
+	expected := `let add = fn(a: int, b) -> int {
+	if (a < b) {
+		return a + b * 2;
+	} else {
+		a - b - (a - b);
+	}
+};
+let xs = [1, 2, add(1, 2)];
+let h = {"a\"b": -(1 + 2), "c": xs[0]};
+if (true) {
+	1;
+};
+-5;
+puts(fn(x) {
+	x;
+}(1));
+let m = import "lib/m";
+m.f(m.xs[0]);
+import { a, b as c } from "lib/m";
+export let d = c;
+`
+	program := parse(t, input)
+	actual := Program(program)
+	if actual != expected {
+		t.Fatalf("wrong output.\nexpected:\n%s\ngot:\n%s", expected, actual)
+	}
+	if Program(parse(t, actual)) != actual {
+		t.Errorf("formatting is not idempotent")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	inputs := []string{
+		"a * (b + c) / d",
+		"(a + b) + (c + d)",
+		"-(-a)",
+		"(-a)(1)",
+		"!(a == b)",
+		"f(g)(h)[0]",
+		`"tab\tand\nnewline"`,
+		"if (x) { 1 }; (2)",
+		"fn() {}",
+		"try { f() } catch (e) { throw e } finally { g() }; (2)",
+		"for (x in xs) { if (x) { break } continue } (1)",
+		"let [a, ...r] = xs; let {n, age: y, \"k\": [k]} = h; fn([x], {y}) { x }",
+		"let f = fn(a, b = [1], ...r) { a }; f(1, ...xs, b: 2)",
+		"let g = fn(n) { yield n; yield n * 2 }; for (x in g(1)) { puts(x) }",
+		"infixr 8 ** = fn(a, b) { a * b }; infixl 1 |> = f; (a ** b) ** c ** d |> g |> (h |> k)",
+		"let t = spawn f(1)(2); select { receive(c) as x => x, send(c, -1) => 0, _ => await(t) }; (2)",
+		`match (x) { [h, ...t] if h > -1 => {"h": h}, {"a": [_, -2]} => 2, _ => match (x) { true => 1 } }; (2)`,
+		"let m = macro(a, b) { quote(unquote(a) * unquote(b)) }; m(1, 2)",
+	}
+	for _, input := range inputs {
+		program := parse(t, input)
+		formatted := Program(program)
+		if got := parse(t, formatted).String(); got != program.String() {
+			t.Errorf("%q: round trip changed the program. want=%q, got=%q (from %q)", input, program.String(), got, formatted)
+		}
+	}
+}
+
+func TestHostOperators(t *testing.T) {
+	// operators only the host knows the precedence of are parenthesised
+	ops := parser.NewOperators()
+	ops.Infix("<>", 9, parser.AssocLeft)
+	ops.Prefix("~")
+	p := parser.New(lexer.New("~a <> b * c <> d"), parser.WithOperators(ops))
+	if got := Program(p.ParseProgram()); got != "(~a <> b) * (c <> d);\n" {
+		t.Errorf("wrong output. got=%q", got)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("%q: parser errors: %v", input, p.Errors())
+	}
+	return program
+}
+
+func TestShebang(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#!/usr/bin/env inti\nlet x = 1;", "#!/usr/bin/env inti\n"},
+		{"#!inti", "#!inti\n"},
+		{"let x = 1;", ""},
+	}
+
+	for _, tt := range tests {
+		if got := Shebang(tt.input); got != tt.expected {
+			t.Errorf("Shebang(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
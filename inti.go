@@ -0,0 +1,310 @@
+// Package inti embeds the inti interpreter in Go programs.
+//
+//	in := inti.New()
+//	in.SetGlobal("limit", 10)
+//	in.RegisterFunc("lookup", func(key string) (int64, error) { ... })
+//	if err := in.Run(ctx, src); err != nil { ... }
+//	allowed, err := in.Call("allow", request)
+//
+// Go values passed in are converted to inti objects, and results converted
+// back, as described by ToObject and FromObject.
+package inti
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+)
+
+// Interpreter runs inti code. Programs run by the same interpreter share
+// their globals, but generators are closed when the Run, Eval or Call that
+// started them returns. It is not safe for concurrent use.
+type Interpreter struct {
+	ev  *evaluator.Evaluator
+	env *object.Environment
+	// ops holds the operators registered and declared by scripts so far.
+	ops *parser.Operators
+}
+
+type config struct {
+	evalOpts []evaluator.Option
+	caps     Capability
+}
+
+type Option func(*config)
+
+// WithOutput sets where puts writes. It defaults to os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithOutput(w)) }
+}
+
+// WithArgs sets the arguments returned by the args builtin.
+func WithArgs(args []string) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithArgs(args)) }
+}
+
+// WithSearchPath sets the directories searched for imports. It defaults to
+// the list in INTI_PATH.
+func WithSearchPath(dirs []string) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithSearchPath(dirs)) }
+}
+
+// Capability is a set of kinds of access scripts are granted to the world
+// outside the interpreter.
+type Capability = evaluator.Capability
+
+const (
+	CapPure = evaluator.CapPure
+	CapIO   = evaluator.CapIO
+	CapFS   = evaluator.CapFS
+	CapEnv  = evaluator.CapEnv
+	CapTime = evaluator.CapTime
+	CapNet  = evaluator.CapNet
+	CapAll  = evaluator.CapAll
+)
+
+// AuditEvent records a call of a builtin needing a capability.
+type AuditEvent = evaluator.AuditEvent
+
+// WithCapabilities grants scripts access to the world outside the
+// interpreter. Interpreters are pure by default: builtins such as puts and
+// read_file are absent unless their capability is granted.
+func WithCapabilities(c Capability) Option {
+	return func(cfg *config) { cfg.caps = c }
+}
+
+// WithAudit calls audit before each call of a builtin needing a
+// capability.
+func WithAudit(audit func(AuditEvent)) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithAudit(audit)) }
+}
+
+// WithDeterministic makes runs repeatable: random is seeded with seed, the
+// clock is virtual, the fs, env and net capabilities are withdrawn, select
+// takes the first case ready and spawn is an error. read_line is withdrawn
+// as well unless WithReplay supplies the lines it returns.
+func WithDeterministic(seed int64) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithDeterministic(seed)) }
+}
+
+// WithRecord writes the inputs scripts read from outside the interpreter,
+// such as the time and files, to w.
+func WithRecord(w io.Writer) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithRecord(w)) }
+}
+
+// WithReplay makes scripts read the inputs recorded by WithRecord from r
+// instead of from outside the interpreter.
+func WithReplay(r io.Reader) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithReplay(r)) }
+}
+
+// Limits bounds the work of each Run, Eval or Call. Zero fields mean no
+// limit, except that a zero CallDepth means DefaultCallDepth.
+type Limits = evaluator.Limits
+
+// DefaultCallDepth is the call depth limit applied unless Limits sets
+// another, so that runaway recursion fails with an error rather than
+// overflowing the Go stack.
+const DefaultCallDepth = evaluator.DefaultCallDepth
+
+// Errors wrapped by the Error returned when a limit is exceeded.
+var (
+	ErrStepLimit       = evaluator.ErrStepLimit
+	ErrCallDepthLimit  = evaluator.ErrCallDepthLimit
+	ErrAllocationLimit = evaluator.ErrAllocationLimit
+)
+
+// WithLimits bounds the work scripts may do, so that untrusted ones cannot
+// run forever or exhaust memory.
+func WithLimits(l Limits) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, evaluator.WithLimits(l)) }
+}
+
+func New(opts ...Option) *Interpreter {
+	cfg := &config{caps: CapPure}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	ops := parser.NewOperators()
+	evalOpts := append(cfg.evalOpts, evaluator.WithCapabilities(cfg.caps), evaluator.WithOperatorTable(ops))
+	return &Interpreter{
+		ev:  evaluator.New(evalOpts...),
+		env: object.NewEnvironment(),
+		ops: ops,
+	}
+}
+
+// Error is a runtime error raised by a script, or by the interpreter when
+// a limit is exceeded.
+type Error struct {
+	Message string
+	// Kind and Trace are as a script catching the error would see them.
+	Kind  string
+	Trace []string
+	cause error
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Unwrap returns the limit error, such as ErrStepLimit, the script
+// exceeded, if any.
+func (e *Error) Unwrap() error { return e.cause }
+
+// SyntaxError holds the errors found parsing a script.
+type SyntaxError struct {
+	Errors []*parser.Error
+}
+
+func (e *SyntaxError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Run runs src, keeping the globals it defines. Evaluation stops with
+// ctx.Err() once ctx is done.
+func (in *Interpreter) Run(ctx context.Context, src string) error {
+	_, err := in.run(ctx, src)
+	return err
+}
+
+// Eval evaluates expr, which may be any program, and returns the value of
+// its last statement converted by FromObject.
+func (in *Interpreter) Eval(ctx context.Context, expr string) (interface{}, error) {
+	result, err := in.run(ctx, expr)
+	if err != nil {
+		return nil, err
+	}
+	return FromObject(result), nil
+}
+
+func (in *Interpreter) run(ctx context.Context, src string) (object.Object, error) {
+	p := parser.New(lexer.New(src), parser.WithOperators(in.ops))
+	program := p.ParseProgram()
+	if errs := p.ErrorList(); len(errs) != 0 {
+		return nil, &SyntaxError{Errors: errs}
+	}
+	return result(in.ev.EvalContext(ctx, program, in.env))
+}
+
+// result turns error objects into errors. Evaluation stopped by a done
+// context returns the context's error.
+func result(obj object.Object) (object.Object, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		if errObj.Cause == context.Canceled || errObj.Cause == context.DeadlineExceeded {
+			return nil, errObj.Cause
+		}
+		return nil, &Error{Message: errObj.Message, Kind: errObj.ErrorKind(), Trace: errObj.Trace, cause: errObj.Cause}
+	}
+	if obj == nil {
+		return evaluator.NULL, nil
+	}
+	return obj, nil
+}
+
+// SetGlobal binds name to value, converted by ToObject, in the global scope.
+func (in *Interpreter) SetGlobal(name string, value interface{}) error {
+	obj, err := ToObject(value)
+	if err != nil {
+		return fmt.Errorf("global %s: %w", name, err)
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Global returns the value of the global name converted by FromObject.
+func (in *Interpreter) Global(name string) (interface{}, bool) {
+	obj, ok := in.env.Get(name)
+	if !ok {
+		return nil, false
+	}
+	return FromObject(obj), true
+}
+
+// RegisterFunc binds name to fn, a Go function, in the global scope.
+// Arguments are converted to fn's parameter types; see ToObject for how
+// results are returned.
+func (in *Interpreter) RegisterFunc(name string, fn interface{}) error {
+	if reflect.TypeOf(fn) == nil || reflect.TypeOf(fn).Kind() != reflect.Func {
+		return fmt.Errorf("RegisterFunc %s: %T is not a function", name, fn)
+	}
+	return in.SetGlobal(name, fn)
+}
+
+// Assoc is the associativity of an infix operator.
+type Assoc = parser.Assoc
+
+const (
+	AssocLeft  = parser.AssocLeft
+	AssocRight = parser.AssocRight
+)
+
+// RegisterInfix adds the infix operator symbol to scripts, applying fn, a Go
+// function of two arguments converted as for RegisterFunc. See
+// parser.Operators.Infix for the symbols and precedences allowed.
+func (in *Interpreter) RegisterInfix(symbol string, prec int, assoc Assoc, fn interface{}) error {
+	if err := checkOperatorFunc(symbol, fn, 2); err != nil {
+		return err
+	}
+	if err := in.ops.Infix(symbol, prec, assoc); err != nil {
+		return fmt.Errorf("RegisterInfix: %w", err)
+	}
+	return in.SetGlobal(symbol, fn)
+}
+
+// RegisterPrefix adds the prefix operator symbol to scripts, applying fn, a
+// Go function of one argument converted as for RegisterFunc.
+func (in *Interpreter) RegisterPrefix(symbol string, fn interface{}) error {
+	if err := checkOperatorFunc(symbol, fn, 1); err != nil {
+		return err
+	}
+	if err := in.ops.Prefix(symbol); err != nil {
+		return fmt.Errorf("RegisterPrefix: %w", err)
+	}
+	return in.SetGlobal(symbol, fn)
+}
+
+func checkOperatorFunc(symbol string, fn interface{}, operands int) error {
+	t := reflect.TypeOf(fn)
+	if t == nil || t.Kind() != reflect.Func || t.NumIn() != operands {
+		return fmt.Errorf("operator %s: %T is not a function of %d arguments", symbol, fn, operands)
+	}
+	return nil
+}
+
+// Call calls the global function fnName with args converted by ToObject,
+// and returns its result converted by FromObject.
+func (in *Interpreter) Call(fnName string, args ...interface{}) (interface{}, error) {
+	return in.CallContext(context.Background(), fnName, args...)
+}
+
+// CallContext is like Call but stops once ctx is done.
+func (in *Interpreter) CallContext(ctx context.Context, fnName string, args ...interface{}) (interface{}, error) {
+	fn, ok := in.env.Get(fnName)
+	if !ok {
+		return nil, fmt.Errorf("no global function %s", fnName)
+	}
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d: %w", i+1, err)
+		}
+		objs[i] = obj
+	}
+	obj, err := result(in.ev.Apply(ctx, fn, objs...))
+	if err != nil {
+		return nil, err
+	}
+	return FromObject(obj), nil
+}
@@ -0,0 +1,215 @@
+package inti
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type rule struct {
+	Name    string
+	Limit   int
+	Tags    []string
+	Enabled bool `inti:"on"`
+	secret  string
+}
+
+func TestRunAndCall(t *testing.T) {
+	var out bytes.Buffer
+	in := New(WithOutput(&out), WithCapabilities(CapIO))
+	if err := in.SetGlobal("rule", rule{Name: "r", Limit: 3, Tags: []string{"a"}, Enabled: true, secret: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.RegisterFunc("scale", func(n int32, factors ...int) (int, error) {
+		result := int(n)
+		for _, f := range factors {
+			if f == 0 {
+				return 0, errors.New("zero factor")
+			}
+			result *= f
+		}
+		return result, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	src := `let allow = fn(req) {
+	if (rule["on"]) { req["size"] < scale(rule["Limit"], 2) } else { false }
+};
+puts(rule["Name"], len(rule["Tags"]));`
+	if err := in.Run(context.Background(), src); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "r\n1\n" {
+		t.Errorf("wrong output %q", out.String())
+	}
+
+	tests := []struct {
+		size     int
+		expected bool
+	}{
+		{5, true},
+		{6, false},
+	}
+	for _, tt := range tests {
+		got, err := in.Call("allow", map[string]int{"size": tt.size})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.expected {
+			t.Errorf("allow(%d) = %v, want %v", tt.size, got, tt.expected)
+		}
+	}
+
+	_, err := in.Eval(context.Background(), `scale(1, 0)`)
+	if _, ok := err.(*Error); !ok || err.Error() != "zero factor" {
+		t.Errorf("wrong error %v", err)
+	}
+	_, err = in.Eval(context.Background(), `let check = fn(n) { if (n > 1) { throw {"kind": "Invalid", "message": "too big"} } n }; 1 + check(2)`)
+	if e, ok := err.(*Error); !ok || e.Kind != "Invalid" || e.Message != "too big" || len(e.Trace) != 1 {
+		t.Errorf("wrong thrown error %#v", err)
+	}
+	if _, err := in.Call("missing"); err == nil {
+		t.Errorf("expected an error calling a missing function")
+	}
+}
+
+func TestConversions(t *testing.T) {
+	in := New()
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`1 + 2`, int64(3)},
+		{`"a" + "b"`, "ab"},
+		{`[1, true, "x", [2]]`, []interface{}{int64(1), true, "x", []interface{}{int64(2)}}},
+		{`{"a": 1, "b": [first([])]}`, map[string]interface{}{"a": int64(1), "b": []interface{}{nil}}},
+		{`{1: "one", true: 2}`, map[interface{}]interface{}{int64(1): "one", true: int64(2)}},
+		{`let x = 1;`, nil},
+		{`if (false) { 1 }`, nil},
+	}
+	for _, tt := range tests {
+		got, err := in.Eval(context.Background(), tt.expr)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.expr, err)
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%s: got %#v, want %#v", tt.expr, got, tt.expected)
+		}
+	}
+
+	var got rule
+	in.RegisterFunc("take", func(r *rule, m map[string][]int) { got = *r; got.Limit += len(m["xs"]) })
+	if _, err := in.Eval(context.Background(), `take({"Name": "n", "Limit": 1, "Tags": ["t"], "on": true}, {"xs": [1, 2]})`); err != nil {
+		t.Fatal(err)
+	}
+	if want := (rule{Name: "n", Limit: 3, Tags: []string{"t"}, Enabled: true}); !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong struct. got=%+v, want=%+v", got, want)
+	}
+
+	errTests := []struct {
+		expr     string
+		expected string
+	}{
+		{`take(1, {})`, "argument 1: cannot use INTEGER as inti.rule"},
+		{`take({"Limit": "x"}, {})`, "argument 1: field Limit: cannot use STRING as int"},
+		{`take({})`, "wrong number of arguments. got=1, want=2"},
+		{`let x = ;`, "1:9: no prefix parse func for ;"},
+	}
+	for _, tt := range errTests {
+		_, err := in.Eval(context.Background(), tt.expr)
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%v", tt.expr, tt.expected, err)
+		}
+	}
+
+	if err := in.SetGlobal("f", 1.5); err == nil || !strings.Contains(err.Error(), "cannot convert float64") {
+		t.Errorf("expected a conversion error, got %v", err)
+	}
+	if err := in.RegisterFunc("g", 1); err == nil {
+		t.Errorf("expected an error registering a non-function")
+	}
+	if err := in.RegisterFunc("h", func() (int, int) { return 1, 2 }); err == nil {
+		t.Errorf("expected an error registering a function with two results")
+	}
+}
+
+func TestGlobal(t *testing.T) {
+	in := New()
+	in.Run(context.Background(), `let limits = {"max": 10};`)
+	got, ok := in.Global("limits")
+	if !ok || fmt.Sprint(got) != "map[max:10]" {
+		t.Errorf("wrong global %v", got)
+	}
+	if _, ok := in.Global("missing"); ok {
+		t.Errorf("found a missing global")
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	in := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := in.Run(ctx, `let loop = fn(n) { if (n > 0) { loop(n - 1) } else { loop(n + 1) } }; loop(1)`)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to stop evaluation, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	in := New(WithLimits(Limits{Steps: 500}))
+	in.Run(context.Background(), `let spin = fn(n) { spin(n + 1) };`)
+	_, err := in.Call("spin", 0)
+	if !errors.Is(err, ErrStepLimit) {
+		t.Fatalf("expected the step limit to stop spin, got %v", err)
+	}
+	// each call gets a fresh budget
+	if got, err := in.Eval(context.Background(), `1 + 1`); err != nil || got != int64(2) {
+		t.Errorf("wrong result after a limit error: %v, %v", got, err)
+	}
+}
+
+func TestCallDepthLimitedByDefault(t *testing.T) {
+	_, err := New().Eval(context.Background(), `let f = fn(n) { 1 + f(n + 1) }; f(0)`)
+	if !errors.Is(err, ErrCallDepthLimit) {
+		t.Errorf("expected the default call depth limit to stop f, got %v", err)
+	}
+}
+
+func TestPureByDefault(t *testing.T) {
+	_, err := New().Eval(context.Background(), `puts("hi")`)
+	if err == nil || err.Error() != "capability denied: puts needs io" {
+		t.Errorf("expected puts to be denied, got %v", err)
+	}
+}
+
+func TestRegisterOperators(t *testing.T) {
+	in := New()
+	if err := in.RegisterInfix("<>", 6, AssocRight, func(a, b string) string { return a + "," + b }); err != nil {
+		t.Fatal(err)
+	}
+	if err := in.RegisterPrefix("$", func(s string) int { return len(s) }); err != nil {
+		t.Fatal(err)
+	}
+	got, err := in.Eval(context.Background(), `$("a" <> "b" <> "c") * 2`)
+	if err != nil || got != int64(10) {
+		t.Errorf("wrong result: %v, %v", got, err)
+	}
+
+	// operators declared by scripts last for later runs
+	in.Run(context.Background(), `infixl 7 %% = fn(a, b) { a - a / b * b }`)
+	if got, err := in.Eval(context.Background(), `1 + 7 %% 4`); err != nil || got != int64(4) {
+		t.Errorf("wrong result for a declared operator: %v, %v", got, err)
+	}
+
+	if err := in.RegisterInfix("+", 6, AssocLeft, func(a, b int) int { return a }); err == nil || err.Error() != "RegisterInfix: operator + is built in" {
+		t.Errorf("expected + to be refused, got %v", err)
+	}
+	if err := in.RegisterPrefix("~", func(a, b int) int { return a }); err == nil {
+		t.Errorf("expected a function of two arguments to be refused")
+	}
+}
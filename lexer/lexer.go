@@ -1,24 +1,64 @@
 package lexer
 
-import "github.com/jarviliam/inti/token"
+import (
+	"sort"
+	"strings"
+
+	"github.com/jarviliam/inti/token"
+)
 
 type Lexer struct {
 	input   string
 	pos     int
 	readPos int
 	ch      byte
+
+	line int
+	col  int
+
+	// operators are the symbols added by AddOperator, longest first.
+	operators []string
 }
 
 func New(in string) *Lexer {
-	l := &Lexer{input: in}
+	l := &Lexer{input: in, line: 1}
 	l.readChar()
+	if strings.HasPrefix(in, "#!") {
+		// a shebang line names the interpreter for scripts run directly
+		for l.ch != '\n' && l.ch != 0 {
+			l.readChar()
+		}
+	}
 	return l
 }
 
+// AddOperator makes the lexer read op, a symbol of operator characters, as
+// a single token whose type is op itself. Added operators are matched before
+// the lexer's own tokens.
+func (l *Lexer) AddOperator(op string) {
+	for _, known := range l.operators {
+		if known == op {
+			return
+		}
+	}
+	l.operators = append(l.operators, op)
+	sort.SliceStable(l.operators, func(i, j int) bool { return len(l.operators[i]) > len(l.operators[j]) })
+}
+
 func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	pos := token.Position{Line: l.line, Column: l.col}
+
+	for _, op := range l.operators {
+		if l.ch != 0 && strings.HasPrefix(l.input[l.pos:], op) {
+			for range op {
+				l.readChar()
+			}
+			return token.Token{Type: token.TokenType(op), Literal: op, Pos: pos}
+		}
+	}
 
 	switch l.ch {
 	case '=':
@@ -27,11 +67,24 @@ func (l *Lexer) NextToken() token.Token {
 			l.readChar()
 			literal := string(ch) + string(l.ch)
 			tok = token.Token{Type: token.EQ, Literal: literal}
+		} else if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.FATARROW, Literal: "=>"}
 		} else {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(token.COLON, l.ch)
+	case '.':
+		if strings.HasPrefix(l.input[l.pos:], "...") {
+			l.readChar()
+			l.readChar()
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "..."}
+		} else {
+			tok = newToken(token.DOT, l.ch)
+		}
 	case '(':
 		tok = newToken(token.LPAREN, l.ch)
 	case ')':
@@ -40,10 +93,19 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.LBRACE, l.ch)
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch)
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "->"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '*':
 		tok = newToken(token.ASETRIK, l.ch)
 	case '!':
@@ -63,6 +125,13 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.GT, l.ch)
 	case ',':
 		tok = newToken(token.COMMA, l.ch)
+	case '"':
+		if str, ok := l.readString(); ok {
+			tok = token.Token{Type: token.STRING, Literal: str}
+		} else {
+			// an unterminated string runs to the end of the input
+			tok = token.Token{Type: token.ILLEGAL, Literal: `"` + str}
+		}
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -70,20 +139,27 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readSpecial(isLetter)
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readSpecial(isDigit)
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
 		}
 	}
+	tok.Pos = pos
 	l.readChar()
 	return tok
 }
 
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.col = 0
+	}
 	//EOF
 	if l.readPos >= len(l.input) {
 		l.ch = 0
@@ -92,6 +168,7 @@ func (l *Lexer) readChar() {
 	}
 	l.pos = l.readPos
 	l.readPos++
+	l.col++
 }
 
 func (l *Lexer) readSpecial(fn func(byte) bool) string {
@@ -102,6 +179,35 @@ func (l *Lexer) readSpecial(fn func(byte) bool) string {
 	return l.input[pos:l.pos]
 }
 
+// readString reads a double quoted string, leaving l.ch on the closing quote.
+// It reports false when the input ends before the string is closed.
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return out.String(), false
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 0:
+				return out.String(), false
+			default:
+				out.WriteByte(l.ch)
+			}
+		default:
+			out.WriteByte(l.ch)
+		}
+	}
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
 		l.readChar()
@@ -125,6 +231,12 @@ func newToken(tokenType token.TokenType, ch byte) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
+// IsOperatorChar reports whether ch may be part of an operator added with
+// AddOperator.
+func IsOperatorChar(ch byte) bool {
+	return strings.IndexByte("!$%&*+-./<=>?@^|~", ch) >= 0
+}
+
 func isLetter(ch byte) bool {
 	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
 
@@ -15,6 +15,10 @@ func TestNextToken(t *testing.T) {
           let res = add(five,ten);
           !-/*5;
           5 < 10 > 5;
+          "foobar"
+          "foo bar"
+          [1, 2];
+          {"foo": "bar"}
   `
 	testCases := []struct {
 		expectedType    token.TokenType
@@ -68,6 +72,19 @@ func TestNextToken(t *testing.T) {
 		{token.GT, ">"},
 		{token.INT, "5"},
 		{token.SEMICOLON, ";"},
+		{token.STRING, "foobar"},
+		{token.STRING, "foo bar"},
+		{token.LBRACKET, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACKET, "]"},
+		{token.SEMICOLON, ";"},
+		{token.LBRACE, "{"},
+		{token.STRING, "foo"},
+		{token.COLON, ":"},
+		{token.STRING, "bar"},
+		{token.RBRACE, "}"},
 		{token.EOF, ""},
 	}
 	lexer := New(input)
@@ -82,3 +99,86 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"a\\nb\""
+	testCases := []struct {
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{"let", token.Position{Line: 1, Column: 1}},
+		{"x", token.Position{Line: 1, Column: 5}},
+		{"=", token.Position{Line: 1, Column: 7}},
+		{"5", token.Position{Line: 1, Column: 9}},
+		{";", token.Position{Line: 1, Column: 10}},
+		{"x", token.Position{Line: 2, Column: 3}},
+		{"+", token.Position{Line: 2, Column: 5}},
+		{"a\nb", token.Position{Line: 2, Column: 7}},
+		{"", token.Position{Line: 2, Column: 13}},
+	}
+	lexer := New(input)
+	for i, tC := range testCases {
+		tok := lexer.NextToken()
+
+		if tok.Literal != tC.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tC.expectedLiteral, tok.Literal)
+		}
+		if tok.Pos != tC.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%s, got=%s", i, tC.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestPatternTokens(t *testing.T) {
+	input := `[h, ...t] => x.y`
+	expected := []token.TokenType{token.LBRACKET, token.IDENT, token.COMMA, token.ELLIPSIS, token.IDENT,
+		token.RBRACKET, token.FATARROW, token.IDENT, token.DOT, token.IDENT, token.EOF}
+	l := New(input)
+	for i, tt := range expected {
+		if tok := l.NextToken(); tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	tok := New(`"abc`).NextToken()
+	if tok.Type != token.ILLEGAL {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.ILLEGAL, tok.Type)
+	}
+}
+
+func TestShebangLine(t *testing.T) {
+	l := New("#!/usr/bin/env inti run\nlet x = 1;")
+	tok := l.NextToken()
+	if tok.Type != token.LET {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.LET, tok.Type)
+	}
+	if tok.Pos != (token.Position{Line: 2, Column: 1}) {
+		t.Fatalf("position wrong. expected=2:1, got=%s", tok.Pos)
+	}
+}
+
+func TestAddedOperators(t *testing.T) {
+	l := New(`a <+> b<+b |> -c`)
+	l.AddOperator("<+")
+	l.AddOperator("<+>")
+	l.AddOperator("|>")
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a"},
+		{Type: "<+>", Literal: "<+>"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: "<+", Literal: "<+"},
+		{Type: token.IDENT, Literal: "b"},
+		{Type: "|>", Literal: "|>"},
+		{Type: token.MINUS, Literal: "-"},
+		{Type: token.IDENT, Literal: "c"},
+		{Type: token.EOF, Literal: ""},
+	}
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt.Type || tok.Literal != tt.Literal {
+			t.Fatalf("tests[%d] - token wrong. expected=%q %q, got=%q %q", i, tt.Type, tt.Literal, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Package lineedit is a small line editor for terminals, with cursor
+// movement, history, reverse search and tab completion.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted is returned by ReadLine when the user presses Ctrl-C.
+var ErrInterrupted = errors.New("interrupted")
+
+// maxHistory is the number of history entries kept.
+const maxHistory = 1000
+
+type Editor struct {
+	in  *bufio.Reader
+	out io.Writer
+	// fd is the terminal put in raw mode while reading, or -1.
+	fd int
+
+	history  []string
+	histFile string
+
+	// Completions returns the words Tab completes to. It is called each
+	// time Tab is pressed.
+	Completions func() []string
+	// Highlight, if set, decorates the line as it is drawn. It must only add
+	// escape sequences that take up no columns.
+	Highlight func(string) string
+}
+
+// New returns an editor reading keys from in and drawing on out. When in is
+// a terminal it is put in raw mode for the duration of each ReadLine.
+func New(in io.Reader, out io.Writer) *Editor {
+	e := &Editor{in: bufio.NewReader(in), out: out, fd: -1}
+	if f, ok := in.(*os.File); ok && IsTerminal(f) {
+		e.fd = int(f.Fd())
+	}
+	return e
+}
+
+func ctrl(r rune) rune { return r & 0x1f }
+
+const (
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// line is the state of the line being edited.
+type line struct {
+	prompt string
+	buf    []rune
+	pos    int
+}
+
+func (l *line) set(s string) {
+	l.buf = []rune(s)
+	l.pos = len(l.buf)
+}
+
+func (l *line) insert(rs ...rune) {
+	buf := make([]rune, 0, len(l.buf)+len(rs))
+	buf = append(buf, l.buf[:l.pos]...)
+	buf = append(buf, rs...)
+	l.buf = append(buf, l.buf[l.pos:]...)
+	l.pos += len(rs)
+}
+
+// remove deletes the runes between from and to and leaves the cursor at from.
+func (l *line) remove(from, to int) {
+	l.buf = append(l.buf[:from], l.buf[to:]...)
+	l.pos = from
+}
+
+// wordStart returns where the word before the cursor begins.
+func (l *line) wordStart() int {
+	i := l.pos
+	for i > 0 && isWordRune(l.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// ReadLine shows prompt and returns the line the user enters. It returns
+// io.EOF for Ctrl-D on an empty line and ErrInterrupted for Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.fd >= 0 {
+		if restore, err := makeRaw(e.fd); err == nil {
+			defer restore()
+		}
+	}
+
+	l := &line{prompt: prompt}
+	// hist indexes the history entry shown; len(e.history) is the new line,
+	// kept in edited while browsing.
+	hist := len(e.history)
+	var edited string
+
+	e.refresh(l)
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(l.buf) > 0 {
+				return string(l.buf), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.write("\r\n")
+			return string(l.buf), nil
+		case ctrl('C'):
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case ctrl('D'):
+			if len(l.buf) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			if l.pos < len(l.buf) {
+				l.remove(l.pos, l.pos+1)
+			}
+		case ctrl('A'):
+			l.pos = 0
+		case ctrl('E'):
+			l.pos = len(l.buf)
+		case ctrl('B'):
+			if l.pos > 0 {
+				l.pos--
+			}
+		case ctrl('F'):
+			if l.pos < len(l.buf) {
+				l.pos++
+			}
+		case ctrl('H'), keyBackspace:
+			if l.pos > 0 {
+				l.remove(l.pos-1, l.pos)
+			}
+		case ctrl('W'):
+			i := l.pos
+			for i > 0 && unicode.IsSpace(l.buf[i-1]) {
+				i--
+			}
+			for i > 0 && !unicode.IsSpace(l.buf[i-1]) {
+				i--
+			}
+			l.remove(i, l.pos)
+		case ctrl('U'):
+			l.remove(0, l.pos)
+		case ctrl('K'):
+			l.buf = l.buf[:l.pos]
+		case ctrl('P'), ctrl('N'):
+			hist, edited = e.browse(l, hist, edited, r == ctrl('P'))
+		case ctrl('R'):
+			if e.search(l) {
+				e.write("\r\n")
+				return string(l.buf), nil
+			}
+		case '\t':
+			e.complete(l)
+		case keyEscape:
+			switch e.escape() {
+			case 'A':
+				hist, edited = e.browse(l, hist, edited, true)
+			case 'B':
+				hist, edited = e.browse(l, hist, edited, false)
+			case 'C':
+				if l.pos < len(l.buf) {
+					l.pos++
+				}
+			case 'D':
+				if l.pos > 0 {
+					l.pos--
+				}
+			case 'H':
+				l.pos = 0
+			case 'F':
+				l.pos = len(l.buf)
+			case '3':
+				if l.pos < len(l.buf) {
+					l.remove(l.pos, l.pos+1)
+				}
+			}
+		default:
+			if unicode.IsPrint(r) {
+				l.insert(r)
+			}
+		}
+		e.refresh(l)
+	}
+}
+
+// escape reads the rest of an escape sequence and returns the key it names:
+// A-D for the arrows, H and F for home and end, '3' for delete, or 0.
+func (e *Editor) escape() rune {
+	r, _, err := e.in.ReadRune()
+	if err != nil || (r != '[' && r != 'O') {
+		return 0
+	}
+	r, _, err = e.in.ReadRune()
+	if err != nil {
+		return 0
+	}
+	if r < '0' || r > '9' {
+		return r
+	}
+	// numbered keys end in '~', as in ESC [ 3 ~
+	num := r
+	for {
+		r, _, err = e.in.ReadRune()
+		if err != nil || r == '~' {
+			break
+		}
+		if r < '0' || r > '9' {
+			return 0
+		}
+	}
+	switch num {
+	case '1', '7':
+		return 'H'
+	case '4', '8':
+		return 'F'
+	}
+	return num
+}
+
+// browse moves through the history, older when up is set.
+func (e *Editor) browse(l *line, hist int, edited string, up bool) (int, string) {
+	if hist == len(e.history) {
+		edited = string(l.buf)
+	}
+	switch {
+	case up && hist > 0:
+		hist--
+	case !up && hist < len(e.history):
+		hist++
+	default:
+		return hist, edited
+	}
+	if hist == len(e.history) {
+		l.set(edited)
+	} else {
+		l.set(e.history[hist])
+	}
+	return hist, edited
+}
+
+// search runs a reverse incremental search of the history. It leaves the
+// match in l and reports whether the user accepted it with Enter.
+func (e *Editor) search(l *line) bool {
+	orig := string(l.buf)
+	var query []rune
+	match := len(e.history)
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if strings.Contains(e.history[i], string(query)) {
+				match = i
+				return
+			}
+		}
+		match = -1
+	}
+
+	for {
+		label, found := "(reverse-i-search)", ""
+		if match >= 0 && match < len(e.history) {
+			found = e.history[match]
+		} else if match < 0 {
+			label = "(failed reverse-i-search)"
+		}
+		e.write(fmt.Sprintf("\r%s`%s': %s\x1b[K", label, string(query), found))
+
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			l.set(orig)
+			return false
+		}
+		switch r {
+		case ctrl('R'):
+			if match > 0 {
+				find(match - 1)
+			}
+		case ctrl('H'), keyBackspace:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(e.history) - 1)
+			}
+		case ctrl('G'), ctrl('C'):
+			l.set(orig)
+			return false
+		case '\r', '\n':
+			l.set(found)
+			return true
+		default:
+			if unicode.IsPrint(r) {
+				query = append(query, r)
+				if match < 0 || match == len(e.history) {
+					find(len(e.history) - 1)
+				} else {
+					find(match)
+				}
+				continue
+			}
+			// any other key accepts the match and is then handled as usual
+			l.set(found)
+			e.in.UnreadRune()
+			return false
+		}
+	}
+}
+
+// complete extends the word before the cursor as far as the completions
+// agree, listing them when they cannot be narrowed further.
+func (e *Editor) complete(l *line) {
+	if e.Completions == nil {
+		return
+	}
+	start := l.wordStart()
+	word := string(l.buf[start:l.pos])
+	var matches []string
+	seen := map[string]bool{}
+	for _, c := range e.Completions() {
+		if strings.HasPrefix(c, word) && !seen[c] {
+			seen[c] = true
+			matches = append(matches, c)
+		}
+	}
+	if len(matches) == 0 {
+		e.write("\a")
+		return
+	}
+	sort.Strings(matches)
+
+	prefix := matches[0]
+	for _, m := range matches[1:] {
+		for !strings.HasPrefix(m, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) {
+		l.insert([]rune(prefix[len(word):])...)
+		return
+	}
+	if len(matches) > 1 {
+		e.write("\r\n" + strings.Join(matches, "  ") + "\r\n")
+	}
+}
+
+// refresh redraws the line and puts the cursor in place.
+func (e *Editor) refresh(l *line) {
+	var b strings.Builder
+	text := string(l.buf)
+	if e.Highlight != nil {
+		text = e.Highlight(text)
+	}
+	b.WriteString("\r" + l.prompt + text + "\x1b[K\r")
+	if col := len([]rune(l.prompt)) + l.pos; col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	e.write(b.String())
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+// History returns the history entries, oldest first.
+func (e *Editor) History() []string {
+	return e.history
+}
+
+// AddHistory appends an entry to the history, skipping blank lines and
+// repeats of the last entry, and writes it to the history file if one is set.
+func (e *Editor) AddHistory(entry string) error {
+	if strings.TrimSpace(entry) == "" || strings.Contains(entry, "\n") {
+		return nil
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == entry {
+		return nil
+	}
+	e.history = append(e.history, entry)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	if e.histFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(e.histFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.WriteString(f, entry+"\n")
+	return err
+}
+
+// SetHistoryFile loads the history saved in path, creating its directory if
+// needed, and appends new entries to it from then on.
+func (e *Editor) SetHistoryFile(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var entries []string
+	for _, entry := range strings.Split(string(data), "\n") {
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	if len(entries) > maxHistory {
+		// keep the file from growing without bound
+		entries = entries[len(entries)-maxHistory:]
+		if err := ioutil.WriteFile(path, []byte(strings.Join(entries, "\n")+"\n"), 0600); err != nil {
+			return err
+		}
+	}
+	e.history = append(entries, e.history...)
+	e.histFile = path
+	return nil
+}
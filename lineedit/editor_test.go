@@ -0,0 +1,102 @@
+package lineedit
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadLine(t *testing.T) {
+	history := []string{"let x = 1;", "puts(x);", "let y = 2;"}
+	tests := []struct {
+		name  string
+		keys  string
+		want  string
+		error error
+	}{
+		{"plain", "let a = 1;\r", "let a = 1;", nil},
+		{"ctrl-a inserts at start", "bc\x01a\r", "abc", nil},
+		{"ctrl-e returns to end", "bc\x01a\x05d\r", "abcd", nil},
+		{"arrows move", "ac\x1b[Db\x1b[Cd\r", "abcd", nil},
+		{"home and end", "bc\x1b[Ha\x1b[4~d\r", "abcd", nil},
+		{"backspace", "abx\x7fc\r", "abc", nil},
+		{"delete under cursor", "abxc\x1b[D\x1b[D\x1b[3~\r", "abc", nil},
+		{"ctrl-w removes word", "foo bar  \x17baz\r", "foo baz", nil},
+		{"ctrl-k and ctrl-u", "abcd\x1b[D\x1b[D\x0b\x1b[D\x15\r", "b", nil},
+		{"up recalls history", "\x1b[A\x1b[A\r", "puts(x);", nil},
+		{"down returns to edited line", "new\x1b[A\x1b[B\r", "new", nil},
+		{"ctrl-p ctrl-n", "\x10\x10\x0e\r", "let y = 2;", nil},
+		{"reverse search", "\x12let\r", "let y = 2;", nil},
+		{"reverse search again", "\x12let\x12\r", "let x = 1;", nil},
+		{"reverse search then edit", "\x12puts\x05!\r", "puts(x);!", nil},
+		{"reverse search cancelled", "ab\x12puts\x07c\r", "abc", nil},
+		{"ctrl-d on empty line", "\x04", "", io.EOF},
+		{"ctrl-c", "abc\x03", "", ErrInterrupted},
+	}
+
+	for _, tt := range tests {
+		e := New(strings.NewReader(tt.keys), ioutil.Discard)
+		for _, h := range history {
+			e.AddHistory(h)
+		}
+		got, err := e.ReadLine(">> ")
+		if err != tt.error {
+			t.Errorf("%s: wrong error. want=%v, got=%v", tt.name, tt.error, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestComplete(t *testing.T) {
+	words := []string{"let", "len", "last", "puts", "lenient"}
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"pu\t(1)\r", "puts(1)"},
+		{"x = la\t\r", "x = last"},
+		{"le\tt\r", "let"},
+		{"lena\t\r", "lena"},
+		{"len\t\r", "len"},
+		{"len(l\tas\t)\r", "len(last)"},
+	}
+
+	for _, tt := range tests {
+		e := New(strings.NewReader(tt.keys), ioutil.Discard)
+		e.Completions = func() []string { return words }
+		got, err := e.ReadLine(">> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%q: wrong line. want=%q, got=%q", tt.keys, tt.want, got)
+		}
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inti", "history")
+
+	e := New(strings.NewReader(""), ioutil.Discard)
+	if err := e.SetHistoryFile(path); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range []string{"a", "b", "b", " ", "c"} {
+		if err := e.AddHistory(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	e = New(strings.NewReader(""), ioutil.Discard)
+	if err := e.SetHistoryFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(e.History(), ","); got != "a,b,c" {
+		t.Fatalf("wrong history. want=%q, got=%q", "a,b,c", got)
+	}
+}
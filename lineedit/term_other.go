@@ -0,0 +1,25 @@
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package lineedit
+
+import (
+	"errors"
+	"os"
+)
+
+// IsTerminal reports whether f is a terminal. Raw mode is only supported on
+// Unix systems, so elsewhere nothing counts as one.
+func IsTerminal(f *os.File) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
+
+// Width returns the number of columns of the terminal f, or 0 if f is not a
+// terminal.
+func Width(f *os.File) int {
+	return 0
+}
@@ -0,0 +1,100 @@
+package lsp
+
+import (
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/parser"
+	"github.com/jarviliam/inti/resolver"
+	"github.com/jarviliam/inti/token"
+	"github.com/jarviliam/inti/types"
+)
+
+// document is an open file and what is known about it.
+type document struct {
+	uri     string
+	text    string
+	program *ast.Program
+	errors  []*parser.Error
+	scopes  *resolver.Result
+	checker *types.Checker
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text}
+	p := parser.New(lexer.New(text))
+	d.program = p.ParseProgram()
+	d.errors = p.ErrorList()
+	d.scopes = resolver.Resolve(d.program, evaluator.BuiltinNames()...)
+	// types are only used for hovers, so errors are ignored
+	d.checker = types.NewChecker()
+	d.checker.Check(d.program)
+	return d
+}
+
+func (d *document) diagnostics() []Diagnostic {
+	diags := []Diagnostic{}
+	for _, e := range d.errors {
+		diags = append(diags, Diagnostic{
+			Range:    pointRange(e.Pos, 1),
+			Severity: SeverityError,
+			Source:   "parser",
+			Message:  e.Msg,
+		})
+	}
+	for _, r := range d.scopes.Diagnostics {
+		severity := SeverityError
+		if r.Severity == resolver.Warning {
+			severity = SeverityWarning
+		}
+		length := 1
+		if ident, ok := d.scopes.IdentifierAt(r.Pos); ok {
+			length = len(ident.Value)
+		}
+		diags = append(diags, Diagnostic{
+			Range:    pointRange(r.Pos, length),
+			Severity: severity,
+			Source:   "resolver",
+			Message:  r.Msg,
+		})
+	}
+	return diags
+}
+
+// identifierAt returns the identifier under an editor position and the
+// definition it refers to.
+func (d *document) identifierAt(pos Position) (*ast.Identifier, *resolver.Definition, bool) {
+	ident, ok := d.scopes.IdentifierAt(toTokenPos(pos))
+	if !ok {
+		return nil, nil, false
+	}
+	def, ok := d.scopes.DefinitionOf(ident)
+	return ident, def, ok
+}
+
+// end returns the position just past the last character of the document.
+func (d *document) end() Position {
+	lines := strings.Split(d.text, "\n")
+	return Position{Line: len(lines) - 1, Character: len(lines[len(lines)-1])}
+}
+
+// toTokenPos converts a 0-based editor position to a 1-based token position.
+// Columns are counted in bytes, which matches UTF-16 offsets for ASCII text.
+func toTokenPos(p Position) token.Position {
+	return token.Position{Line: p.Line + 1, Column: p.Character + 1}
+}
+
+func fromTokenPos(p token.Position) Position {
+	return Position{Line: p.Line - 1, Character: p.Column - 1}
+}
+
+func pointRange(p token.Position, length int) Range {
+	start := fromTokenPos(p)
+	return Range{Start: start, End: Position{Line: start.Line, Character: start.Character + length}}
+}
+
+func identRange(ident *ast.Identifier) Range {
+	return pointRange(ident.Pos(), len(ident.Value))
+}
@@ -0,0 +1,352 @@
+// Package lsp implements a Language Server Protocol server for inti over a
+// pair of streams, usually stdin and stdout.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/format"
+	"github.com/jarviliam/inti/jsonrpc"
+	"github.com/jarviliam/inti/resolver"
+	"github.com/jarviliam/inti/token"
+)
+
+type Server struct {
+	in   *jsonrpc.Reader
+	out  *jsonrpc.Writer
+	docs map[string]*document
+
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   jsonrpc.NewReader(in),
+		out:  jsonrpc.NewWriter(out),
+		docs: make(map[string]*document),
+	}
+}
+
+// errExit stops Run after an exit notification.
+var errExit = errors.New("exit")
+
+// Run serves requests until the client sends exit or closes the input.
+func (s *Server) Run() error {
+	for {
+		body, err := s.in.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.handle(body); err != nil {
+			if err == errExit {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e *rpcError) Error() string { return e.msg }
+
+func (s *Server) handle(body []byte) error {
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		return s.reply(nil, nil, &rpcError{codeParseError, err.Error()})
+	}
+
+	result, err := s.dispatch(req.Method, req.Params)
+	if err == errExit {
+		return err
+	}
+	if req.ID == nil {
+		// notifications get no response
+		return nil
+	}
+	return s.reply(req.ID, result, err)
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err error) error {
+	resp := response{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{codeInvalidParams, err.Error()}
+		}
+		resp.Error = &responseError{Code: rpcErr.code, Message: rpcErr.msg}
+	} else {
+		raw, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		msg := json.RawMessage(raw)
+		resp.Result = &msg
+	}
+	return s.out.Write(resp)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return s.out.Write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) dispatch(method string, raw json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		return s.initialize()
+	case "initialized", "$/cancelRequest", "$/setTrace":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "exit":
+		return nil, errExit
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+		if n := len(params.ContentChanges); n > 0 {
+			// the server asks for full syncs, so the last change is the document
+			return nil, s.update(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.hover(d, params.Position), nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(d, params.Position), nil
+	case "textDocument/references":
+		var params ReferenceParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.references(d, params.Position, params.Context.IncludeDeclaration), nil
+	case "textDocument/documentSymbol":
+		var params DocumentParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return symbols(d.program.Statements), nil
+	case "textDocument/formatting":
+		var params DocumentParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.formatting(d), nil
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		d, err := s.document(raw, &params, &params.TextDocument)
+		if err != nil {
+			return nil, err
+		}
+		return s.completion(d, params.Position), nil
+	}
+	return nil, &rpcError{codeMethodNotFound, "method not found: " + method}
+}
+
+// document decodes params and returns the open document they name.
+func (s *Server) document(raw json.RawMessage, params interface{}, id *TextDocumentIdentifier) (*document, error) {
+	if err := json.Unmarshal(raw, params); err != nil {
+		return nil, err
+	}
+	d, ok := s.docs[id.URI]
+	if !ok {
+		return nil, fmt.Errorf("document not open: %s", id.URI)
+	}
+	return d, nil
+}
+
+func (s *Server) initialize() (interface{}, error) {
+	var result InitializeResult
+	result.ServerInfo.Name = "inti"
+	result.Capabilities = ServerCapabilities{
+		TextDocumentSync:           syncFull,
+		HoverProvider:              true,
+		DefinitionProvider:         true,
+		ReferencesProvider:         true,
+		DocumentSymbolProvider:     true,
+		DocumentFormattingProvider: true,
+		CompletionProvider:         &CompletionOptions{},
+	}
+	return result, nil
+}
+
+func (s *Server) update(uri, text string) error {
+	d := newDocument(uri, text)
+	s.docs[uri] = d
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: d.diagnostics(),
+	})
+}
+
+func (s *Server) hover(d *document, pos Position) interface{} {
+	ident, def, ok := d.identifierAt(pos)
+	if !ok {
+		return nil
+	}
+
+	var text strings.Builder
+	text.WriteString("```inti\n")
+	switch def.Kind {
+	case resolver.Predeclared:
+		text.WriteString("builtin " + def.Name)
+	default:
+		text.WriteString(def.Kind.String() + " " + def.Name)
+		if t, ok := d.checker.TypeOf(def.Ident); ok {
+			text.WriteString(": " + t.String())
+		}
+		if def.Kind == resolver.Let {
+			if _, ok := def.Value.(*ast.FunctionLiteral); !ok && def.Value != nil {
+				text.WriteString(" = " + format.Node(def.Value))
+			}
+		}
+	}
+	text.WriteString("\n```")
+
+	r := identRange(ident)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: text.String()}, Range: &r}
+}
+
+func (s *Server) definition(d *document, pos Position) interface{} {
+	_, def, ok := d.identifierAt(pos)
+	if !ok || def.Ident == nil {
+		return nil
+	}
+	return Location{URI: d.uri, Range: identRange(def.Ident)}
+}
+
+func (s *Server) references(d *document, pos Position, includeDecl bool) interface{} {
+	_, def, ok := d.identifierAt(pos)
+	if !ok {
+		return nil
+	}
+	locations := []Location{}
+	for _, ident := range d.scopes.References(def) {
+		if ident == def.Ident && !includeDecl {
+			continue
+		}
+		locations = append(locations, Location{URI: d.uri, Range: identRange(ident)})
+	}
+	return locations
+}
+
+// symbols lists the lets in stmts, nesting those made inside function bodies.
+func symbols(stmts []ast.Statement) []DocumentSymbol {
+	syms := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+		if let.Pattern != nil {
+			for _, name := range let.Names() {
+				syms = append(syms, DocumentSymbol{
+					Name:           name.Value,
+					Kind:           SymbolKindVariable,
+					Range:          identRange(name),
+					SelectionRange: identRange(name),
+				})
+			}
+			continue
+		}
+		sym := DocumentSymbol{
+			Name: let.Name.Value,
+			Kind: SymbolKindVariable,
+			Range: Range{
+				Start: fromTokenPos(let.Pos()),
+				End:   identRange(let.Name).End,
+			},
+			SelectionRange: identRange(let.Name),
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			sym.Kind = SymbolKindFunction
+			sym.Range.End = fromTokenPos(fn.Block.End)
+			sym.Range.End.Character++
+			sym.Children = symbols(fn.Block.Statements)
+		}
+		syms = append(syms, sym)
+	}
+	return syms
+}
+
+func (s *Server) formatting(d *document) interface{} {
+	if len(d.errors) != 0 {
+		// a partial tree would drop text
+		return []TextEdit{}
+	}
+	formatted := format.Shebang(d.text) + format.Program(d.program)
+	if formatted == d.text {
+		return []TextEdit{}
+	}
+	return []TextEdit{{
+		Range:   Range{Start: Position{}, End: d.end()},
+		NewText: formatted,
+	}}
+}
+
+func (s *Server) completion(d *document, pos Position) interface{} {
+	items := []CompletionItem{}
+	for _, kw := range token.Keywords() {
+		items = append(items, CompletionItem{Label: kw, Kind: CompletionKindKeyword})
+	}
+	for _, name := range evaluator.BuiltinNames() {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionKindFunction, Detail: "builtin"})
+	}
+	for _, def := range d.scopes.Visible(toTokenPos(pos)) {
+		if def.Kind == resolver.Predeclared {
+			continue
+		}
+		kind := CompletionKindVariable
+		if _, ok := def.Value.(*ast.FunctionLiteral); ok {
+			kind = CompletionKindFunction
+		}
+		item := CompletionItem{Label: def.Name, Kind: kind, Detail: def.Kind.String()}
+		if t, ok := d.checker.TypeOf(def.Ident); ok {
+			item.Detail = t.String()
+		}
+		items = append(items, item)
+	}
+	return items
+}
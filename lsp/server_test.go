@@ -0,0 +1,226 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jarviliam/inti/jsonrpc"
+)
+
+const uri = "file:///test.inti"
+
+type client struct {
+	t      *testing.T
+	w      *jsonrpc.Writer
+	r      *jsonrpc.Reader
+	nextID int
+	// notifications received while waiting for responses
+	notes []notification
+}
+
+func newClient(t *testing.T) (*client, chan error) {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+	}()
+	return &client{t: t, w: jsonrpc.NewWriter(clientOut), r: jsonrpc.NewReader(clientIn)}, done
+}
+
+func (c *client) notify(method string, params interface{}) {
+	if err := c.w.Write(notification{JSONRPC: "2.0", Method: method, Params: params}); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *client) call(method string, params interface{}, result interface{}) {
+	c.nextID++
+	id := c.nextID
+	msg := map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}
+	if err := c.w.Write(msg); err != nil {
+		c.t.Fatal(err)
+	}
+	for {
+		body, err := c.r.Read()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		var resp struct {
+			ID     *int            `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+			Result json.RawMessage `json:"result"`
+			Error  *responseError  `json:"error"`
+		}
+		if err := json.Unmarshal(body, &resp); err != nil {
+			c.t.Fatal(err)
+		}
+		if resp.ID == nil {
+			c.notes = append(c.notes, notification{Method: resp.Method, Params: resp.Params})
+			continue
+		}
+		if *resp.ID != id {
+			c.t.Fatalf("response for %d while waiting for %d", *resp.ID, id)
+		}
+		if resp.Error != nil {
+			c.t.Fatalf("%s failed: %s", method, resp.Error.Message)
+		}
+		if result != nil {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				c.t.Fatal(err)
+			}
+		}
+		return
+	}
+}
+
+// diagnostics waits for the next published diagnostics.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	for len(c.notes) == 0 {
+		body, err := c.r.Read()
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		var n struct {
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		json.Unmarshal(body, &n)
+		c.notes = append(c.notes, notification{Method: n.Method, Params: n.Params})
+	}
+	n := c.notes[0]
+	c.notes = c.notes[1:]
+	if n.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %s", n.Method)
+	}
+	var params PublishDiagnosticsParams
+	json.Unmarshal(n.Params.(json.RawMessage), &params)
+	return params
+}
+
+func (c *client) open(text string) {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "inti", Version: 1, Text: text},
+	})
+}
+
+func at(line, char int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: char},
+	}
+}
+
+const source = `let double = fn(x: int) {
+	let y = x * 2;
+	y
+};
+let n = 21;
+double(n) + n
+`
+
+func TestSession(t *testing.T) {
+	c, done := newClient(t)
+
+	var init InitializeResult
+	c.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}}, &init)
+	if !init.Capabilities.HoverProvider || init.Capabilities.TextDocumentSync != syncFull {
+		t.Fatalf("unexpected capabilities %+v", init.Capabilities)
+	}
+	c.notify("initialized", struct{}{})
+
+	c.open(source)
+	if diags := c.diagnostics(); len(diags.Diagnostics) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", diags.Diagnostics)
+	}
+
+	var hover Hover
+	c.call("textDocument/hover", at(5, 1), &hover)
+	if !strings.Contains(hover.Contents.Value, "let double: fn(int) -> int") {
+		t.Errorf("hover wrong: %q", hover.Contents.Value)
+	}
+	c.call("textDocument/hover", at(5, 7), &hover)
+	if !strings.Contains(hover.Contents.Value, "let n: int = 21") {
+		t.Errorf("hover wrong: %q", hover.Contents.Value)
+	}
+
+	var loc Location
+	c.call("textDocument/definition", at(2, 1), &loc)
+	if loc.Range.Start != (Position{Line: 1, Character: 5}) {
+		t.Errorf("definition of y wrong: %+v", loc)
+	}
+
+	var refs []Location
+	params := ReferenceParams{TextDocumentPositionParams: at(4, 4)}
+	params.Context.IncludeDeclaration = true
+	c.call("textDocument/references", params, &refs)
+	if len(refs) != 3 {
+		t.Errorf("expected 3 references to n, got %+v", refs)
+	}
+
+	var syms []DocumentSymbol
+	c.call("textDocument/documentSymbol", DocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &syms)
+	if len(syms) != 2 || syms[0].Name != "double" || syms[0].Kind != SymbolKindFunction ||
+		len(syms[0].Children) != 1 || syms[0].Children[0].Name != "y" {
+		t.Errorf("unexpected symbols %+v", syms)
+	}
+
+	var items []CompletionItem
+	c.call("textDocument/completion", at(2, 1), &items)
+	labels := map[string]bool{}
+	for _, item := range items {
+		labels[item.Label] = true
+	}
+	for _, want := range []string{"let", "len", "double", "x", "y", "n"} {
+		if !labels[want] {
+			t.Errorf("completion missing %q", want)
+		}
+	}
+
+	c.call("shutdown", nil, nil)
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDiagnosticsAndFormatting(t *testing.T) {
+	c, done := newClient(t)
+	c.call("initialize", map[string]interface{}{}, nil)
+
+	c.open("let x = ;\nputs(y)")
+	diags := c.diagnostics().Diagnostics
+	if len(diags) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %+v", diags)
+	}
+	if diags[0].Source != "parser" || diags[0].Range.Start != (Position{Line: 0, Character: 8}) {
+		t.Errorf("unexpected parser diagnostic %+v", diags[0])
+	}
+	if diags[1].Message != "undefined: y" || diags[1].Range.Start != (Position{Line: 1, Character: 5}) {
+		t.Errorf("unexpected resolver diagnostic %+v", diags[1])
+	}
+
+	c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: uri},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x=fn(a){a+1};x(2)"}},
+	})
+	if diags := c.diagnostics().Diagnostics; len(diags) != 0 {
+		t.Fatalf("unexpected diagnostics %+v", diags)
+	}
+
+	var edits []TextEdit
+	c.call("textDocument/formatting", DocumentParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits)
+	expected := "let x = fn(a) {\n\ta + 1;\n};\nx(2);\n"
+	if len(edits) != 1 || edits[0].NewText != expected {
+		t.Errorf("unexpected edits %+v", edits)
+	}
+
+	c.notify("exit", nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
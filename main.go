@@ -1,19 +0,0 @@
-package main
-
-import (
-	"fmt"
-	"os"
-	"os/user"
-
-	"github.com/jarviliam/inti/repl"
-)
-
-func main() {
-	user, err := user.Current()
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("Hello %s! This is inti \n", user.Username)
-	fmt.Printf("Type in commands\n")
-	repl.Start(os.Stdin, os.Stdout)
-}
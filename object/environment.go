@@ -0,0 +1,58 @@
+package object
+
+import (
+	"sort"
+	"sync"
+)
+
+// Environment binds names to values. It is safe for use by concurrent
+// tasks.
+type Environment struct {
+	mu    sync.RWMutex
+	store map[string]Object
+	outer *Environment
+}
+
+func NewEnvironment() *Environment {
+	return &Environment{store: make(map[string]Object)}
+}
+
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	return env
+}
+
+func (e *Environment) Get(name string) (Object, bool) {
+	e.mu.RLock()
+	obj, ok := e.store[name]
+	e.mu.RUnlock()
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return obj, ok
+}
+
+func (e *Environment) Set(name string, val Object) Object {
+	e.mu.Lock()
+	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// Outer returns the enclosing environment, or nil for the outermost one.
+func (e *Environment) Outer() *Environment {
+	return e.outer
+}
+
+// Names returns the names bound directly in e, sorted.
+func (e *Environment) Names() []string {
+	e.mu.RLock()
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	e.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
@@ -1,11 +1,34 @@
 package object
 
-import "fmt"
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+)
 
 const (
-	INTEGER_OBJ = "INTEGER"
-	BOOLEAN_OBJ = "BOOLEAN"
-	NULL_OBJ    = "NULL"
+	INTEGER_OBJ      = "INTEGER"
+	BOOLEAN_OBJ      = "BOOLEAN"
+	NULL_OBJ         = "NULL"
+	STRING_OBJ       = "STRING"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	FUNCTION_OBJ     = "FUNCTION"
+	BUILTIN_OBJ      = "BUILTIN"
+	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	ERROR_OBJ        = "ERROR"
+	MODULE_OBJ       = "MODULE"
+	ERROR_VALUE_OBJ  = "ERROR_VALUE"
+	ITERATOR_OBJ     = "ITERATOR"
+	CHANNEL_OBJ      = "CHANNEL"
+	TASK_OBJ         = "TASK"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
 )
 
 type ObjectType string
@@ -41,3 +64,258 @@ func (n *Null) Type() ObjectType { return NULL_OBJ }
 func (n *Null) Inspect() string {
 	return "null"
 }
+
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// HashKey identifies a hashable object by type and value.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+// SortedPairs returns the pairs of h ordered by key: booleans, then
+// integers, then strings, each in their natural order. Hashes are iterated
+// in this order so that output does not vary between runs.
+func (h *Hash) SortedPairs() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair)
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		ki, kj := pairs[i].Key, pairs[j].Key
+		if ki.Type() != kj.Type() {
+			return ki.Type() < kj.Type()
+		}
+		if a, ok := ki.(*Integer); ok {
+			return a.Value < kj.(*Integer).Value
+		}
+		return ki.Inspect() < kj.Inspect()
+	})
+	return pairs
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+	for _, pair := range h.SortedPairs() {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+type Function struct {
+	Params     []*ast.Param
+	Generator  bool
+	ReturnType *ast.TypeAnnotation
+	Block      *ast.BlockStatement
+	Env        *Environment
+}
+
+func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if f.ReturnType != nil {
+		out.WriteString(" -> " + f.ReturnType.String())
+	}
+	out.WriteString(" {\n")
+	out.WriteString(f.Block.String())
+	out.WriteString("\n}")
+	return out.String()
+}
+
+// Quote is unevaluated code, made by quote and spliced into a macro's
+// expansion.
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// Macro is a macro defined by a top-level let. Its calls are replaced by
+// the code its body quotes before the program runs.
+type Macro struct {
+	Params []*ast.Identifier
+	Body   *ast.BlockStatement
+	Env    *Environment
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	params := []string{}
+	for _, p := range m.Params {
+		params = append(params, p.String())
+	}
+	return "macro(" + strings.Join(params, ", ") + ") {\n" + m.Body.String() + "\n}"
+}
+
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+type ReturnValue struct {
+	Value Object
+}
+
+func (r *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
+func (r *ReturnValue) Inspect() string  { return r.Value.Inspect() }
+
+type Error struct {
+	Message string
+	// Kind classifies the error for scripts catching it. It is empty for
+	// errors raised by the evaluator, and set by throw.
+	Kind string
+	// Trace lists the calls the error unwound, innermost first.
+	Trace []string
+	// Value is the value thrown, if it was not an error.
+	Value Object
+	// Cause is set when evaluation was stopped by the host rather than the
+	// script, such as when a limit is exceeded or its context is done.
+	// Such errors cannot be caught.
+	Cause error
+}
+
+func (e *Error) Type() ObjectType { return ERROR_OBJ }
+func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
+
+// ErrorKind returns Kind, or "RuntimeError" for errors raised by the
+// evaluator.
+func (e *Error) ErrorKind() string {
+	if e.Kind == "" {
+		return "RuntimeError"
+	}
+	return e.Kind
+}
+
+// ErrorValue is a caught error, as a value scripts can inspect and throw
+// again.
+type ErrorValue struct {
+	Err *Error
+}
+
+func (e *ErrorValue) Type() ObjectType { return ERROR_VALUE_OBJ }
+func (e *ErrorValue) Inspect() string  { return e.Err.ErrorKind() + ": " + e.Err.Message }
+
+// Iterator produces a sequence of values on demand, such as those yielded
+// by a generator.
+type Iterator struct {
+	// Next returns the next value, or false once there are none. An *Error
+	// ends the sequence.
+	Next func() (Object, bool)
+	// Close releases an iterator that will not be used up. It may be nil,
+	// and does nothing once the sequence has ended.
+	Close func()
+}
+
+func (i *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (i *Iterator) Inspect() string  { return "iterator" }
+
+// Channel passes values between tasks.
+type Channel struct {
+	C chan Object
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("channel(%d)", cap(c.C)) }
+
+// Task is a function call running on a goroutine of its own, started by
+// spawn.
+type Task struct {
+	// Done is closed once Result is set.
+	Done   chan struct{}
+	Result Object
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return "task" }
+
+// Module is an imported file. Its members are the file's exported
+// top-level bindings.
+type Module struct {
+	Path    string
+	Env     *Environment
+	Exports map[string]bool
+}
+
+// Member returns the exported binding name.
+func (m *Module) Member(name string) (Object, bool) {
+	if !m.Exports[name] {
+		return nil, false
+	}
+	return m.Env.Get(name)
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string  { return "module " + strconv.Quote(m.Path) }
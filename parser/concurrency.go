@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/token"
+)
+
+func (p *Parser) parseSpawnExpression() ast.Expression {
+	defer p.untrace(p.trace("parseSpawnExpression"))
+	exp := &ast.SpawnExpression{Token: p.currTok}
+	p.nextToken()
+	operand := p.parseExpression(PREFIX)
+	if operand == nil {
+		return nil
+	}
+	call, ok := operand.(*ast.CallExpression)
+	if !ok {
+		p.errorAt(operand.Pos(), fmt.Sprintf("spawn needs a function call, got %s", operand))
+		return nil
+	}
+	exp.Call = call
+	return exp
+}
+
+// parseSelectExpression parses select { case => body, ... }, where each
+// case is send(ch, value), receive(ch), receive(ch) as name, or _.
+func (p *Parser) parseSelectExpression() ast.Expression {
+	defer p.untrace(p.trace("parseSelectExpression"))
+	exp := &ast.SelectExpression{Token: p.currTok}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	hasDefault := false
+	for !p.peekTokenIs(token.RBRACE) {
+		if len(exp.Cases) > 0 {
+			if !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			if p.peekTokenIs(token.RBRACE) {
+				break
+			}
+		}
+		p.nextToken()
+		c := p.parseSelectCase()
+		if c == nil {
+			return nil
+		}
+		if c.IsDefault() {
+			if hasDefault {
+				p.errorAt(c.Token.Pos, "select has more than one default case")
+				return nil
+			}
+			hasDefault = true
+		}
+		exp.Cases = append(exp.Cases, c)
+	}
+	p.nextToken()
+	exp.End = p.currTok.Pos
+	if len(exp.Cases) == 0 {
+		p.errorAt(exp.Token.Pos, "select has no cases")
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	defer p.untrace(p.trace("parseSelectCase"))
+	c := &ast.SelectCase{Token: p.currTok}
+	switch {
+	case p.curTokenIs(token.IDENT) && p.currTok.Literal == "_":
+	case p.curTokenIs(token.IDENT) && p.currTok.Literal == "send":
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		p.nextToken()
+		c.Channel = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		p.nextToken()
+		c.Value = p.parseExpression(LOWEST)
+		if c.Channel == nil || c.Value == nil || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	case p.curTokenIs(token.IDENT) && p.currTok.Literal == "receive":
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		p.nextToken()
+		c.Channel = p.parseExpression(LOWEST)
+		if c.Channel == nil || !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+		if p.peekTokenIs(token.IDENT) && p.peekTok.Literal == "as" {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			c.Var = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+		}
+	default:
+		if p.curTokenIs(token.EOF) {
+			p.incomplete = true
+		}
+		p.errorAt(p.currTok.Pos, fmt.Sprintf("expected send, receive or _, got %s", p.currTok.Literal))
+		return nil
+	}
+	if !p.expectPeek(token.FATARROW) {
+		return nil
+	}
+	p.nextToken()
+	if c.Body = p.parseExpression(LOWEST); c.Body == nil {
+		return nil
+	}
+	return c
+}
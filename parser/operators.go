@@ -0,0 +1,242 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/token"
+)
+
+// Assoc is the associativity of an infix operator.
+type Assoc int
+
+const (
+	AssocLeft Assoc = iota
+	AssocRight
+)
+
+// Operator is an operator added to the language.
+type Operator struct {
+	Symbol string
+	// Prefix operators take one operand, binding like - and !; the others
+	// are infix.
+	Prefix bool
+	// Precedence and Assoc apply to infix operators.
+	Precedence int
+	Assoc      Assoc
+}
+
+// Operators holds the operators added to the language. Parsers sharing
+// one, through WithOperators, parse the operators added to it, including
+// those declared by the scripts they parse. Each operator is parsed as an
+// ast.InfixExpression or ast.PrefixExpression for the evaluator to apply.
+// Parsers may share it across goroutines.
+type Operators struct {
+	mu     sync.RWMutex
+	infix  map[string]Operator
+	prefix map[string]Operator
+}
+
+func NewOperators() *Operators {
+	return &Operators{infix: make(map[string]Operator), prefix: make(map[string]Operator)}
+}
+
+// Infix adds the infix operator symbol, made of the characters
+// !$%&*+-./<=>?@^|~. Its precedence ranges from 0 to 9, the built-in
+// operators being at 4 for == and !=, 5 for < and >, 6 for + and - and 7
+// for * and /. Adding it again changes its precedence and associativity.
+func (o *Operators) Infix(symbol string, prec int, assoc Assoc) error {
+	if err := checkSymbol(symbol); err != nil {
+		return err
+	}
+	if prec < 0 || prec > 9 {
+		return fmt.Errorf("precedence %d out of range 0 to 9", prec)
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.infix[symbol] = Operator{Symbol: symbol, Precedence: prec, Assoc: assoc}
+	return nil
+}
+
+// Prefix adds the prefix operator symbol, made of the same characters as
+// infix ones.
+func (o *Operators) Prefix(symbol string) error {
+	if err := checkSymbol(symbol); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.prefix[symbol] = Operator{Symbol: symbol, Prefix: true}
+	return nil
+}
+
+// Reset removes the operators added.
+func (o *Operators) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.infix = make(map[string]Operator)
+	o.prefix = make(map[string]Operator)
+}
+
+// List returns the operators added, infix ones first, each ordered by
+// symbol.
+func (o *Operators) List() []Operator {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	var ops []Operator
+	for _, m := range []map[string]Operator{o.infix, o.prefix} {
+		start := len(ops)
+		for _, op := range m {
+			ops = append(ops, op)
+		}
+		sort.Slice(ops[start:], func(i, j int) bool { return ops[start+i].Symbol < ops[start+j].Symbol })
+	}
+	return ops
+}
+
+// infixOperator returns the infix operator symbol, if added.
+func (o *Operators) infixOperator(symbol string) (Operator, bool) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	op, ok := o.infix[symbol]
+	return op, ok
+}
+
+func checkSymbol(symbol string) error {
+	if symbol == "" {
+		return fmt.Errorf("empty operator")
+	}
+	for i := 0; i < len(symbol); i++ {
+		if !lexer.IsOperatorChar(symbol[i]) {
+			return fmt.Errorf("operator %s: %q is not an operator character", symbol, symbol[i])
+		}
+	}
+	if tok := lexer.New(symbol).NextToken(); tok.Type != token.ILLEGAL && tok.Literal == symbol {
+		return fmt.Errorf("operator %s is built in", symbol)
+	}
+	return nil
+}
+
+// WithOperators makes the parser parse the operators in ops, and add those
+// declared by scripts to it.
+func WithOperators(ops *Operators) Option {
+	return func(p *Parser) { p.ops = ops }
+}
+
+// useOperator makes p parse op.
+func (p *Parser) useOperator(op Operator) {
+	p.l.AddOperator(op.Symbol)
+	if op.Prefix {
+		p.registerPrefix(token.TokenType(op.Symbol), p.parsePrefixExpression)
+	} else {
+		p.registerInfix(token.TokenType(op.Symbol), p.parseInfixExpression)
+	}
+}
+
+func (p *Parser) precedence(t token.TokenType) int {
+	if prec, ok := precedences[t]; ok {
+		return prec
+	}
+	if op, ok := p.ops.infixOperator(string(t)); ok {
+		return op.Precedence
+	}
+	return LOWEST
+}
+
+// rightPrecedence returns the precedence the right operand of the infix
+// operator t is parsed at, which lets right associative operators take an
+// operand using the same operator.
+func (p *Parser) rightPrecedence(t token.TokenType) int {
+	prec := p.precedence(t)
+	if op, ok := p.ops.infixOperator(string(t)); ok && op.Assoc == AssocRight {
+		prec--
+	}
+	return prec
+}
+
+// parseOperatorDeclaration parses infixl 6 <+> = value, or infixr, adding
+// the operator for the rest of the input.
+func (p *Parser) parseOperatorDeclaration() *ast.OperatorDeclaration {
+	defer p.untrace(p.trace("parseOperatorDeclaration"))
+	stmt := &ast.OperatorDeclaration{Token: p.currTok}
+	if p.depth > 0 {
+		p.errorAt(stmt.Token.Pos, "operators can only be declared at the top level")
+		return nil
+	}
+	p.nextToken()
+	prec, err := strconv.Atoi(p.currTok.Literal)
+	if err != nil || prec > 9 {
+		p.errorAt(p.currTok.Pos, fmt.Sprintf("precedence %s out of range 0 to 9", p.currTok.Literal))
+		return nil
+	}
+	stmt.Precedence = prec
+	p.nextToken()
+	pos := p.currTok.Pos
+	symbol := p.readSymbol()
+	if symbol == "" {
+		if p.curTokenIs(token.EOF) {
+			p.incomplete = true
+		}
+		p.errorAt(pos, fmt.Sprintf("expected an operator, got %s", p.currTok.Literal))
+		return nil
+	}
+	assoc := AssocLeft
+	if stmt.Token.Literal == "infixr" {
+		assoc = AssocRight
+	}
+	if err := p.ops.Infix(symbol, prec, assoc); err != nil {
+		p.errorAt(pos, err.Error())
+		return nil
+	}
+	p.useOperator(Operator{Symbol: symbol, Precedence: prec, Assoc: assoc})
+	stmt.Operator = symbol
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+	p.nextToken()
+	if stmt.Value = p.parseExpression(LOWEST); stmt.Value == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// readSymbol reads the operator symbol starting at the current token,
+// leaving its last token current. Until the operator is added, the lexer
+// splits it into the tokens it knows, which follow each other without
+// spaces.
+func (p *Parser) readSymbol() string {
+	if !isSymbol(p.currTok) {
+		return ""
+	}
+	var symbol strings.Builder
+	symbol.WriteString(p.currTok.Literal)
+	for {
+		end := p.currTok.Pos
+		end.Column += len(p.currTok.Literal)
+		if p.peekTok.Pos != end || !isSymbol(p.peekTok) {
+			return symbol.String()
+		}
+		p.nextToken()
+		symbol.WriteString(p.currTok.Literal)
+	}
+}
+
+func isSymbol(tok token.Token) bool {
+	if tok.Type == token.STRING || tok.Literal == "" {
+		return false
+	}
+	for i := 0; i < len(tok.Literal); i++ {
+		if !lexer.IsOperatorChar(tok.Literal[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/jarviliam/inti/ast"
 	"github.com/jarviliam/inti/lexer"
@@ -14,41 +15,74 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// Precedences of the built-in operators, from loosest to tightest. Infix
+// operators added with Operators take levels 0 to 9 on the same scale.
 const (
-	_ int = iota
-	LOWEST
-	EQUAL
-	LESSGREATER
-	SUM
-	PRODUCT
-	PREFIX
-	CALL
+	LOWEST      = -1
+	EQUAL       = 4
+	LESSGREATER = 5
+	SUM         = 6
+	PRODUCT     = 7
+	PREFIX      = 10
+	CALL        = 11
+	INDEX       = 12
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:      EQUAL,
-	token.NEQ:     EQUAL,
-	token.LT:      LESSGREATER,
-	token.GT:      LESSGREATER,
-	token.PLUS:    SUM,
-	token.MINUS:   SUM,
-	token.SLASH:   PRODUCT,
-	token.ASETRIK: PRODUCT,
-	token.LPAREN:  CALL,
+	token.EQ:       EQUAL,
+	token.NEQ:      EQUAL,
+	token.LT:       LESSGREATER,
+	token.GT:       LESSGREATER,
+	token.PLUS:     SUM,
+	token.MINUS:    SUM,
+	token.SLASH:    PRODUCT,
+	token.ASETRIK:  PRODUCT,
+	token.LPAREN:   CALL,
+	token.LBRACKET: INDEX,
+	token.DOT:      INDEX,
+}
+
+// Error is a syntax error found at Pos.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
 }
 
 type Parser struct {
 	l       *lexer.Lexer
 	currTok token.Token
 	peekTok token.Token
-	errors  []string
+	errors  []*Error
+	// incomplete is set when the input ends before a construct does.
+	incomplete bool
+	// depth counts the blocks being parsed; exports are only allowed at 0.
+	depth int
+	// loops counts the loops being parsed in the current function, outside
+	// of which break and continue are errors.
+	loops int
+	// ops holds the operators added to the language.
+	ops *Operators
+	// tracer, if set, is passed the parse functions entered and exited;
+	// traceLevel is their nesting.
+	tracer     func(TraceEvent)
+	traceLevel int
+	// fn is the function literal being parsed, which yield makes a
+	// generator.
+	fn *ast.FunctionLiteral
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
 
-func New(l *lexer.Lexer) *Parser {
-	p := &Parser{l: l, errors: []string{}}
+func New(l *lexer.Lexer, opts ...Option) *Parser {
+	p := &Parser{l: l, errors: []*Error{}}
+	for _, opt := range opts {
+		opt(p)
+	}
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseInteger)
@@ -56,10 +90,22 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
 	p.registerPrefix(token.FALSE, p.parseBoolean)
+	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
+	p.registerPrefix(token.TRY, p.parseTryExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
+	p.registerPrefix(token.SPAWN, p.parseSpawnExpression)
+	p.registerPrefix(token.SELECT, p.parseSelectExpression)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
 	p.registerInfix(token.SLASH, p.parseInfixExpression)
@@ -68,6 +114,12 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.NEQ, p.parseInfixExpression)
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
+	if p.ops == nil {
+		p.ops = NewOperators()
+	}
+	for _, op := range p.ops.List() {
+		p.useOperator(op)
+	}
 	p.nextToken()
 	p.nextToken()
 	return p
@@ -93,22 +145,79 @@ func (p *Parser) ParseProgram() *ast.Program {
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	defer p.untrace(p.trace("parseStatement"))
+	// a failed let must come back as a nil Statement, not a typed nil
 	switch p.currTok.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.THROW:
+		return p.parseThrowStatement()
+	case token.YIELD:
+		if stmt := p.parseYieldStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.FOR:
+		if stmt := p.parseForStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.BREAK, token.CONTINUE:
+		if stmt := p.parseBranchStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.EXPORT:
+		if stmt := p.parseExportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	case token.IDENT:
+		if (p.currTok.Literal == "infixl" || p.currTok.Literal == "infixr") && p.peekTokenIs(token.INT) {
+			if stmt := p.parseOperatorDeclaration(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
+		return p.parseExpressionStatement()
+	case token.IMPORT:
+		if !p.peekTokenIs(token.LBRACE) {
+			return p.parseExpressionStatement()
+		}
+		if stmt := p.parseImportStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
+	defer p.untrace(p.trace("parseLetStatement"))
 	stmt := &ast.LetStatement{Token: p.currTok}
-	if !p.expectPeek(token.IDENT) {
-		return nil
+	if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+		p.nextToken()
+		if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil {
+			return nil
+		}
+	} else {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Name = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			if stmt.Name.Type = p.parseTypeAnnotation(); stmt.Name.Type == nil {
+				return nil
+			}
+		}
 	}
-	stmt.Name = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -120,7 +229,72 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 	return stmt
 }
+
+func (p *Parser) parseExportStatement() *ast.LetStatement {
+	defer p.untrace(p.trace("parseExportStatement"))
+	pos := p.currTok.Pos
+	if !p.expectPeek(token.LET) {
+		return nil
+	}
+	stmt := p.parseLetStatement()
+	if stmt == nil {
+		return nil
+	}
+	if p.depth > 0 {
+		p.errorAt(pos, "export is only allowed at the top level")
+		return nil
+	}
+	stmt.Exported = true
+	return stmt
+}
+
+// parseImportStatement parses import { a, b as c } from "path". from and as
+// are only special here, so they remain usable as names.
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	defer p.untrace(p.trace("parseImportStatement"))
+	stmt := &ast.ImportStatement{Token: p.currTok}
+	p.nextToken()
+	for !p.peekTokenIs(token.RBRACE) {
+		if len(stmt.Specs) > 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		spec := &ast.ImportSpec{Name: &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}}
+		if p.peekTokenIs(token.IDENT) && p.peekTok.Literal == "as" {
+			p.nextToken()
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			spec.Alias = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+		}
+		stmt.Specs = append(stmt.Specs, spec)
+	}
+	p.nextToken()
+	if len(stmt.Specs) == 0 {
+		p.errorAt(p.currTok.Pos, "import lists no names")
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	if p.currTok.Literal != "from" {
+		p.errorAt(p.currTok.Pos, fmt.Sprintf("expected from, got %s", p.currTok.Literal))
+		return nil
+	}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = p.currTok.Literal
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	defer p.untrace(p.trace("parseReturnStatement"))
 	stmt := &ast.ReturnStatement{Token: p.currTok}
 	p.nextToken()
 	stmt.ReturnValue = p.parseExpression(LOWEST)
@@ -129,7 +303,77 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	}
 	return stmt
 }
+func (p *Parser) parseThrowStatement() *ast.ThrowStatement {
+	defer p.untrace(p.trace("parseThrowStatement"))
+	stmt := &ast.ThrowStatement{Token: p.currTok}
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseYieldStatement() *ast.YieldStatement {
+	defer p.untrace(p.trace("parseYieldStatement"))
+	stmt := &ast.YieldStatement{Token: p.currTok}
+	if p.fn == nil {
+		p.errorAt(stmt.Token.Pos, "yield outside of a function")
+		return nil
+	}
+	p.fn.Generator = true
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// parseForStatement parses for (x in xs) { }. in is only special here.
+func (p *Parser) parseForStatement() *ast.ForStatement {
+	defer p.untrace(p.trace("parseForStatement"))
+	stmt := &ast.ForStatement{Token: p.currTok}
+	if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Var = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	if p.currTok.Literal != "in" {
+		p.errorAt(p.currTok.Pos, fmt.Sprintf("expected in, got %s", p.currTok.Literal))
+		return nil
+	}
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	p.loops++
+	stmt.Body = p.parseBlockStatement()
+	p.loops--
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+func (p *Parser) parseBranchStatement() *ast.BranchStatement {
+	defer p.untrace(p.trace("parseBranchStatement"))
+	stmt := &ast.BranchStatement{Token: p.currTok}
+	if p.loops == 0 {
+		p.errorAt(stmt.Token.Pos, stmt.Token.Literal+" outside of a loop")
+		return nil
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	defer p.untrace(p.trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.currTok}
 	stmt.Expression = p.parseExpression(LOWEST)
 
@@ -156,12 +400,35 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, e := range p.errors {
+		msgs[i] = e.Msg
+	}
+	return msgs
+}
+
+// ErrorList returns the errors found so far along with their positions.
+func (p *Parser) ErrorList() []*Error {
 	return p.errors
 }
 
+// Incomplete reports whether parsing failed only because the input ended
+// early, for example inside an open brace or after an infix operator, so
+// that more input could complete it.
+func (p *Parser) Incomplete() bool {
+	return p.incomplete
+}
+
+func (p *Parser) errorAt(pos token.Position, msg string) {
+	p.errors = append(p.errors, &Error{Pos: pos, Msg: msg})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be : %s, got %s", t, p.peekTok.Type)
-	p.errors = append(p.errors, msg)
+	if p.peekTok.Type == token.EOF {
+		p.incomplete = true
+	}
+	p.errorAt(p.peekTok.Pos, msg)
 }
 
 func (p *Parser) registerPrefix(tokentype token.TokenType, fn prefixParseFn) {
@@ -172,6 +439,7 @@ func (p *Parser) registerInfix(tokentype token.TokenType, fn infixParseFn) {
 }
 
 func (p *Parser) parseExpression(prec int) ast.Expression {
+	defer p.untrace(p.trace("parseExpression"))
 	pre := p.prefixParseFns[p.currTok.Type]
 	if pre == nil {
 		p.noPrefixParseFnError(p.currTok.Type)
@@ -190,6 +458,7 @@ func (p *Parser) parseExpression(prec int) ast.Expression {
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
+	defer p.untrace(p.trace("parsePrefixExpression"))
 	exp := &ast.PrefixExpression{
 		Token:    p.currTok,
 		Operator: p.currTok.Literal,
@@ -200,33 +469,47 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 	return exp
 }
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseInfixExpression"))
 	exp := &ast.InfixExpression{
 		Token:    p.currTok,
 		Operator: p.currTok.Literal,
 		Left:     left,
 	}
-	prec := p.curPrecedence()
+	prec := p.rightPrecedence(p.currTok.Type)
 	p.nextToken()
 	exp.Right = p.parseExpression(prec)
 	return exp
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	defer p.untrace(p.trace("parseIdentifier"))
 	return &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
 }
 
 func (p *Parser) parseInteger() ast.Expression {
+	defer p.untrace(p.trace("parseInteger"))
 	lit := &ast.IntegerLiteral{Token: p.currTok}
 	value, err := strconv.ParseInt(p.currTok.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as int", p.currTok.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.currTok.Pos, msg)
 		return nil
 	}
 	lit.Value = value
 	return lit
 }
+func (p *Parser) parseGroupedExpression() ast.Expression {
+	defer p.untrace(p.trace("parseGroupedExpression"))
+	p.nextToken()
+	exp := p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
+	defer p.untrace(p.trace("parseIfExpression"))
 	exp := &ast.IfExpression{Token: p.currTok}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
@@ -250,9 +533,47 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	}
 	return exp
 }
+func (p *Parser) parseTryExpression() ast.Expression {
+	defer p.untrace(p.trace("parseTryExpression"))
+	exp := &ast.TryExpression{Token: p.currTok}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Block = p.parseBlockStatement()
+	if p.peekTokenIs(token.CATCH) {
+		p.nextToken()
+		if !p.expectPeek(token.LPAREN) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		exp.Param = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+		if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Catch = p.parseBlockStatement()
+	}
+	if p.peekTokenIs(token.FINALLY) {
+		p.nextToken()
+		if !p.expectPeek(token.LBRACE) {
+			return nil
+		}
+		exp.Finally = p.parseBlockStatement()
+	}
+	if exp.Catch == nil && exp.Finally == nil {
+		if p.peekTokenIs(token.EOF) {
+			p.incomplete = true
+		}
+		p.errorAt(exp.Token.Pos, "try needs catch or finally")
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	defer p.untrace(p.trace("parseBlockStatement"))
 	block := &ast.BlockStatement{Token: p.currTok}
 	block.Statements = []ast.Statement{}
+	p.depth++
+	defer func() { p.depth-- }()
 
 	p.nextToken()
 
@@ -263,55 +584,223 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	if p.curTokenIs(token.EOF) {
+		p.incomplete = true
+		p.errorAt(p.currTok.Pos, "expected next token to be : }, got EOF")
+	}
+	block.End = p.currTok.Pos
 	return block
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFunctionLiteral"))
 	fl := &ast.FunctionLiteral{Token: p.currTok}
 	if !p.expectPeek(token.LPAREN) {
 		return nil
 	}
 	fl.Params = p.parseFNParams()
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		if fl.ReturnType = p.parseTypeAnnotation(); fl.ReturnType == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
+	loops, fn := p.loops, p.fn
+	p.loops, p.fn = 0, fl
 	fl.Block = p.parseBlockStatement()
+	p.loops, p.fn = loops, fn
 	return fl
 }
 
-func (p *Parser) parseFNParams() []*ast.Identifier {
-	i := []*ast.Identifier{}
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseMacroLiteral"))
+	ml := &ast.MacroLiteral{Token: p.currTok, Params: []*ast.Identifier{}}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	for !p.peekTokenIs(token.RPAREN) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		ml.Params = append(ml.Params, &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal})
+		if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	p.nextToken()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	loops, fn := p.loops, p.fn
+	p.loops, p.fn = 0, nil
+	ml.Body = p.parseBlockStatement()
+	p.loops, p.fn = loops, fn
+	return ml
+}
+
+func (p *Parser) parseFNParams() []*ast.Param {
+	defer p.untrace(p.trace("parseFNParams"))
+	i := []*ast.Param{}
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		return i
 	}
-	p.nextToken()
-	ident := &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
-	i = append(i, ident)
-	for p.peekTokenIs(token.COMMA) {
+	for {
 		p.nextToken()
+		param := p.parseParam()
+		if param == nil {
+			return nil
+		}
+		if n := len(i); n > 0 && i[n-1].Default != nil && param.Default == nil && !param.Variadic {
+			p.errorAt(param.Pattern.Pos(), "a parameter without a default cannot follow one with a default")
+			return nil
+		}
+		i = append(i, param)
+		if param.Variadic && !p.peekTokenIs(token.RPAREN) {
+			p.errorAt(p.peekTok.Pos, "a variadic parameter must come last")
+			return nil
+		}
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.nextToken()
-		ident := &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
-		i = append(i, ident)
 	}
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
 	return i
 }
+
+// parseParam parses a parameter: a name, with an optional type, or an
+// array or hash pattern destructuring the argument, then an optional
+// default. ...name makes a variadic parameter.
+func (p *Parser) parseParam() *ast.Param {
+	defer p.untrace(p.trace("parseParam"))
+	if p.curTokenIs(token.ELLIPSIS) {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		return &ast.Param{Pattern: &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}, Variadic: true}
+	}
+	param := &ast.Param{}
+	if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+		param.Pattern = p.parsePattern()
+	} else {
+		param.Pattern = p.parseParamName()
+	}
+	if param.Pattern == nil {
+		return nil
+	}
+	if p.peekTokenIs(token.ASSIGN) {
+		p.nextToken()
+		p.nextToken()
+		if param.Default = p.parseExpression(LOWEST); param.Default == nil {
+			return nil
+		}
+	}
+	return param
+}
+
+func (p *Parser) parseParamName() ast.Pattern {
+	defer p.untrace(p.trace("parseParamName"))
+	ident := &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		ident.Type = p.parseTypeAnnotation()
+	}
+	return ident
+}
+
+// typeNames are the names accepted in type annotations.
+var typeNames = map[string]bool{
+	"int":      true,
+	"bool":     true,
+	"string":   true,
+	"array":    true,
+	"hash":     true,
+	"fn":       true,
+	"null":     true,
+	"iterator": true,
+}
+
+// parseTypeAnnotation parses the type name following a ':' or '->'.
+func (p *Parser) parseTypeAnnotation() *ast.TypeAnnotation {
+	defer p.untrace(p.trace("parseTypeAnnotation"))
+	p.nextToken()
+	isName := p.curTokenIs(token.IDENT) || p.curTokenIs(token.FUNCTION)
+	if !isName || !typeNames[p.currTok.Literal] {
+		if p.curTokenIs(token.EOF) {
+			p.incomplete = true
+		}
+		msg := fmt.Sprintf("unknown type %q", p.currTok.Literal)
+		p.errorAt(p.currTok.Pos, msg)
+		return nil
+	}
+	return &ast.TypeAnnotation{Token: p.currTok, Name: p.currTok.Literal}
+}
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseCallExpression"))
 	exp := &ast.CallExpression{Token: p.currTok, Function: function}
 	exp.Args = p.parseCallArguments()
 	return exp
 }
+
+// parseCallArguments parses arguments, which may be spread, as in ...xs,
+// or named, as in b: 3. Named arguments come last.
 func (p *Parser) parseCallArguments() []ast.Expression {
+	defer p.untrace(p.trace("parseCallArguments"))
 	args := []ast.Expression{}
-
 	if p.peekTokenIs(token.RPAREN) {
 		p.nextToken()
 		return args
 	}
+	named := false
+	for {
+		p.nextToken()
+		var arg ast.Expression
+		switch {
+		case p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON):
+			name := &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+			p.nextToken()
+			p.nextToken()
+			arg = &ast.NamedArgument{Name: name, Value: p.parseExpression(LOWEST)}
+			named = true
+		case named:
+			p.errorAt(p.currTok.Pos, "positional argument after named argument")
+			return nil
+		case p.curTokenIs(token.ELLIPSIS):
+			spread := &ast.SpreadExpression{Token: p.currTok}
+			p.nextToken()
+			spread.Value = p.parseExpression(LOWEST)
+			arg = spread
+		default:
+			arg = p.parseExpression(LOWEST)
+		}
+		args = append(args, arg)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return args
+}
+
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	defer p.untrace(p.trace("parseExpressionList"))
+	args := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
+		p.nextToken()
+		return args
+	}
 
 	p.nextToken()
 	args = append(args, p.parseExpression(LOWEST))
@@ -321,30 +810,100 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		p.nextToken()
 		args = append(args, p.parseExpression(LOWEST))
 	}
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 	return args
 }
 
-func (p *Parser) parseBoolean() ast.Expression {
-	return &ast.Boolean{Token: p.currTok, Value: p.curTokenIs(token.TRUE)}
+func (p *Parser) parseStringLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseStringLiteral"))
+	return &ast.StringLiteral{Token: p.currTok, Value: p.currTok.Literal}
 }
 
-func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekTok.Type]; ok {
-		return p
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseArrayLiteral"))
+	array := &ast.ArrayLiteral{Token: p.currTok}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+	return array
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseHashLiteral"))
+	hash := &ast.HashLiteral{Token: p.currTok}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashPair{Key: key, Value: value})
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return hash
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseIndexExpression"))
+	exp := &ast.IndexExpression{Token: p.currTok, Left: left}
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return exp
+}
+
+func (p *Parser) parseImportExpression() ast.Expression {
+	defer p.untrace(p.trace("parseImportExpression"))
+	exp := &ast.ImportExpression{Token: p.currTok}
+	if !p.expectPeek(token.STRING) {
+		return nil
 	}
-	return LOWEST
+	exp.Path = p.currTok.Literal
+	return exp
 }
-func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.currTok.Type]; ok {
-		return p
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseMemberExpression"))
+	exp := &ast.MemberExpression{Token: p.currTok, Object: object}
+	if !p.expectPeek(token.IDENT) {
+		return nil
 	}
-	return LOWEST
+	exp.Member = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+	return exp
+}
+
+func (p *Parser) parseBoolean() ast.Expression {
+	defer p.untrace(p.trace("parseBoolean"))
+	return &ast.Boolean{Token: p.currTok, Value: p.curTokenIs(token.TRUE)}
+}
+
+func (p *Parser) peekPrecedence() int {
+	return p.precedence(p.peekTok.Type)
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	msg := fmt.Sprintf("no prefix parse func for %s", t)
-	p.errors = append(p.errors, msg)
+	switch t {
+	case token.EOF:
+		p.incomplete = true
+	case token.ILLEGAL:
+		msg = fmt.Sprintf("illegal token %s", p.currTok.Literal)
+		if strings.HasPrefix(p.currTok.Literal, `"`) {
+			// strings run to the end of the input when unterminated
+			msg = "unterminated string"
+			p.incomplete = true
+		}
+	}
+	p.errorAt(p.currTok.Pos, msg)
 }
@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/jarviliam/inti/ast"
@@ -304,6 +306,22 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a * add(b * c) + d",
 			"((a * add((b * c))) + d)",
 		},
+		{
+			"1 + (2 + 3) + 4",
+			"((1 + (2 + 3)) + 4)",
+		},
+		{
+			"-(5 + 5)",
+			"(-(5 + 5))",
+		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])),(b[1]),(2 * ([1, 2][1])))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -438,8 +456,8 @@ func TestFNLiteralExpression(t *testing.T) {
 	if len(fl.Params) != 2 {
 		t.Fatalf("fl params not 2 : %d", len(fl.Params))
 	}
-	testLiteralExpression(t, fl.Params[0], "x")
-	testLiteralExpression(t, fl.Params[1], "y")
+	testLiteralExpression(t, fl.Params[0].Pattern.(*ast.Identifier), "x")
+	testLiteralExpression(t, fl.Params[1].Pattern.(*ast.Identifier), "y")
 
 	if len(fl.Block.Statements) != 1 {
 		t.Fatalf("body size not 1 : %d", len(fl.Block.Statements))
@@ -480,10 +498,58 @@ func TestFNParamsParsing(t *testing.T) {
 		}
 
 		for i, id := range tC.expect {
-			testLiteralExpression(t, fn.Params[i], id)
+			testLiteralExpression(t, fn.Params[i].Pattern.(*ast.Identifier), id)
 		}
 	}
 }
+func TestTypeAnnotations(t *testing.T) {
+	testCases := []struct {
+		in     string
+		expect string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let f = fn(a: int, b: string) -> bool { true };", "let f = fn(a: int,b: string) -> bool true;"},
+		{"let f = fn(a, b: fn) { a };", "let f = fn(a,b: fn)a;"},
+		{"fn() -> null { }", "fn() -> null "},
+	}
+	for _, tC := range testCases {
+		l := lexer.New(tC.in)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserError(t, p)
+
+		if program.String() != tC.expect {
+			t.Errorf("expected %q; got %q", tC.expect, program.String())
+		}
+	}
+
+	l := lexer.New("fn(a: int, b: string) -> bool { true }")
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserError(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	a, b := fn.Params[0].Pattern.(*ast.Identifier), fn.Params[1].Pattern.(*ast.Identifier)
+	if a.Type == nil || a.Type.Name != "int" {
+		t.Errorf("param a annotation wrong. got=%+v", a.Type)
+	}
+	if b.Type == nil || b.Type.Name != "string" {
+		t.Errorf("param b annotation wrong. got=%+v", b.Type)
+	}
+	if fn.ReturnType == nil || fn.ReturnType.Name != "bool" {
+		t.Errorf("return annotation wrong. got=%+v", fn.ReturnType)
+	}
+}
+
+func TestUnknownTypeAnnotation(t *testing.T) {
+	l := lexer.New("let x: integer = 5;")
+	p := New(l)
+	p.ParseProgram()
+	errors := p.Errors()
+	if len(errors) == 0 || errors[0] != `unknown type "integer"` {
+		t.Errorf("expected unknown type error. got=%v", errors)
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := `add(1,2*3,4+5)`
 
@@ -519,6 +585,465 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Args[2], 4, "+", 5)
 }
 
+func TestStringLiteralExpression(t *testing.T) {
+	input := `"hello world";`
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserError(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
+func TestArrayLiteralParsing(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserError(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestHashLiteralParsing(t *testing.T) {
+	testCases := []struct {
+		in     string
+		expect map[string]int64
+	}{
+		{in: `{}`, expect: map[string]int64{}},
+		{in: `{"one": 1, "two": 2, "three": 3}`, expect: map[string]int64{"one": 1, "two": 2, "three": 3}},
+	}
+	for _, tC := range testCases {
+		l := lexer.New(tC.in)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserError(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		hash, ok := stmt.Expression.(*ast.HashLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.HashLiteral. got=%T", stmt.Expression)
+		}
+		if len(hash.Pairs) != len(tC.expect) {
+			t.Fatalf("hash has wrong number of pairs. got=%d", len(hash.Pairs))
+		}
+		for _, pair := range hash.Pairs {
+			key, ok := pair.Key.(*ast.StringLiteral)
+			if !ok {
+				t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+				continue
+			}
+			testIntegerLiteral(t, pair.Value, tC.expect[key.Value])
+		}
+	}
+}
+
+func TestIndexExpressionParsing(t *testing.T) {
+	input := "myArray[1 + 1]"
+
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserError(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	if !testIdentifier(t, exp.Left, "myArray") {
+		return
+	}
+	testInfixExpression(t, exp.Index, 1, "+", 1)
+}
+
+func TestImportAndMemberParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = import "lib/math";`, `let m = import "lib/math";`},
+		{`m.add(1, 2)`, `(m.add)(1,2)`},
+		{`(import "a").b.c`, `((import "a".b).c)`},
+		{`-m.x * 2`, `((-(m.x)) * 2)`},
+		{`m.xs[0]`, `((m.xs)[0])`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	p := New(lexer.New(`m.1`))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for a non-identifier member")
+	}
+}
+
+func TestExportAndImportStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`export let x = 1;`, `export let x = 1;`},
+		{`import { a } from "mod"`, `import { a } from "mod";`},
+		{`import {a, b as c, from} from "lib/mod";`, `import { a, b as c, from } from "lib/mod";`},
+		{`let from = 1; let as = from;`, `let from = 1;let as = from;`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn() { export let x = 1; }`, "1:8: export is only allowed at the top level"},
+		{`export fn() {}`, "1:8: expected next token to be : LET, got FUNCTION"},
+		{`import {} from "mod"`, "1:9: import lists no names"},
+		{`import { a } of "mod"`, "1:14: expected from, got of"},
+		{`import { a b } from "mod"`, "1:12: expected next token to be : ,, got IDENT"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTryThrowAndLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`throw "x"`, `throw "x";`},
+		{`try { f() } catch (e) { e.message }`, `try f()catch(e) (e.message)`},
+		{`try { f() } finally { g() }`, `try f()finally g()`},
+		{`let x = try { 1 } catch (e) { 2 } finally { 3 };`, `let x = try 1catch(e) 2finally 3;`},
+		{`for (x in xs) { if (x) { break; } continue }`, `for(x in xs) ifx break;continue;`},
+		{`fn(xs) { for (x in xs) { fn() { x } } }`, `fn(xs)for(x in xs) fn()x`},
+		{`let in = 1; for (x in [in]) {}`, `let in = 1;for(x in [in]) `},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`try { 1 }`, "1:1: try needs catch or finally"},
+		{`try { 1 } catch { 2 }`, "1:17: expected next token to be : (, got {"},
+		{`break`, "1:1: break outside of a loop"},
+		{`for (x in xs) { fn() { continue } }`, "1:24: continue outside of a loop"},
+		{`for (x of xs) {}`, "1:8: expected in, got of"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) { 1 => "one", _ => "other" }`, `match (x) { 1 => "one", _ => "other" }`},
+		{`match (xs) { [] => 0, [h, ...t] if h > 1 => h, [_, -2] => 1, }`, `match (xs) { [] => 0, [h, ...t] if (h > 1) => h, [_, -2] => 1 }`},
+		{`match (r) { {"name": n, "tags": [t]} => n + t, {true: "x"} => 0 }`, `match (r) { {"name": n, "tags": [t]} => (n + t), {true: "x"} => 0 }`},
+		{`match (x) { [...rest] => rest }`, `match (x) { [...rest] => rest }`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`match (x) {}`, "1:1: match has no arms"},
+		{`match (x) { 1 + 2 => 3 }`, "1:15: expected next token to be : =>, got +"},
+		{`match (x) { [...t, h] => 1 }`, "1:18: a rest pattern must come last"},
+		{`match (x) { {[1]: 1} => 1 }`, "1:14: hash pattern keys must be names or literals, got ["},
+		{`match (x) { fn => 1 }`, "1:13: expected a pattern, got FUNCTION"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let [a, b, ...rest] = xs;`, `let [a, b, ...rest] = xs;`},
+		{`let {name, age: years, "k": [k]} = person`, `let {name, age: years, "k": [k]} = person;`},
+		{`let {name: name} = p;`, `let {name: name} = p;`},
+		{`let f = fn([x, y], {z}, w: int) { x }`, `let f = fn([x, y],{z},w: int)x;`},
+		{`export let [a, _] = [1, 2];`, `export let [a, _] = [1, 2];`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	// patterns print as they are written
+	for _, input := range []string{`let [a, [b], ...c] = x;`, `let {a, b: [c], 1: _, "d": e} = x;`} {
+		if got := parseSingle(t, input).String(); got != input {
+			t.Errorf("%q: did not round trip, got %q", input, got)
+		}
+	}
+
+	let := parseSingle(t, `let {name, age: years} = p;`).(*ast.LetStatement)
+	if names := let.Names(); len(names) != 2 || names[0].Value != "name" || names[1].Value != "years" {
+		t.Errorf("wrong names bound %v", names)
+	}
+}
+
+func TestYieldStatement(t *testing.T) {
+	program := New(lexer.New(`fn(n) { yield n; let f = fn() { n }; yield f() + 1 }`)).ParseProgram()
+	fl := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if !fl.Generator {
+		t.Errorf("function yielding is not a generator")
+	}
+	if got := fl.Block.String(); got != `yield n;let f = fn()n;yield (f() + 1);` {
+		t.Errorf("wrong body. got=%q", got)
+	}
+	inner := fl.Block.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if inner.Generator {
+		t.Errorf("function not yielding itself is a generator")
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`yield 1`, "1:1: yield outside of a function"},
+		{`fn() { let x = yield 1 }`, "1:16: no prefix parse func for YIELD"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestSpawnAndSelect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn f(1)`, `spawn f(1)`},
+		{`spawn f(1)(2) + 1`, `(spawn f(1)(2) + 1)`},
+		{`select { receive(c) as x => x, send(d, 1) => 2, receive(e) => 3, _ => 4 }`,
+			`select { receive(c) as x => x, send(d, 1) => 2, receive(e) => 3, _ => 4 }`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`spawn f`, "1:7: spawn needs a function call, got f"},
+		{`select {}`, "1:1: select has no cases"},
+		{`select { _ => 1, _ => 2 }`, "1:18: select has more than one default case"},
+		{`select { wait(c) => 1 }`, "1:10: expected send, receive or _, got wait"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestMacroLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`macro(x, y) { x + y; }`, `macro(x,y)(x + y)`},
+		{`let m = macro() { quote(1) };`, `let m = macro()quote(1);`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`macro(x, 1) { x }`, "1:10: expected next token to be : IDENT, got INT"},
+		{`macro(x y) { x }`, "1:9: expected next token to be : ,, got IDENT"},
+		{`fn() { macro() { yield 1 } }`, "1:18: yield outside of a function"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestFunctionArguments(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(a, b = 2, ...rest) { a }`, `fn(a,b = 2,...rest)a`},
+		{`fn([x] = [1], y: int = 2) { x }`, `fn([x] = [1],y: int = 2)x`},
+		{`f(1, ...xs, b: 3, c: g(4))`, `f(1,...xs,b: 3,c: g(4))`},
+		{`f(...[1, 2])`, `f(...[1, 2])`},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, got)
+		}
+	}
+
+	fl := parseSingle(t, `fn(a, ...r) {}`).(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fl.Params[0].Variadic || !fl.Params[1].Variadic {
+		t.Errorf("wrong variadic params %v", fl.Params)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fn(...rest, a) {}`, "1:11: a variadic parameter must come last"},
+		{`fn(a = 1, b) {}`, "1:11: a parameter without a default cannot follow one with a default"},
+		{`fn(...[a]) {}`, "1:7: expected next token to be : IDENT, got ["},
+		{`f(a: 1, 2)`, "1:9: positional argument after named argument"},
+		{`f(a: 1, ...xs)`, "1:9: positional argument after named argument"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func parseSingle(t *testing.T, input string) ast.Statement {
+	p := New(lexer.New(input))
+	program := p.ParseProgram()
+	checkParserError(t, p)
+	if len(program.Statements) != 1 {
+		t.Fatalf("%q: expected 1 statement, got %d", input, len(program.Statements))
+	}
+	return program.Statements[0]
+}
+
 func checkParserError(t *testing.T, p *Parser) {
 	err := p.Errors()
 	if len(err) == 0 {
@@ -624,3 +1149,212 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, op
 	}
 	return true
 }
+
+func TestOperatorDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infixl 6 <+> = f; a <+> b * c <+> d", "infixl 6 <+> = f;((a <+> (b * c)) <+> d)"},
+		{"infixr 8 ** = f; -a ** b ** c * d", "infixr 8 ** = f;(((-a) ** (b ** c)) * d)"},
+		{"infixl 0 |> = f; a + 1 |> g == h |> k", "infixl 0 |> = f;(((a + 1) |> (g == h)) |> k)"},
+		{"infixl 9 <$> = f; infixl 1 $ = g; a $ b <$> c", "infixl 9 <$> = f;infixl 1 $ = g;(a $ (b <$> c))"},
+		{"let infixl = 1; infixl + 2", "let infixl = 1;(infixl + 2)"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserError(t, p)
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong program. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+
+	// operators added to a shared table are parsed by later parsers
+	ops := NewOperators()
+	if err := ops.Prefix("√"); err == nil {
+		t.Errorf("expected a symbol of non-operator characters to be refused")
+	}
+	if err := ops.Prefix("~"); err != nil {
+		t.Fatal(err)
+	}
+	New(lexer.New("infixr 3 ++ = f"), WithOperators(ops)).ParseProgram()
+	p := New(lexer.New("~a ++ b ++ c"), WithOperators(ops))
+	program := p.ParseProgram()
+	checkParserError(t, p)
+	if got := program.String(); got != "((~a) ++ (b ++ c))" {
+		t.Errorf("wrong program with shared operators. got=%q", got)
+	}
+	if got := fmt.Sprint(ops.List()); got != "[{++ false 3 1} {~ true 0 0}]" {
+		t.Errorf("wrong operators. got=%s", got)
+	}
+
+	errTests := []struct {
+		input    string
+		expected string
+	}{
+		{"infixl 10 <+> = f", "1:8: precedence 10 out of range 0 to 9"},
+		{"infixl 6 + = f", "1:10: operator + is built in"},
+		{"infixl 6 x = f", "1:10: expected an operator, got x"},
+		{"infixl 6 < + = f", "1:10: operator < is built in"},
+		{"fn() { infixl 6 <+> = f }", "1:8: operators can only be declared at the top level"},
+		{"a <+> b; infixl 6 <+> = f", "1:4: no prefix parse func for +"},
+	}
+	for _, tt := range errTests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		errs := p.ErrorList()
+		if len(errs) == 0 {
+			t.Errorf("%q: expected an error", tt.input)
+			continue
+		}
+		if got := errs[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestTrace(t *testing.T) {
+	var out bytes.Buffer
+	var events []TraceEvent
+	p := New(lexer.New("-x"), WithTrace(&out), WithTraceEvents(func(ev TraceEvent) {
+		events = append(events, ev)
+	}))
+	p.ParseProgram()
+	checkParserError(t, p)
+
+	expected := `BEGIN parseStatement
+	BEGIN parseExpressionStatement
+		BEGIN parseExpression
+			BEGIN parsePrefixExpression
+				BEGIN parseExpression
+					BEGIN parseIdentifier
+					END parseIdentifier
+				END parseExpression
+			END parsePrefixExpression
+		END parseExpression
+	END parseExpressionStatement
+END parseStatement
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	if len(events) != strings.Count(expected, "\n") {
+		t.Fatalf("wrong number of events. got=%d", len(events))
+	}
+	ev := events[5]
+	if ev.Kind != TraceEnter || ev.Func != "parseIdentifier" || ev.Depth != 6 || ev.Token.Literal != "x" || ev.Token.Pos.Column != 2 {
+		t.Errorf("wrong event. got=%+v", ev)
+	}
+	if last := events[len(events)-1]; last.Kind != TraceExit || last.Depth != 1 {
+		t.Errorf("wrong last event. got=%+v", last)
+	}
+
+	// parsers trace independently
+	var other bytes.Buffer
+	New(lexer.New("1"), WithTrace(&other)).ParseProgram()
+	if !strings.HasPrefix(other.String(), "BEGIN parseStatement\n") {
+		t.Errorf("second parser's trace is nested. got=%q", other.String())
+	}
+}
+
+func TestTraceCoverage(t *testing.T) {
+	input := `infixl 6 <+> = fn([a, ...b], {"c": c}, d: int, e = 1, ...f) -> int {
+	let g = match (a) { 1 => try { h(1, [2]) } catch (x) { x }, _ => c };
+	select { receive(d) as y => y, _ => 0 }
+}`
+	entered := make(map[string]int)
+	p := New(lexer.New(input), WithTraceEvents(func(ev TraceEvent) {
+		if ev.Kind == TraceEnter {
+			entered[ev.Func]++
+		} else {
+			entered[ev.Func]--
+		}
+	}))
+	p.ParseProgram()
+	checkParserError(t, p)
+
+	// the functions parsing each construct are traced, and exited as
+	// often as they are entered
+	for _, fn := range []string{
+		"parseOperatorDeclaration", "parseFunctionLiteral", "parseFNParams", "parseParam",
+		"parseParamName", "parseArrayPattern", "parseHashPattern", "parseTypeAnnotation",
+		"parseMatchExpression", "parsePattern", "parseLiteralPattern", "parseTryExpression",
+		"parseCallArguments", "parseExpressionList", "parseSelectExpression", "parseSelectCase",
+	} {
+		if _, ok := entered[fn]; !ok {
+			t.Errorf("%s was not traced", fn)
+		}
+	}
+	for fn, n := range entered {
+		if n != 0 {
+			t.Errorf("%s entered %d more times than exited", fn, n)
+		}
+	}
+}
+
+func TestPartialProgramString(t *testing.T) {
+	// programs that fail to parse can still be printed
+	inputs := []string{
+		"let add = fn(a: int, b = 2, ...rest) -",
+		"a +",
+		"return -",
+		"yield -",
+		"let [a, b] = -",
+	}
+	for _, input := range inputs {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.ErrorList()) == 0 {
+			t.Errorf("%q: expected an error", input)
+		}
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Errorf("%q: String panicked: %v", input, r)
+				}
+			}()
+			_ = program.String()
+		}()
+	}
+}
+
+func TestIncompleteInput(t *testing.T) {
+	tests := []struct {
+		input      string
+		incomplete bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) { a +", true},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{`{"a": 1`, true},
+		{"1 +", true},
+		{`"abc`, true},
+		{"let x", true},
+		{"fn(x:", true},
+		{"if (x) { 1 } else {", true},
+		{"try { 1 }", true},
+		{"try { 1 } catch (e) {", true},
+		{"for (x in xs) {", true},
+		{"match (x) {", true},
+		{"match (x) { [1,", true},
+		{"match (x) { 1 => 2", true},
+		{"let = 5;", false},
+		{"1 + )", false},
+		{"{ 1 }", false},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if p.Incomplete() != tt.incomplete {
+			t.Errorf("%q: Incomplete() = %t, want %t (errors %v)", tt.input, p.Incomplete(), tt.incomplete, p.Errors())
+		}
+		if tt.incomplete && len(p.Errors()) == 0 {
+			t.Errorf("%q: incomplete input parsed without errors", tt.input)
+		}
+	}
+}
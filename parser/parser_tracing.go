@@ -2,31 +2,83 @@ package parser
 
 import (
 	"fmt"
+	"io"
 	"strings"
-)
 
-var traceL int = 0
+	"github.com/jarviliam/inti/token"
+)
 
 const traceIndentPH string = "\t"
 
-func indentLevel() string {
-	return strings.Repeat(traceIndentPH, traceL-1)
+// TraceKind says whether a TraceEvent enters or exits a parse function.
+type TraceKind int
+
+const (
+	TraceEnter TraceKind = iota
+	TraceExit
+)
+
+func (k TraceKind) String() string {
+	if k == TraceExit {
+		return "exit"
+	}
+	return "enter"
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", indentLevel(), fs)
+// TraceEvent is a parse function being entered or exited.
+type TraceEvent struct {
+	Kind TraceKind
+	Func string
+	// Depth is the nesting of the parse functions being traced, from 1.
+	Depth int
+	// Token is the current token as the function is entered or exited.
+	Token token.Token
 }
 
-func incIdent() { traceL = traceL + 1 }
-func decIdent() { traceL = traceL - 1 }
+// Option configures a Parser.
+type Option func(*Parser)
+
+// WithTrace makes the parser print the parse functions it enters and exits
+// to w, indented by their nesting.
+func WithTrace(w io.Writer) Option {
+	return WithTraceEvents(func(ev TraceEvent) {
+		verb := "BEGIN"
+		if ev.Kind == TraceExit {
+			verb = "END"
+		}
+		fmt.Fprintf(w, "%s%s %s\n", strings.Repeat(traceIndentPH, ev.Depth-1), verb, ev.Func)
+	})
+}
+
+// WithTraceEvents passes fn an event for each parse function the parser
+// enters and exits, for tools rendering the parse as a timeline.
+func WithTraceEvents(fn func(TraceEvent)) Option {
+	return func(p *Parser) {
+		if prev := p.tracer; prev != nil {
+			p.tracer = func(ev TraceEvent) {
+				prev(ev)
+				fn(ev)
+			}
+			return
+		}
+		p.tracer = fn
+	}
+}
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+// trace reports entering fn, for use as defer p.untrace(p.trace("fn")).
+func (p *Parser) trace(fn string) string {
+	if p.tracer == nil {
+		return fn
+	}
+	p.traceLevel++
+	p.tracer(TraceEvent{Kind: TraceEnter, Func: fn, Depth: p.traceLevel, Token: p.currTok})
+	return fn
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+func (p *Parser) untrace(fn string) {
+	if p.tracer == nil {
+		return
+	}
+	p.tracer(TraceEvent{Kind: TraceExit, Func: fn, Depth: p.traceLevel, Token: p.currTok})
+	p.traceLevel--
 }
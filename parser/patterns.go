@@ -0,0 +1,172 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/token"
+)
+
+// parseMatchExpression parses match (x) { pattern if guard => body, ... }.
+// A trailing comma after the last arm is allowed.
+func (p *Parser) parseMatchExpression() ast.Expression {
+	defer p.untrace(p.trace("parseMatchExpression"))
+	exp := &ast.MatchExpression{Token: p.currTok}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	exp.Subject = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) || !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	for !p.peekTokenIs(token.RBRACE) {
+		if len(exp.Arms) > 0 {
+			if !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			if p.peekTokenIs(token.RBRACE) {
+				break
+			}
+		}
+		p.nextToken()
+		arm := &ast.MatchArm{Pattern: p.parsePattern()}
+		if arm.Pattern == nil {
+			return nil
+		}
+		if p.peekTokenIs(token.IF) {
+			p.nextToken()
+			p.nextToken()
+			arm.Guard = p.parseExpression(LOWEST)
+		}
+		if !p.expectPeek(token.FATARROW) {
+			return nil
+		}
+		p.nextToken()
+		arm.Body = p.parseExpression(LOWEST)
+		exp.Arms = append(exp.Arms, arm)
+	}
+	p.nextToken()
+	exp.End = p.currTok.Pos
+	if len(exp.Arms) == 0 {
+		p.errorAt(exp.Token.Pos, "match has no arms")
+		return nil
+	}
+	return exp
+}
+
+// parsePattern parses the pattern starting at the current token.
+func (p *Parser) parsePattern() ast.Pattern {
+	defer p.untrace(p.trace("parsePattern"))
+	switch p.currTok.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+	case token.INT, token.STRING, token.TRUE, token.FALSE, token.MINUS:
+		return p.parseLiteralPattern()
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	case token.EOF:
+		p.incomplete = true
+	}
+	p.errorAt(p.currTok.Pos, fmt.Sprintf("expected a pattern, got %s", p.currTok.Type))
+	return nil
+}
+
+// parseLiteralPattern parses a literal, reading a minus sign before an
+// integer as part of it.
+func (p *Parser) parseLiteralPattern() ast.Pattern {
+	defer p.untrace(p.trace("parseLiteralPattern"))
+	tok := p.currTok
+	if tok.Type == token.MINUS {
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		lit, ok := p.parseInteger().(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		lit.Token = token.Token{Type: token.INT, Literal: "-" + lit.Token.Literal, Pos: tok.Pos}
+		lit.Value = -lit.Value
+		return &ast.LiteralPattern{Token: tok, Value: lit}
+	}
+	value := p.prefixParseFns[tok.Type]()
+	if value == nil {
+		return nil
+	}
+	return &ast.LiteralPattern{Token: tok, Value: value}
+}
+
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	defer p.untrace(p.trace("parseArrayPattern"))
+	pat := &ast.ArrayPattern{Token: p.currTok}
+	for !p.peekTokenIs(token.RBRACKET) {
+		if len(pat.Elements) > 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pat.Rest = &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+			if !p.peekTokenIs(token.RBRACKET) {
+				p.errorAt(p.peekTok.Pos, "a rest pattern must come last")
+				return nil
+			}
+			break
+		}
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pat.Elements = append(pat.Elements, el)
+	}
+	p.nextToken()
+	return pat
+}
+
+// parseHashPattern parses {"key": pattern, name: pattern, name}, where a
+// name alone binds the value under the string of the name.
+func (p *Parser) parseHashPattern() ast.Pattern {
+	defer p.untrace(p.trace("parseHashPattern"))
+	pat := &ast.HashPattern{Token: p.currTok}
+	for !p.peekTokenIs(token.RBRACE) {
+		if len(pat.Pairs) > 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		p.nextToken()
+		var key ast.Expression
+		switch p.currTok.Type {
+		case token.IDENT:
+			name := &ast.Identifier{Token: p.currTok, Value: p.currTok.Literal}
+			if !p.peekTokenIs(token.COLON) {
+				pat.Pairs = append(pat.Pairs, ast.HashPatternPair{Key: name, Value: name})
+				continue
+			}
+			key = name
+		case token.STRING, token.INT, token.TRUE, token.FALSE:
+			if key = p.prefixParseFns[p.currTok.Type](); key == nil {
+				return nil
+			}
+		case token.EOF:
+			p.incomplete = true
+			fallthrough
+		default:
+			p.errorAt(p.currTok.Pos, fmt.Sprintf("hash pattern keys must be names or literals, got %s", p.currTok.Type))
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		value := p.parsePattern()
+		if value == nil {
+			return nil
+		}
+		pat.Pairs = append(pat.Pairs, ast.HashPatternPair{Key: key, Value: value})
+	}
+	p.nextToken()
+	return pat
+}
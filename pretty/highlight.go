@@ -0,0 +1,87 @@
+package pretty
+
+import (
+	"strings"
+
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/token"
+)
+
+const (
+	colorReset    = "\x1b[0m"
+	colorKeyword  = "\x1b[35m"
+	colorNumber   = "\x1b[33m"
+	colorString   = "\x1b[32m"
+	colorConstant = "\x1b[36m"
+	colorBuiltin  = "\x1b[34m"
+	colorError    = "\x1b[31m"
+)
+
+var tokenColors = map[token.TokenType]string{
+	token.LET:      colorKeyword,
+	token.FUNCTION: colorKeyword,
+	token.IF:       colorKeyword,
+	token.ELSE:     colorKeyword,
+	token.RETURN:   colorKeyword,
+	token.IMPORT:   colorKeyword,
+	token.EXPORT:   colorKeyword,
+	token.THROW:    colorKeyword,
+	token.TRY:      colorKeyword,
+	token.CATCH:    colorKeyword,
+	token.FINALLY:  colorKeyword,
+	token.FOR:      colorKeyword,
+	token.BREAK:    colorKeyword,
+	token.CONTINUE: colorKeyword,
+	token.MATCH:    colorKeyword,
+	token.TRUE:     colorConstant,
+	token.FALSE:    colorConstant,
+	token.INT:      colorNumber,
+	token.STRING:   colorString,
+	token.ILLEGAL:  colorError,
+}
+
+// Highlight returns src with its tokens coloured by type. The text itself,
+// including whitespace, is unchanged.
+func Highlight(src string) string {
+	// the lexer gives positions as lines and byte columns
+	lineStarts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	offset := func(pos token.Position) int {
+		return lineStarts[pos.Line-1] + pos.Column - 1
+	}
+
+	var toks []token.Token
+	l := lexer.New(src)
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			break
+		}
+		toks = append(toks, tok)
+	}
+
+	var b strings.Builder
+	prev := 0
+	for i, tok := range toks {
+		start := offset(tok.Pos)
+		end := len(src)
+		if i+1 < len(toks) {
+			end = offset(toks[i+1].Pos)
+		}
+		b.WriteString(src[prev:start])
+		// a token runs up to the next one, less the whitespace between them
+		text := strings.TrimRight(src[start:end], " \t\r\n")
+		if color, ok := tokenColors[tok.Type]; ok {
+			b.WriteString(color + text + colorReset)
+		} else {
+			b.WriteString(text)
+		}
+		prev = start + len(text)
+	}
+	b.WriteString(src[prev:])
+	return b.String()
+}
@@ -0,0 +1,249 @@
+// Package pretty renders values for people: nested arrays and hashes are
+// broken over lines to fit a width, huge values are truncated, and values
+// and source can be coloured with ANSI escapes.
+package pretty
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/format"
+	"github.com/jarviliam/inti/object"
+)
+
+const indent = "  "
+
+type Printer struct {
+	width     int
+	maxItems  int
+	maxString int
+	color     bool
+}
+
+type Option func(*Printer)
+
+// WithWidth sets the column values are fitted to. The default is 80.
+func WithWidth(n int) Option {
+	return func(p *Printer) { p.width = n }
+}
+
+// WithMaxItems sets how many elements of an array or pairs of a hash are
+// shown before the rest are elided. The default is 100.
+func WithMaxItems(n int) Option {
+	return func(p *Printer) { p.maxItems = n }
+}
+
+// WithMaxString sets how many characters of a string are shown before the
+// rest are elided. The default is 1000.
+func WithMaxString(n int) Option {
+	return func(p *Printer) { p.maxString = n }
+}
+
+// WithColor colours the output with ANSI escapes.
+func WithColor() Option {
+	return func(p *Printer) { p.color = true }
+}
+
+func New(opts ...Option) *Printer {
+	p := &Printer{width: 80, maxItems: 100, maxString: 1000}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// Sprint renders obj. Strings inside arrays and hashes are quoted; a string
+// on its own is shown as is, as Inspect does.
+func (p *Printer) Sprint(obj object.Object) string {
+	if s, ok := obj.(*object.String); ok {
+		return p.paint(colorString, p.truncate(s.Value))
+	}
+	var b strings.Builder
+	p.print(&b, obj, "", 0)
+	return b.String()
+}
+
+// print writes obj starting at column col, breaking it over lines indented
+// by pad if it does not fit on one.
+func (p *Printer) print(b *strings.Builder, obj object.Object, pad string, col int) {
+	flat := p.flat(obj)
+	if col+utf8.RuneCountInString(flat) <= p.width && !strings.Contains(flat, "\n") {
+		b.WriteString(p.paintFlat(obj, flat))
+		return
+	}
+	inner := pad + indent
+
+	switch obj := obj.(type) {
+	case *object.Array:
+		b.WriteString("[\n")
+		items, more := p.limit(len(obj.Elements))
+		for _, el := range obj.Elements[:items] {
+			b.WriteString(inner)
+			p.print(b, el, inner, len(inner))
+			b.WriteString(",\n")
+		}
+		p.more(b, inner, more)
+		b.WriteString(pad + "]")
+	case *object.Hash:
+		b.WriteString("{\n")
+		pairs := obj.SortedPairs()
+		items, more := p.limit(len(pairs))
+		for _, pair := range pairs[:items] {
+			key := p.flat(pair.Key)
+			b.WriteString(inner + p.paintFlat(pair.Key, key) + ": ")
+			p.print(b, pair.Value, inner, len(inner)+utf8.RuneCountInString(key)+2)
+			b.WriteString(",\n")
+		}
+		p.more(b, inner, more)
+		b.WriteString(pad + "}")
+	case *object.Function:
+		src := strings.TrimSuffix(format.Node(functionLiteral(obj)), "\n")
+		src = strings.Replace(src, "\n", "\n"+pad, -1)
+		src = strings.Replace(src, "\t", indent, -1)
+		b.WriteString(p.highlight(src))
+	default:
+		b.WriteString(p.paintFlat(obj, flat))
+	}
+}
+
+// flat renders obj on a single line without colour, unless it holds a
+// block such as an if expression that spans lines.
+func (p *Printer) flat(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.String:
+		return strconv.Quote(p.truncate(obj.Value))
+	case *object.Array:
+		items, more := p.limit(len(obj.Elements))
+		parts := make([]string, 0, items+1)
+		for _, el := range obj.Elements[:items] {
+			parts = append(parts, p.flat(el))
+		}
+		if more > 0 {
+			parts = append(parts, elided(more))
+		}
+		return "[" + strings.Join(parts, ", ") + "]"
+	case *object.Hash:
+		pairs := obj.SortedPairs()
+		items, more := p.limit(len(pairs))
+		parts := make([]string, 0, items+1)
+		for _, pair := range pairs[:items] {
+			parts = append(parts, p.flat(pair.Key)+": "+p.flat(pair.Value))
+		}
+		if more > 0 {
+			parts = append(parts, elided(more))
+		}
+		return "{" + strings.Join(parts, ", ") + "}"
+	case *object.Function:
+		// the body goes on the same line: fn(x) { let y = x + 1; y }
+		src := format.Node(functionLiteral(obj))
+		stmts := make([]string, len(obj.Block.Statements))
+		for i, stmt := range obj.Block.Statements {
+			stmts[i] = format.Node(stmt)
+		}
+		body := ""
+		if len(stmts) > 0 {
+			body = " " + strings.Join(stmts, "; ") + " "
+		}
+		return src[:strings.Index(src, "{")] + "{" + body + "}"
+	}
+	return obj.Inspect()
+}
+
+// paintFlat colours the flat rendering of obj.
+func (p *Printer) paintFlat(obj object.Object, flat string) string {
+	if !p.color {
+		return flat
+	}
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return p.paint(colorNumber, flat)
+	case *object.Boolean, *object.Null:
+		return p.paint(colorConstant, flat)
+	case *object.String:
+		return p.paint(colorString, flat)
+	case *object.Error:
+		return p.paint(colorError, flat)
+	case *object.Builtin:
+		return p.paint(colorBuiltin, flat)
+	case *object.Function:
+		return p.highlight(flat)
+	case *object.Array:
+		var b strings.Builder
+		b.WriteString("[")
+		items, more := p.limit(len(obj.Elements))
+		for i, el := range obj.Elements[:items] {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(p.paintFlat(el, p.flat(el)))
+		}
+		if more > 0 {
+			b.WriteString(", " + elided(more))
+		}
+		b.WriteString("]")
+		return b.String()
+	case *object.Hash:
+		var b strings.Builder
+		b.WriteString("{")
+		pairs := obj.SortedPairs()
+		items, more := p.limit(len(pairs))
+		for i, pair := range pairs[:items] {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(p.paintFlat(pair.Key, p.flat(pair.Key)) + ": " + p.paintFlat(pair.Value, p.flat(pair.Value)))
+		}
+		if more > 0 {
+			b.WriteString(", " + elided(more))
+		}
+		b.WriteString("}")
+		return b.String()
+	}
+	return flat
+}
+
+func (p *Printer) highlight(src string) string {
+	if !p.color {
+		return src
+	}
+	return Highlight(src)
+}
+
+func (p *Printer) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// limit splits n items into those shown and those elided.
+func (p *Printer) limit(n int) (int, int) {
+	if n > p.maxItems {
+		return p.maxItems, n - p.maxItems
+	}
+	return n, 0
+}
+
+func (p *Printer) more(b *strings.Builder, pad string, n int) {
+	if n > 0 {
+		b.WriteString(pad + elided(n) + "\n")
+	}
+}
+
+func elided(n int) string {
+	return "... " + strconv.Itoa(n) + " more"
+}
+
+func (p *Printer) truncate(s string) string {
+	if utf8.RuneCountInString(s) <= p.maxString {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:p.maxString]) + "..."
+}
+
+func functionLiteral(fn *object.Function) *ast.FunctionLiteral {
+	return &ast.FunctionLiteral{Params: fn.Params, Generator: fn.Generator, ReturnType: fn.ReturnType, Block: fn.Block}
+}
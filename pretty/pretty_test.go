@@ -0,0 +1,74 @@
+package pretty
+
+import (
+	"testing"
+
+	"github.com/jarviliam/inti/evaluator"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+)
+
+func eval(t *testing.T, input string) object.Object {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return evaluator.Eval(program, object.NewEnvironment())
+}
+
+func TestSprint(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     []Option
+		expected string
+	}{
+		{`"hi"`, nil, `hi`},
+		{`[1, "a", true]`, nil, `[1, "a", true]`},
+		{`{"b": 2, "a": 1, 3: [4]}`, nil, `{3: [4], "a": 1, "b": 2}`},
+		{`fn(x) { x + 1 }`, nil, `fn(x) { x + 1 }`},
+		{`fn(x) { let y = x; y }`, nil, `fn(x) { let y = x; y }`},
+		{`fn() {}`, nil, `fn() {}`},
+		{`fn(x) { let y = x; y }`, []Option{WithWidth(10)}, "fn(x) {\n  let y = x;\n  y;\n}"},
+		{`[[1, 2], [3, 4]]`, []Option{WithWidth(12)}, "[\n  [1, 2],\n  [3, 4],\n]"},
+		{`{"key": [1, 2, 3]}`, []Option{WithWidth(16)}, "{\n  \"key\": [\n    1,\n    2,\n    3,\n  ],\n}"},
+		{`[1, 2, 3, 4, 5]`, []Option{WithMaxItems(2)}, `[1, 2, ... 3 more]`},
+		{`[1, 2, 3, 4, 5]`, []Option{WithMaxItems(2), WithWidth(10)}, "[\n  1,\n  2,\n  ... 3 more\n]"},
+		{`["abcdef"]`, []Option{WithMaxString(3)}, `["abc..."]`},
+		{`[1, true]`, []Option{WithColor()}, "[\x1b[33m1\x1b[0m, \x1b[36mtrue\x1b[0m]"},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.opts...).Sprint(eval(t, tt.input))
+		if got != tt.expected {
+			t.Errorf("%s: wrong output.\nwant=%q\n got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`let x = 5;`,
+			"\x1b[35mlet\x1b[0m x = \x1b[33m5\x1b[0m;",
+		},
+		{
+			"if (x) {\n\t\"a\\n\"\n}",
+			"\x1b[35mif\x1b[0m (x) {\n\t\x1b[32m\"a\\n\"\x1b[0m\n}",
+		},
+		{
+			`puts("oops`,
+			"puts(\x1b[31m\"oops\x1b[0m",
+		},
+	}
+
+	for _, tt := range tests {
+		if got := Highlight(tt.input); got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\n got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
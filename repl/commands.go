@@ -0,0 +1,169 @@
+package repl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/format"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/object"
+	"github.com/jarviliam/inti/parser"
+	"github.com/jarviliam/inti/token"
+)
+
+// command is a colon-prefixed REPL command.
+type command struct {
+	args string
+	help string
+	run  func(s *session, arg string)
+}
+
+var commands map[string]*command
+
+func init() {
+	// assigned here because :help refers back to the table
+	commands = map[string]*command{
+		"help":   {"", "list the commands", (*session).help},
+		"env":    {"", "show the bindings in the session and their types", (*session).showEnv},
+		"ast":    {"[-json] expr", "show how expr parses", (*session).showAST},
+		"tokens": {"expr", "show the tokens expr lexes to", (*session).showTokens},
+		"load":   {"file", "run a file in the session", (*session).load},
+		"save":   {"file", "write the inputs run so far to a script", (*session).save},
+		"reset":  {"", "clear all bindings and history", (*session).resetCommand},
+		"time":   {"expr", "evaluate expr and report how long it took", (*session).time},
+	}
+}
+
+func (s *session) command(line string) {
+	name, arg := line[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, arg = name[:i], strings.TrimSpace(name[i:])
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(s.out, "\tunknown command :%s, try :help\n", name)
+		return
+	}
+	// only the words after the last [optional] one are required
+	required := cmd.args[strings.LastIndex(cmd.args, "]")+1:]
+	if strings.TrimSpace(required) != "" && arg == "" {
+		fmt.Fprintf(s.out, "\tusage: :%s %s\n", name, cmd.args)
+		return
+	}
+	cmd.run(s, arg)
+}
+
+func (s *session) help(string) {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := commands[name]
+		usage := strings.TrimSpace(":" + name + " " + cmd.args)
+		fmt.Fprintf(s.out, "  %-20s %s\n", usage, cmd.help)
+	}
+	fmt.Fprintf(s.out, "  %-20s %s\n", cancel, "discard a multi-line input at the "+strings.TrimSpace(CONTINUE)+" prompt")
+}
+
+func (s *session) showEnv(string) {
+	for _, name := range s.env.Names() {
+		val, _ := s.env.Get(name)
+		typ := string(val.Type())
+		if scheme, ok := s.checker.Lookup(name); ok && !s.untyped[name] {
+			typ = scheme.String()
+		}
+		if _, ok := val.(*object.Function); ok {
+			fmt.Fprintf(s.out, "\t%s: %s\n", name, typ)
+			continue
+		}
+		fmt.Fprintf(s.out, "\t%s: %s = %s\n", name, typ, val.Inspect())
+	}
+}
+
+// parse parses src, printing any errors with their positions.
+func (s *session) parse(name, src string) (*ast.Program, bool) {
+	p := parser.New(lexer.New(src), parser.WithOperators(s.ops))
+	program := p.ParseProgram()
+	for _, err := range p.ErrorList() {
+		fmt.Fprintf(s.out, "\t%s%s\n", name, err)
+	}
+	return program, len(p.ErrorList()) == 0
+}
+
+func (s *session) showAST(arg string) {
+	asJSON := false
+	if f := strings.Fields(arg); len(f) > 0 && f[0] == "-json" {
+		asJSON, arg = true, strings.TrimSpace(strings.TrimPrefix(arg, "-json"))
+	}
+	program, ok := s.parse("", arg)
+	if !ok {
+		return
+	}
+	if !asJSON {
+		for _, stmt := range program.Statements {
+			fmt.Fprintf(s.out, "%s\n", stmt.String())
+		}
+		return
+	}
+	out, err := ast.JSON(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "\t%s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "%s\n", out)
+}
+
+func (s *session) showTokens(arg string) {
+	l := lexer.New(arg)
+	for {
+		tok := l.NextToken()
+		if tok.Type == token.EOF {
+			return
+		}
+		fmt.Fprintf(s.out, "\t%-6s %-10s %q\n", tok.Pos, tok.Type, tok.Literal)
+	}
+}
+
+func (s *session) load(path string) {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "\t%s\n", err)
+		return
+	}
+	program, ok := s.parse(path+":", string(src))
+	if !ok {
+		return
+	}
+	s.run(program)
+}
+
+func (s *session) save(path string) {
+	script := format.Program(&ast.Program{Statements: s.history})
+	if err := ioutil.WriteFile(path, []byte(script), 0644); err != nil {
+		fmt.Fprintf(s.out, "\t%s\n", err)
+		return
+	}
+	fmt.Fprintf(s.out, "\tsaved %d statements to %s\n", len(s.history), path)
+}
+
+func (s *session) resetCommand(string) {
+	s.reset()
+	fmt.Fprintf(s.out, "\tsession reset\n")
+}
+
+func (s *session) time(arg string) {
+	program, ok := s.parse("", arg)
+	if !ok {
+		return
+	}
+	start := time.Now()
+	s.run(program)
+	fmt.Fprintf(s.out, "\ttook %s\n", time.Since(start))
+}
@@ -2,40 +2,247 @@ package repl
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/jarviliam/inti/ast"
 	"github.com/jarviliam/inti/evaluator"
 	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/lineedit"
+	"github.com/jarviliam/inti/object"
 	"github.com/jarviliam/inti/parser"
+	"github.com/jarviliam/inti/pretty"
+	"github.com/jarviliam/inti/token"
+	"github.com/jarviliam/inti/types"
 )
 
 const PROMPT = ">> "
 
-func Start(in io.Reader, out io.Writer) {
-	s := bufio.NewScanner(in)
+// CONTINUE is the prompt shown while an input spans several lines.
+const CONTINUE = ".. "
 
+// cancel discards the pending lines of an incomplete input.
+const cancel = ":cancel"
+
+type config struct {
+	typeCheck bool
+	evalOpts  []evaluator.Option
+	timeout   time.Duration
+}
+
+type Option func(*config)
+
+// WithTypeCheck type checks each input before it is evaluated. Inputs that
+// fail to check are reported and not evaluated.
+func WithTypeCheck() Option {
+	return func(c *config) { c.typeCheck = true }
+}
+
+// WithEvaluatorOptions sets options of the evaluator running inputs, such
+// as its limits and capabilities. Limits apply to each input afresh.
+func WithEvaluatorOptions(opts ...evaluator.Option) Option {
+	return func(c *config) { c.evalOpts = append(c.evalOpts, opts...) }
+}
+
+// WithTimeout stops inputs still running after d.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) { c.timeout = d }
+}
+
+func Start(in io.Reader, out io.Writer, opts ...Option) {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	sess := newSession(out, cfg)
+	lines := newLineReader(in, out, sess)
+
+	var pending []string
 	for {
-		fmt.Fprintf(out, PROMPT)
-		scanned := s.Scan()
-		if !scanned {
+		prompt := PROMPT
+		if len(pending) != 0 {
+			prompt = CONTINUE
+		}
+		line, err := lines.ReadLine(prompt)
+		if err == lineedit.ErrInterrupted {
+			pending = nil
+			continue
+		}
+		if err != nil {
 			return
 		}
-		line := s.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
+		if len(pending) != 0 && strings.TrimSpace(line) == cancel {
+			pending = nil
+			continue
+		}
+		if len(pending) == 0 && strings.HasPrefix(strings.TrimSpace(line), ":") {
+			sess.command(strings.TrimSpace(line))
+			continue
+		}
+		pending = append(pending, line)
+		src := strings.Join(pending, "\n")
+		p := parser.New(lexer.New(src), parser.WithOperators(sess.ops))
 
 		program := p.ParseProgram()
+		if p.Incomplete() {
+			continue
+		}
+		pending = nil
 		if len(p.Errors()) != 0 {
 			printParserError(out, p.Errors())
 			continue
 		}
-		evaluated := evaluator.Eval(program)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
+		sess.run(program)
+	}
+}
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// newLineReader returns a line editor when in is a terminal, and otherwise
+// reads plain lines so piped input works.
+func newLineReader(in io.Reader, out io.Writer, sess *session) lineReader {
+	f, ok := in.(*os.File)
+	if !ok || !lineedit.IsTerminal(f) {
+		return &scanner{s: bufio.NewScanner(in), out: out}
+	}
+	e := lineedit.New(in, out)
+	if dir, err := os.UserConfigDir(); err == nil {
+		// history is a convenience, so a config dir that can't be written is
+		// not worth failing over
+		e.SetHistoryFile(filepath.Join(dir, "inti", "history"))
+	}
+	e.Completions = sess.completions
+	if sess.color {
+		e.Highlight = pretty.Highlight
+	}
+	return &editor{e}
+}
+
+type editor struct {
+	*lineedit.Editor
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	line, err := e.Editor.ReadLine(prompt)
+	if err == nil {
+		e.AddHistory(line)
+	}
+	return line, err
+}
+
+type scanner struct {
+	s   *bufio.Scanner
+	out io.Writer
+}
+
+func (s *scanner) ReadLine(prompt string) (string, error) {
+	fmt.Fprintf(s.out, prompt)
+	if !s.s.Scan() {
+		if err := s.s.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.s.Text(), nil
+}
+
+// session is the state kept between inputs.
+type session struct {
+	cfg     *config
+	out     io.Writer
+	ev      *evaluator.Evaluator
+	printer *pretty.Printer
+	// color is set when out is a terminal and NO_COLOR is not.
+	color   bool
+	env     *object.Environment
+	checker *types.Checker
+	// untyped holds globals last bound by an input that failed to type
+	// check, whose types in checker are stale.
+	untyped map[string]bool
+	// history holds the statements of inputs that ran without error, for
+	// :save.
+	history []ast.Statement
+	// ops holds the operators declared so far.
+	ops *parser.Operators
+}
+
+func newSession(out io.Writer, cfg *config) *session {
+	s := &session{cfg: cfg, out: out, ops: parser.NewOperators()}
+	// imported files parse the operators declared in the session
+	opts := append([]evaluator.Option{evaluator.WithOutput(out), evaluator.WithOperatorTable(s.ops)}, cfg.evalOpts...)
+	s.ev = evaluator.New(opts...)
+	var printOpts []pretty.Option
+	if f, ok := out.(*os.File); ok && lineedit.IsTerminal(f) {
+		s.color = os.Getenv("NO_COLOR") == ""
+		if w := lineedit.Width(f); w > 0 {
+			printOpts = append(printOpts, pretty.WithWidth(w))
+		}
+	}
+	if s.color {
+		printOpts = append(printOpts, pretty.WithColor())
+	}
+	s.printer = pretty.New(printOpts...)
+	s.reset()
+	return s
+}
+
+func (s *session) reset() {
+	s.env = object.NewEnvironment()
+	s.checker = types.NewChecker()
+	s.untyped = make(map[string]bool)
+	s.history = nil
+	s.ops.Reset()
+}
+
+// run evaluates a parsed input and prints its value. Inputs are always type
+// checked so :env can show types, but only rejected in type check mode.
+func (s *session) run(program *ast.Program) {
+	expanded, errObj := s.ev.ExpandMacros(program, s.env)
+	if errObj != nil {
+		io.WriteString(s.out, s.printer.Sprint(errObj))
+		io.WriteString(s.out, "\n")
+		return
+	}
+	errs := s.checker.Check(expanded)
+	if len(errs) != 0 && s.cfg.typeCheck {
+		printTypeErrors(s.out, errs)
+		return
+	}
+	for _, stmt := range expanded.Statements {
+		if let, ok := stmt.(*ast.LetStatement); ok {
+			for _, name := range let.Names() {
+				s.untyped[name.Value] = len(errs) != 0
+			}
 		}
 	}
+	ctx := context.Background()
+	if s.cfg.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.cfg.timeout)
+		defer cancel()
+	}
+	evaluated := s.ev.EvalContext(ctx, expanded, s.env)
+	if evaluated != nil {
+		io.WriteString(s.out, s.printer.Sprint(evaluated))
+		io.WriteString(s.out, "\n")
+	}
+	if _, failed := evaluated.(*object.Error); !failed {
+		s.history = append(s.history, program.Statements...)
+	}
+}
+
+// completions lists the words Tab completes to: keywords, builtins and the
+// names bound in the session.
+func (s *session) completions() []string {
+	words := append(token.Keywords(), evaluator.BuiltinNames()...)
+	return append(words, s.env.Names()...)
 }
 
 func printParserError(out io.Writer, errors []string) {
@@ -43,3 +250,9 @@ func printParserError(out io.Writer, errors []string) {
 		io.WriteString(out, "\t"+m+"\n")
 	}
 }
+
+func printTypeErrors(out io.Writer, errors []*types.Error) {
+	for _, e := range errors {
+		io.WriteString(out, "\ttype error: "+e.Error()+"\n")
+	}
+}
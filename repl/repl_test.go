@@ -0,0 +1,180 @@
+package repl
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarviliam/inti/evaluator"
+)
+
+func runSession(t *testing.T, input string, opts ...Option) string {
+	t.Helper()
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out, opts...)
+	return out.String()
+}
+
+func expectContains(t *testing.T, out string, want ...string) {
+	t.Helper()
+	for _, w := range want {
+		if !strings.Contains(out, w) {
+			t.Errorf("output does not contain %q.\noutput=%q", w, out)
+		}
+	}
+}
+
+func TestEvaluatesInputs(t *testing.T) {
+	out := runSession(t, "let a = 2;\na * 3\n")
+	if out != ">> >> 6\n>> " {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestMultiLineInput(t *testing.T) {
+	out := runSession(t, "let f = fn(x) {\n  x + 1\n}\nf(2)\n")
+	if out != ">> .. .. >> 3\n>> " {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestMultiLineInputError(t *testing.T) {
+	// an input that can't be completed is reported once it is, not while
+	// more lines might fix it
+	out := runSession(t, "let x = [1,\n2;\n")
+	if !strings.HasPrefix(out, ">> .. \t") {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestIncompleteInputAtEOF(t *testing.T) {
+	out := runSession(t, "1 +\n")
+	if out != ">> .. " {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	out := runSession(t, "let g = fn(x) {\n:cancel\ng\n")
+	expectContains(t, out, "identifier not found: g")
+	if strings.Count(out, CONTINUE) != 1 {
+		t.Errorf("expected one continuation prompt. got=%q", out)
+	}
+}
+
+func TestCancelOnlyWhilePending(t *testing.T) {
+	out := runSession(t, ":cancel\n")
+	expectContains(t, out, "unknown command :cancel")
+}
+
+func TestHelp(t *testing.T) {
+	out := runSession(t, ":help\n")
+	for name := range commands {
+		expectContains(t, out, ":"+name)
+	}
+	expectContains(t, out, cancel)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	out := runSession(t, ":bogus\n")
+	expectContains(t, out, "unknown command :bogus, try :help")
+}
+
+func TestCommandUsage(t *testing.T) {
+	for _, name := range []string{"ast", "tokens", "load", "save", "time"} {
+		out := runSession(t, ":"+name+"\n")
+		expectContains(t, out, "usage: :"+name+" ")
+	}
+}
+
+func TestEnv(t *testing.T) {
+	out := runSession(t, "let a = 1;\nlet f = fn(x) { x + a };\n:env\n")
+	expectContains(t, out, "\ta: int = 1\n", "\tf: fn(int) -> int\n")
+}
+
+func TestEnvUntyped(t *testing.T) {
+	// a binding from an input that fails to check shows its runtime type
+	out := runSession(t, "let a = if (true) { 1 } else { \"s\" };\n:env\n")
+	expectContains(t, out, "\ta: INTEGER = 1\n")
+}
+
+func TestAST(t *testing.T) {
+	out := runSession(t, ":ast 1 + 2 * 3\n")
+	expectContains(t, out, "(1 + (2 * 3))\n")
+}
+
+func TestASTJSON(t *testing.T) {
+	out := runSession(t, ":ast -json 1\n")
+	expectContains(t, out, `"node": "IntegerLiteral"`, `"pos": "1:1"`)
+}
+
+func TestASTParseError(t *testing.T) {
+	out := runSession(t, ":ast let = 1\n")
+	expectContains(t, out, "\t1:5: ")
+}
+
+func TestTokens(t *testing.T) {
+	out := runSession(t, ":tokens let x\n")
+	expectContains(t, out, "\t1:1    LET        \"let\"\n", "\t1:5    IDENT      \"x\"\n")
+}
+
+func TestTime(t *testing.T) {
+	out := runSession(t, ":time 1 + 1\n")
+	expectContains(t, out, "2\n\ttook ")
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "repl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "session.inti")
+
+	out := runSession(t, "let a = 1;\nlet b = a + 1;\nmissing\n:save "+path+"\n")
+	expectContains(t, out, "saved 2 statements to "+path)
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(src) != "let a = 1;\nlet b = a + 1;\n" {
+		t.Errorf("wrong script. got=%q", src)
+	}
+
+	out = runSession(t, ":load "+path+"\nb\n")
+	if !strings.HasSuffix(out, ">> 2\n>> ") {
+		t.Errorf("wrong output. got=%q", out)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	out := runSession(t, ":load /does/not/exist.inti\n")
+	expectContains(t, out, "no such file or directory")
+}
+
+func TestReset(t *testing.T) {
+	out := runSession(t, "let a = 1;\n:reset\na\n")
+	expectContains(t, out, "session reset", "identifier not found: a")
+}
+
+func TestTypeCheck(t *testing.T) {
+	out := runSession(t, "1 + \"a\"\n", WithTypeCheck())
+	expectContains(t, out, "\ttype error: ")
+	if strings.Contains(out, "type mismatch") {
+		t.Errorf("input that failed to check was evaluated. got=%q", out)
+	}
+}
+
+func TestEvaluatorOptions(t *testing.T) {
+	limits := evaluator.WithLimits(evaluator.Limits{Steps: 100})
+	out := runSession(t, "let f = fn(n) { f(n + 1) }; f(0)\n1 + 1\n", WithEvaluatorOptions(limits))
+	// each input gets the whole budget
+	expectContains(t, out, "step limit exceeded", ">> 2\n")
+
+	out = runSession(t, "let f = fn(n) { f(n + 1) }; f(0)\n", WithTimeout(10*time.Millisecond))
+	expectContains(t, out, "context deadline exceeded")
+}
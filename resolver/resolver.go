@@ -0,0 +1,446 @@
+package resolver
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/token"
+)
+
+type Kind int
+
+const (
+	Let Kind = iota
+	Param
+	Import
+	Predeclared
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Let:
+		return "let"
+	case Param:
+		return "param"
+	case Import:
+		return "import"
+	default:
+		return "predeclared"
+	}
+}
+
+// Definition is a name bound by a let, a function parameter, an import or
+// the environment the program runs in.
+type Definition struct {
+	Name  string
+	Ident *ast.Identifier // nil for predeclared names
+	Kind  Kind
+	Value ast.Expression // the bound value of a let
+	Scope *Scope
+}
+
+// Scope is the set of names bound by the program, a function body, a match
+// arm, a catch block or a loop body. Blocks of if expressions share their
+// enclosing scope, as in the evaluator.
+type Scope struct {
+	Parent   *Scope
+	Children []*Scope
+	// Start and End bound the function literal, match arm, catch block or
+	// loop owning the scope; they are zero for the program scope.
+	Start, End token.Position
+	Defs       []*Definition
+
+	names   map[string]*Definition
+	pending []*ast.FunctionLiteral
+	// arms are the match arm, catch and loop scopes directly inside,
+	// flushed along with s.
+	arms []*Scope
+}
+
+func newScope(parent *Scope) *Scope {
+	s := &Scope{Parent: parent, names: make(map[string]*Definition)}
+	if parent != nil {
+		parent.Children = append(parent.Children, s)
+	}
+	return s
+}
+
+func (s *Scope) define(d *Definition) {
+	d.Scope = s
+	s.Defs = append(s.Defs, d)
+	s.names[d.Name] = d
+}
+
+// Lookup finds the definition a name refers to from within s.
+func (s *Scope) Lookup(name string) (*Definition, bool) {
+	for ; s != nil; s = s.Parent {
+		if d, ok := s.names[name]; ok {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+type Severity int
+
+const (
+	Error Severity = iota
+	Warning
+)
+
+type Diagnostic struct {
+	Pos      token.Position
+	Msg      string
+	Severity Severity
+}
+
+// Result holds the scopes, bindings and problems found in a program.
+type Result struct {
+	Global      *Scope
+	Diagnostics []Diagnostic
+
+	// refs maps every identifier, including those being defined, to the
+	// definition it names.
+	refs   map[*ast.Identifier]*Definition
+	idents []*ast.Identifier
+}
+
+// Resolve binds each identifier in program to its definition. predeclared
+// names, such as builtins, are visible everywhere.
+func Resolve(program *ast.Program, predeclared ...string) *Result {
+	r := &Result{refs: make(map[*ast.Identifier]*Definition)}
+	universe := newScope(nil)
+	for _, name := range predeclared {
+		universe.define(&Definition{Name: name, Kind: Predeclared})
+	}
+	r.Global = newScope(universe)
+
+	r.statements(program.Statements, r.Global)
+	r.flush(r.Global)
+
+	// function bodies are resolved late, so restore source order
+	sort.SliceStable(r.Diagnostics, func(i, j int) bool {
+		return before(r.Diagnostics[i].Pos, r.Diagnostics[j].Pos)
+	})
+	sort.SliceStable(r.idents, func(i, j int) bool {
+		return before(r.idents[i].Pos(), r.idents[j].Pos())
+	})
+	return r
+}
+
+func (r *Result) errorf(pos token.Position, format string, a ...interface{}) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (r *Result) warnf(pos token.Position, format string, a ...interface{}) {
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{Pos: pos, Msg: fmt.Sprintf(format, a...), Severity: Warning})
+}
+
+func (r *Result) define(ident *ast.Identifier, kind Kind, value ast.Expression, s *Scope) {
+	d := &Definition{Name: ident.Value, Ident: ident, Kind: kind, Value: value}
+	s.define(d)
+	r.refs[ident] = d
+	r.idents = append(r.idents, ident)
+}
+
+func (r *Result) statements(stmts []ast.Statement, s *Scope) {
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			r.expression(stmt.Value, s)
+			if stmt.Pattern != nil {
+				r.pattern(stmt.Pattern, Let, s)
+			} else {
+				r.define(stmt.Name, Let, stmt.Value, s)
+			}
+		case *ast.ImportStatement:
+			for _, spec := range stmt.Specs {
+				r.define(spec.Local(), Import, nil, s)
+			}
+		case *ast.ReturnStatement:
+			r.expression(stmt.ReturnValue, s)
+		case *ast.ExpressionStatement:
+			r.expression(stmt.Expression, s)
+		case *ast.ThrowStatement:
+			r.expression(stmt.Value, s)
+		case *ast.YieldStatement:
+			r.expression(stmt.Value, s)
+		case *ast.OperatorDeclaration:
+			r.expression(stmt.Value, s)
+		case *ast.ForStatement:
+			r.expression(stmt.Iterable, s)
+			ls := newScope(s)
+			ls.Start, ls.End = stmt.Var.Pos(), stmt.Body.End
+			s.arms = append(s.arms, ls)
+			r.define(stmt.Var, Let, nil, ls)
+			r.statements(stmt.Body.Statements, ls)
+		}
+	}
+}
+
+// flush resolves the bodies of the function literals found directly in s.
+// They run after the whole scope has been bound, so they may refer to names
+// defined later on.
+func (r *Result) flush(s *Scope) {
+	for _, fn := range s.pending {
+		fs := newScope(s)
+		fs.Start, fs.End = fn.Pos(), fn.Block.End
+		for _, param := range fn.Params {
+			if param.Default != nil {
+				r.expression(param.Default, fs)
+			}
+			r.pattern(param.Pattern, Param, fs)
+		}
+		r.statements(fn.Block.Statements, fs)
+		r.flush(fs)
+	}
+	s.pending = nil
+	for _, as := range s.arms {
+		r.flush(as)
+	}
+	s.arms = nil
+}
+
+func (r *Result) expression(e ast.Expression, s *Scope) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		r.idents = append(r.idents, e)
+		d, ok := s.Lookup(e.Value)
+		if !ok {
+			r.errorf(e.Pos(), "undefined: %s", e.Value)
+			return
+		}
+		r.refs[e] = d
+	case *ast.PrefixExpression:
+		r.expression(e.Right, s)
+	case *ast.InfixExpression:
+		r.expression(e.Left, s)
+		r.expression(e.Right, s)
+	case *ast.IfExpression:
+		r.expression(e.Condition, s)
+		r.statements(e.Consequence.Statements, s)
+		if e.Alternative != nil {
+			r.statements(e.Alternative.Statements, s)
+		}
+	case *ast.TryExpression:
+		r.statements(e.Block.Statements, s)
+		if e.Catch != nil {
+			cs := newScope(s)
+			cs.Start, cs.End = e.Param.Pos(), e.Catch.End
+			s.arms = append(s.arms, cs)
+			r.define(e.Param, Let, nil, cs)
+			r.statements(e.Catch.Statements, cs)
+		}
+		if e.Finally != nil {
+			r.statements(e.Finally.Statements, s)
+		}
+	case *ast.MatchExpression:
+		r.match(e, s)
+	case *ast.SelectExpression:
+		r.selectCases(e, s)
+	case *ast.SpawnExpression:
+		r.expression(e.Call, s)
+	case *ast.FunctionLiteral:
+		s.pending = append(s.pending, e)
+	case *ast.MacroLiteral:
+		// a macro's body binds its params as a function's does
+		fn := &ast.FunctionLiteral{Token: e.Token, Block: e.Body}
+		for _, param := range e.Params {
+			fn.Params = append(fn.Params, &ast.Param{Pattern: param})
+		}
+		s.pending = append(s.pending, fn)
+	case *ast.CallExpression:
+		r.expression(e.Function, s)
+		if d, ok := s.Lookup("quote"); ok && d.Kind == Predeclared && isCallOf(e, "quote") {
+			r.unquotes(e.Args, s)
+			return
+		}
+		for _, a := range e.Args {
+			r.expression(a, s)
+		}
+	case *ast.SpreadExpression:
+		r.expression(e.Value, s)
+	case *ast.NamedArgument:
+		r.expression(e.Value, s)
+	case *ast.ArrayLiteral:
+		for _, el := range e.Elements {
+			r.expression(el, s)
+		}
+	case *ast.HashLiteral:
+		for _, pair := range e.Pairs {
+			r.expression(pair.Key, s)
+			r.expression(pair.Value, s)
+		}
+	case *ast.IndexExpression:
+		r.expression(e.Left, s)
+		r.expression(e.Index, s)
+	case *ast.MemberExpression:
+		// the member names a binding in another file
+		r.expression(e.Object, s)
+	}
+}
+
+func isCallOf(call *ast.CallExpression, name string) bool {
+	ident, ok := call.Function.(*ast.Identifier)
+	return ok && ident.Value == name
+}
+
+// unquotes resolves the arguments of the unquote calls in quoted code, the
+// rest of which refers to names where it is spliced.
+func (r *Result) unquotes(quoted []ast.Expression, s *Scope) {
+	for _, q := range quoted {
+		ast.Inspect(q, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpression)
+			if !ok || !isCallOf(call, "unquote") {
+				return true
+			}
+			for _, a := range call.Args {
+				r.expression(a, s)
+			}
+			return false
+		})
+	}
+}
+
+func (r *Result) match(m *ast.MatchExpression, s *Scope) {
+	r.expression(m.Subject, s)
+	for i, arm := range m.Arms {
+		as := newScope(s)
+		as.Start, as.End = arm.Pattern.Pos(), m.End
+		if i+1 < len(m.Arms) {
+			as.End = m.Arms[i+1].Pattern.Pos()
+		}
+		s.arms = append(s.arms, as)
+		r.pattern(arm.Pattern, Let, as)
+		if arm.Guard != nil {
+			r.expression(arm.Guard, as)
+		}
+		r.expression(arm.Body, as)
+	}
+	if missing, ok := missingBool(m); ok {
+		r.warnf(m.Pos(), "match on booleans does not cover %t", missing)
+	}
+}
+
+// selectCases resolves the cases of a select, each in a scope of its own
+// like match arms.
+func (r *Result) selectCases(sel *ast.SelectExpression, s *Scope) {
+	for i, c := range sel.Cases {
+		if !c.IsDefault() {
+			r.expression(c.Channel, s)
+			if c.Value != nil {
+				r.expression(c.Value, s)
+			}
+		}
+		cs := newScope(s)
+		cs.Start, cs.End = c.Token.Pos, sel.End
+		if i+1 < len(sel.Cases) {
+			cs.End = sel.Cases[i+1].Token.Pos
+		}
+		s.arms = append(s.arms, cs)
+		if c.Var != nil {
+			r.define(c.Var, Let, nil, cs)
+		}
+		r.expression(c.Body, cs)
+	}
+}
+
+// pattern defines the names pat binds in s.
+func (r *Result) pattern(pat ast.Pattern, kind Kind, s *Scope) {
+	for _, name := range ast.PatternNames(pat) {
+		r.define(name, kind, nil, s)
+	}
+}
+
+// missingBool reports the boolean a match whose patterns are all boolean
+// literals does not cover. Arms with guards cover nothing.
+func missingBool(m *ast.MatchExpression) (bool, bool) {
+	covered := map[bool]bool{}
+	for _, arm := range m.Arms {
+		lit, ok := arm.Pattern.(*ast.LiteralPattern)
+		if !ok {
+			return false, false
+		}
+		b, ok := lit.Value.(*ast.Boolean)
+		if !ok {
+			return false, false
+		}
+		if arm.Guard == nil {
+			covered[b.Value] = true
+		}
+	}
+	for _, v := range []bool{true, false} {
+		if !covered[v] {
+			return v, true
+		}
+	}
+	return false, false
+}
+
+// DefinitionOf returns the definition ident refers to or introduces.
+func (r *Result) DefinitionOf(ident *ast.Identifier) (*Definition, bool) {
+	d, ok := r.refs[ident]
+	return d, ok
+}
+
+// References returns every identifier naming d, in source order, including
+// the one that defines it.
+func (r *Result) References(d *Definition) []*ast.Identifier {
+	var idents []*ast.Identifier
+	for _, ident := range r.idents {
+		if r.refs[ident] == d {
+			idents = append(idents, ident)
+		}
+	}
+	return idents
+}
+
+// IdentifierAt returns the identifier covering pos.
+func (r *Result) IdentifierAt(pos token.Position) (*ast.Identifier, bool) {
+	for _, ident := range r.idents {
+		start := ident.Pos()
+		if start.Line == pos.Line && start.Column <= pos.Column && pos.Column < start.Column+len(ident.Value) {
+			return ident, true
+		}
+	}
+	return nil, false
+}
+
+// ScopeAt returns the innermost scope containing pos.
+func (r *Result) ScopeAt(pos token.Position) *Scope {
+	s := r.Global
+	for {
+		inner := s
+		for _, c := range s.Children {
+			if !before(pos, c.Start) && !before(c.End, pos) {
+				inner = c
+				break
+			}
+		}
+		if inner == s {
+			return s
+		}
+		s = inner
+	}
+}
+
+// Visible returns the definitions visible at pos, inner scopes first.
+func (r *Result) Visible(pos token.Position) []*Definition {
+	var defs []*Definition
+	seen := map[string]bool{}
+	for s := r.ScopeAt(pos); s != nil; s = s.Parent {
+		for i := len(s.Defs) - 1; i >= 0; i-- {
+			d := s.Defs[i]
+			if !seen[d.Name] {
+				seen[d.Name] = true
+				defs = append(defs, d)
+			}
+		}
+	}
+	return defs
+}
+
+func before(a, b token.Position) bool {
+	return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+}
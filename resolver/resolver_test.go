@@ -0,0 +1,166 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/parser"
+	"github.com/jarviliam/inti/token"
+)
+
+func TestUndefinedNames(t *testing.T) {
+	input := `let a = 1;
+let f = fn(x) { x + a + g(b) };
+let g = fn(y) { y };
+puts(c);
+let m = import "m"; m.b;
+import { x as y } from "m"; y;
+for (i in [y]) { try { throw i } catch (e) { e.message + d } }
+e + i`
+	r := Resolve(parse(t, input), "puts")
+
+	expected := []string{"2:27: undefined: b", "4:6: undefined: c", "7:58: undefined: d", "8:1: undefined: e", "8:5: undefined: i"}
+	if len(r.Diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%v", len(expected), r.Diagnostics)
+	}
+	for i, d := range r.Diagnostics {
+		if got := d.Pos.String() + ": " + d.Msg; got != expected[i] {
+			t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, expected[i], got)
+		}
+	}
+}
+
+func TestMacroDefinitions(t *testing.T) {
+	input := `let m = macro(a) { quote(unquote(a) + t + unquote(b)) };
+m(1)`
+	r := Resolve(parse(t, input), "quote", "unquote")
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Pos.String()+": "+r.Diagnostics[0].Msg != "1:51: undefined: b" {
+		t.Fatalf("wrong diagnostics %v", r.Diagnostics)
+	}
+	a, _ := r.IdentifierAt(token.Position{Line: 1, Column: 34})
+	if d, ok := r.DefinitionOf(a); !ok || d.Kind != Param || d.Ident.Pos() != (token.Position{Line: 1, Column: 15}) {
+		t.Errorf("a resolved to wrong definition %+v", d)
+	}
+}
+
+func TestDestructuringDefinitions(t *testing.T) {
+	input := `let [a, {b, c: d}, ..._] = xs;
+let f = fn([x, ...y]) { x + y + c };
+a + b + d`
+	r := Resolve(parse(t, input), "xs")
+	if len(r.Diagnostics) != 1 || r.Diagnostics[0].Pos.String()+": "+r.Diagnostics[0].Msg != "2:33: undefined: c" {
+		t.Fatalf("wrong diagnostics %v", r.Diagnostics)
+	}
+	y, _ := r.IdentifierAt(token.Position{Line: 2, Column: 29})
+	if d, ok := r.DefinitionOf(y); !ok || d.Kind != Param || d.Ident.Pos() != (token.Position{Line: 2, Column: 19}) {
+		t.Errorf("y resolved to wrong definition %+v", d)
+	}
+}
+
+func TestParamDefaults(t *testing.T) {
+	input := `let f = fn(a, b = a + 1, c = d) { b };
+f(1, ...xs, c: e)`
+	r := Resolve(parse(t, input), "xs")
+	expected := []string{"1:30: undefined: d", "2:16: undefined: e"}
+	if len(r.Diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%v", len(expected), r.Diagnostics)
+	}
+	for i, d := range r.Diagnostics {
+		if got := d.Pos.String() + ": " + d.Msg; got != expected[i] {
+			t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, expected[i], got)
+		}
+	}
+}
+
+func TestMatchScopes(t *testing.T) {
+	input := `let f = fn(x) {
+	match (x) { [h, ...t] => g(h, t), {"k": v} if v => v, _ => t }
+};
+let g = fn(a, b) { a };
+match (f(1) == 1) { true => 1 };
+match (true) { true => 1, false => 2 };
+match (true) { true if f(1) => 1, false => 2 }`
+	r := Resolve(parse(t, input))
+
+	expected := []string{"2:61: undefined: t", "5:1: match on booleans does not cover false", "7:1: match on booleans does not cover true"}
+	if len(r.Diagnostics) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. want=%d, got=%v", len(expected), r.Diagnostics)
+	}
+	for i, d := range r.Diagnostics {
+		if got := d.Pos.String() + ": " + d.Msg; got != expected[i] {
+			t.Errorf("diagnostic %d wrong. want=%q, got=%q", i, expected[i], got)
+		}
+	}
+	if r.Diagnostics[1].Severity != Warning {
+		t.Errorf("non-exhaustive match is not a warning")
+	}
+	h, _ := r.IdentifierAt(token.Position{Line: 2, Column: 29})
+	if d, ok := r.DefinitionOf(h); !ok || d.Ident.Pos() != (token.Position{Line: 2, Column: 15}) {
+		t.Errorf("h resolved to wrong definition %+v", d)
+	}
+}
+
+func TestDefinitionsAndReferences(t *testing.T) {
+	input := `let x = 1;
+let f = fn(x) { x + 1 };
+f(x) + x`
+	r := Resolve(parse(t, input))
+
+	global, ok := r.IdentifierAt(token.Position{Line: 3, Column: 3})
+	if !ok || global.Value != "x" {
+		t.Fatalf("no identifier x at 3:3. got=%v", global)
+	}
+	d, _ := r.DefinitionOf(global)
+	if d.Kind != Let || d.Ident.Pos() != (token.Position{Line: 1, Column: 5}) {
+		t.Fatalf("x resolved to wrong definition %+v", d)
+	}
+	if refs := r.References(d); len(refs) != 3 {
+		t.Errorf("wrong number of references to global x. want=3, got=%d", len(refs))
+	}
+
+	param, _ := r.IdentifierAt(token.Position{Line: 2, Column: 17})
+	d, _ = r.DefinitionOf(param)
+	if d.Kind != Param || d.Ident.Pos() != (token.Position{Line: 2, Column: 12}) {
+		t.Fatalf("param x resolved to wrong definition %+v", d)
+	}
+	if refs := r.References(d); len(refs) != 2 {
+		t.Errorf("wrong number of references to param x. want=2, got=%d", len(refs))
+	}
+}
+
+func TestVisible(t *testing.T) {
+	input := `let a = 1;
+let f = fn(b) {
+  let c = b;
+  c
+};`
+	r := Resolve(parse(t, input), "len")
+
+	names := func(defs []*Definition) map[string]bool {
+		m := map[string]bool{}
+		for _, d := range defs {
+			m[d.Name] = true
+		}
+		return m
+	}
+	inner := names(r.Visible(token.Position{Line: 4, Column: 3}))
+	for _, n := range []string{"a", "f", "b", "c", "len"} {
+		if !inner[n] {
+			t.Errorf("%s not visible inside f", n)
+		}
+	}
+	outer := names(r.Visible(token.Position{Line: 5, Column: 3}))
+	if outer["b"] || outer["c"] {
+		t.Errorf("parameters of f visible outside it: %v", outer)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
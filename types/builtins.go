@@ -0,0 +1,41 @@
+package types
+
+// builtins holds the schemes of the evaluator's builtin functions.
+var builtins = newEnv(nil)
+
+func init() {
+	// a is quantified in every scheme below, so it is never bound itself
+	a := &Var{level: 1}
+	poly := func(t Type) *Scheme { return &Scheme{Vars: []*Var{a}, Type: t} }
+
+	builtins.vars["len"] = poly(&Func{Params: []Type{a}, Return: Int})
+	builtins.vars["first"] = poly(&Func{Params: []Type{&Array{Elem: a}}, Return: a})
+	builtins.vars["last"] = poly(&Func{Params: []Type{&Array{Elem: a}}, Return: a})
+	builtins.vars["rest"] = poly(&Func{Params: []Type{&Array{Elem: a}}, Return: &Array{Elem: a}})
+	builtins.vars["push"] = poly(&Func{Params: []Type{&Array{Elem: a}, a}, Return: &Array{Elem: a}})
+	builtins.vars["args"] = &Scheme{Type: &Func{Return: &Array{Elem: String}}}
+	builtins.vars["puts"] = &Scheme{Type: &Func{Variadic: true, Return: Null}}
+	builtins.vars["read_line"] = &Scheme{Type: &Func{Return: String}}
+	builtins.vars["read_file"] = &Scheme{Type: &Func{Params: []Type{String}, Return: String}}
+	builtins.vars["write_file"] = &Scheme{Type: &Func{Params: []Type{String, String}, Return: Null}}
+	builtins.vars["env"] = &Scheme{Type: &Func{Params: []Type{String}, Return: String}}
+	builtins.vars["now"] = &Scheme{Type: &Func{Return: Int}}
+	builtins.vars["sleep"] = &Scheme{Type: &Func{Params: []Type{Int}, Return: Null}}
+	builtins.vars["random"] = &Scheme{Type: &Func{Params: []Type{Int}, Return: Int}}
+	builtins.vars["next"] = poly(&Func{Params: []Type{&Iterator{Elem: a}}, Return: a})
+	builtins.vars["take"] = poly(&Func{Params: []Type{a, Int}, Return: a})
+	builtins.vars["filter"] = poly(&Func{Params: []Type{a, &Func{Variadic: true, Return: Bool}}, Return: a})
+	// map and collect take arrays and iterators alike
+	builtins.vars["map"] = poly(&Func{Variadic: true, Return: a})
+	builtins.vars["collect"] = poly(&Func{Variadic: true, Return: a})
+	// a channel's element type is fixed by its first use
+	builtins.vars["channel"] = poly(&Func{Variadic: true, Return: &Chan{Elem: a}})
+	builtins.vars["send"] = poly(&Func{Params: []Type{&Chan{Elem: a}, a}, Return: Null})
+	builtins.vars["receive"] = poly(&Func{Params: []Type{&Chan{Elem: a}}, Return: a})
+	builtins.vars["close"] = poly(&Func{Params: []Type{&Chan{Elem: a}}, Return: Null})
+	builtins.vars["await"] = poly(&Func{Params: []Type{&Task{Result: a}}, Return: a})
+	// the code quoted is not checked, only the code macros expand to
+	builtins.vars["quote"] = poly(&Func{Params: []Type{a}, Return: Quote})
+	builtins.vars["unquote"] = poly(&Func{Params: []Type{a}, Return: a})
+	builtins.vars["http_get"] = &Scheme{Type: &Func{Params: []Type{String}, Return: String}}
+}
@@ -0,0 +1,757 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/token"
+)
+
+// Error is a type error found at Pos.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Msg
+}
+
+type env struct {
+	vars  map[string]*Scheme
+	outer *env
+	// ret is the return type of the enclosing function literal.
+	ret Type
+	// yield is the type of the values it yields, if it is a generator.
+	yield Type
+}
+
+func newEnv(outer *env) *env {
+	return &env{vars: make(map[string]*Scheme), outer: outer}
+}
+
+func (e *env) lookup(name string) (*Scheme, bool) {
+	for ; e != nil; e = e.outer {
+		if s, ok := e.vars[name]; ok {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// yieldType returns the type of the values the enclosing function yields,
+// or nil if it is not a generator.
+func (e *env) yieldType() Type {
+	for ; e != nil; e = e.outer {
+		if e.ret != nil {
+			return e.yield
+		}
+	}
+	return nil
+}
+
+func (e *env) returnType() Type {
+	for ; e != nil; e = e.outer {
+		if e.ret != nil {
+			return e.ret
+		}
+	}
+	return nil
+}
+
+// Checker infers types for programs using Hindley-Milner inference with
+// let-polymorphism. Top-level bindings of a program that checks cleanly are
+// kept, so a Checker can follow a REPL session line by line.
+type Checker struct {
+	globals *env
+	nextID  int
+	level   int
+	errors  []*Error
+	// idents records the type of each identifier in the last program checked.
+	idents map[*ast.Identifier]*Scheme
+}
+
+func NewChecker() *Checker {
+	return &Checker{globals: newEnv(builtins)}
+}
+
+// Check infers the types of a single program.
+func Check(program *ast.Program) []*Error {
+	return NewChecker().Check(program)
+}
+
+// Check infers the types of program and returns every mismatch found.
+func (c *Checker) Check(program *ast.Program) []*Error {
+	c.errors = nil
+	c.idents = make(map[*ast.Identifier]*Scheme)
+	e := newEnv(c.globals)
+	e.ret = c.newVar()
+	c.inferStatements(program.Statements, e)
+
+	if len(c.errors) == 0 {
+		for name, s := range e.vars {
+			c.globals.vars[name] = s
+		}
+	}
+	return c.errors
+}
+
+// TypeOf returns the type of an identifier in the last program checked.
+// Identifiers bound by let have their generalised scheme.
+func (c *Checker) TypeOf(ident *ast.Identifier) (*Scheme, bool) {
+	s, ok := c.idents[ident]
+	return s, ok
+}
+
+// Lookup returns the type scheme of a top-level binding.
+func (c *Checker) Lookup(name string) (*Scheme, bool) {
+	return c.globals.lookup(name)
+}
+
+func (c *Checker) errorf(pos token.Position, format string, a ...interface{}) {
+	c.errors = append(c.errors, &Error{Pos: pos, Msg: fmt.Sprintf(format, a...)})
+}
+
+func (c *Checker) newVar() *Var {
+	c.nextID++
+	return &Var{ID: c.nextID, level: c.level}
+}
+
+func (c *Checker) inferStatements(stmts []ast.Statement, e *env) Type {
+	var result Type = Null
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			c.inferLet(stmt, e)
+			result = Null
+		case *ast.OperatorDeclaration:
+			c.level++
+			t := c.infer(stmt.Value, e)
+			c.level--
+			e.vars[stmt.Operator] = c.generalize(t)
+			result = Null
+		case *ast.ImportStatement:
+			// imported names could have any type, each time they are used
+			for _, spec := range stmt.Specs {
+				v := c.newVar()
+				name := spec.Local()
+				e.vars[name.Value] = &Scheme{Vars: []*Var{v}, Type: v}
+				c.idents[name] = e.vars[name.Value]
+			}
+			result = Null
+		case *ast.ReturnStatement:
+			t := c.infer(stmt.ReturnValue, e)
+			ret := e.returnType()
+			if !c.unify(ret, t) {
+				c.errorf(stmt.Pos(), "cannot return %s, expected %s", Resolve(t), Resolve(ret))
+			}
+			result = ret
+		case *ast.ExpressionStatement:
+			result = c.infer(stmt.Expression, e)
+		case *ast.YieldStatement:
+			t := c.infer(stmt.Value, e)
+			if y := e.yieldType(); y != nil && !c.unify(y, t) {
+				c.errorf(stmt.Pos(), "cannot yield %s, expected %s", Resolve(t), Resolve(y))
+			}
+			result = Null
+		case *ast.ThrowStatement:
+			c.infer(stmt.Value, e)
+			// a throw never completes, so it may stand for any value
+			result = c.newVar()
+		case *ast.ForStatement:
+			c.inferFor(stmt, e)
+			result = Null
+		case *ast.BranchStatement:
+			result = Null
+		}
+	}
+	return result
+}
+
+func (c *Checker) inferLet(stmt *ast.LetStatement, e *env) {
+	if stmt.Pattern != nil {
+		c.inferLetPattern(stmt, e)
+		return
+	}
+	c.level++
+	tv := c.newVar()
+	if _, ok := stmt.Value.(*ast.FunctionLiteral); ok {
+		// functions may refer to themselves
+		e.vars[stmt.Name.Value] = &Scheme{Type: tv}
+	}
+	t := c.infer(stmt.Value, e)
+	c.unify(tv, t)
+	if stmt.Name.Type != nil {
+		c.checkAnnotation(stmt.Name.Type, t)
+	}
+	c.level--
+	e.vars[stmt.Name.Value] = c.generalize(t)
+	c.idents[stmt.Name] = e.vars[stmt.Name.Value]
+}
+
+func (c *Checker) infer(node ast.Expression, e *env) Type {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.Boolean:
+		return Bool
+	case *ast.StringLiteral:
+		return String
+	case *ast.Identifier:
+		s, ok := e.lookup(node.Value)
+		if !ok {
+			c.errorf(node.Pos(), "undefined: %s", node.Value)
+			return c.newVar()
+		}
+		t := c.instantiate(s)
+		c.idents[node] = &Scheme{Type: t}
+		return t
+	case *ast.PrefixExpression:
+		return c.inferPrefix(node, e)
+	case *ast.InfixExpression:
+		return c.inferInfix(node, e)
+	case *ast.IfExpression:
+		return c.inferIf(node, e)
+	case *ast.TryExpression:
+		return c.inferTry(node, e)
+	case *ast.MatchExpression:
+		return c.inferMatch(node, e)
+	case *ast.SelectExpression:
+		return c.inferSelect(node, e)
+	case *ast.SpawnExpression:
+		return &Task{Result: c.inferCall(node.Call, e)}
+	case *ast.FunctionLiteral:
+		return c.inferFunction(node, e)
+	case *ast.MacroLiteral:
+		return c.newVar()
+	case *ast.CallExpression:
+		if ident, ok := node.Function.(*ast.Identifier); ok && ident.Value == "quote" {
+			if s, _ := e.lookup("quote"); s == builtins.vars["quote"] {
+				return Quote
+			}
+		}
+		return c.inferCall(node, e)
+	case *ast.ArrayLiteral:
+		elem := Type(c.newVar())
+		for _, el := range node.Elements {
+			t := c.infer(el, e)
+			if !c.unify(elem, t) {
+				c.errorf(el.Pos(), "array elements have mismatched types %s and %s", Resolve(elem), Resolve(t))
+			}
+		}
+		return &Array{Elem: elem}
+	case *ast.HashLiteral:
+		key, value := Type(c.newVar()), Type(c.newVar())
+		for _, pair := range node.Pairs {
+			kt := c.infer(pair.Key, e)
+			if !c.unify(key, kt) {
+				c.errorf(pair.Key.Pos(), "hash keys have mismatched types %s and %s", Resolve(key), Resolve(kt))
+			}
+			vt := c.infer(pair.Value, e)
+			if !c.unify(value, vt) {
+				c.errorf(pair.Value.Pos(), "hash values have mismatched types %s and %s", Resolve(value), Resolve(vt))
+			}
+		}
+		return &Hash{Key: key, Value: value}
+	case *ast.IndexExpression:
+		return c.inferIndex(node, e)
+	case *ast.MemberExpression:
+		// modules are only known at run time, so their members are unconstrained
+		c.infer(node.Object, e)
+		return c.newVar()
+	}
+	// missing expressions come from parse errors, which are reported elsewhere
+	return c.newVar()
+}
+
+func (c *Checker) inferPrefix(node *ast.PrefixExpression, e *env) Type {
+	right := c.infer(node.Right, e)
+	if s, ok := e.lookup(node.Operator); ok {
+		return c.inferOperator(node.Operator, s, node.Pos(), right)
+	}
+	switch node.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if !c.unify(right, Int) {
+			c.errorf(node.Pos(), "operator - not defined on %s", Resolve(right))
+		}
+		return Int
+	}
+	// operators implemented by the host are not typed
+	return c.newVar()
+}
+
+// builtinInfix holds the built-in infix operators.
+var builtinInfix = map[string]bool{
+	"+": true, "-": true, "*": true, "/": true,
+	"<": true, ">": true, "==": true, "!=": true,
+}
+
+func (c *Checker) inferInfix(node *ast.InfixExpression, e *env) Type {
+	left := c.infer(node.Left, e)
+	right := c.infer(node.Right, e)
+	if s, ok := e.lookup(node.Operator); ok {
+		return c.inferOperator(node.Operator, s, node.Pos(), left, right)
+	}
+	if !builtinInfix[node.Operator] {
+		// operators implemented by the host are not typed
+		return c.newVar()
+	}
+
+	if !c.unify(left, right) {
+		c.errorf(node.Pos(), "mismatched types %s and %s for %s", Resolve(left), Resolve(right), node.Operator)
+		if node.Operator == "==" || node.Operator == "!=" || node.Operator == "<" || node.Operator == ">" {
+			return Bool
+		}
+		return c.newVar()
+	}
+
+	switch node.Operator {
+	case "+":
+		// + is overloaded on ints and strings; an unknown operand type is
+		// left polymorphic
+		if con, ok := prune(left).(*Con); ok && con != Int && con != String {
+			c.errorf(node.Pos(), "operator + not defined on %s", con)
+		}
+		return left
+	case "-", "*", "/":
+		if !c.unify(left, Int) {
+			c.errorf(node.Pos(), "operator %s not defined on %s", node.Operator, Resolve(left))
+		}
+		return Int
+	case "<", ">":
+		if !c.unify(left, Int) {
+			c.errorf(node.Pos(), "operator %s not defined on %s", node.Operator, Resolve(left))
+		}
+		return Bool
+	case "==", "!=":
+		return Bool
+	}
+	return c.newVar()
+}
+
+// inferOperator types an operator declared by the program as a call of the
+// function it is bound to.
+func (c *Checker) inferOperator(op string, s *Scheme, pos token.Position, operands ...Type) Type {
+	fn := c.instantiate(s)
+	ret := c.newVar()
+	if !c.unify(fn, &Func{Params: operands, Return: ret}) {
+		names := make([]string, len(operands))
+		for i, t := range operands {
+			names[i] = Resolve(t).String()
+		}
+		c.errorf(pos, "cannot use %s as operands of %s (type %s)", strings.Join(names, " and "), op, Resolve(fn))
+	}
+	return ret
+}
+
+func (c *Checker) inferIf(node *ast.IfExpression, e *env) Type {
+	c.infer(node.Condition, e)
+	cons := c.inferStatements(node.Consequence.Statements, e)
+	if node.Alternative == nil {
+		// a missing branch yields null, which is accepted wherever a value
+		// of the consequence's type is
+		return cons
+	}
+	alt := c.inferStatements(node.Alternative.Statements, e)
+	if !c.unify(cons, alt) {
+		c.errorf(node.Pos(), "if branches have mismatched types %s and %s", Resolve(cons), Resolve(alt))
+	}
+	return cons
+}
+
+func (c *Checker) inferTry(node *ast.TryExpression, e *env) Type {
+	result := c.inferStatements(node.Block.Statements, e)
+	if node.Catch != nil {
+		// caught errors are not typed
+		ce := newEnv(e)
+		ce.vars[node.Param.Value] = &Scheme{Type: c.newVar()}
+		c.idents[node.Param] = ce.vars[node.Param.Value]
+		caught := c.inferStatements(node.Catch.Statements, ce)
+		if !c.unify(result, caught) {
+			c.errorf(node.Pos(), "try and catch have mismatched types %s and %s", Resolve(result), Resolve(caught))
+		}
+	}
+	if node.Finally != nil {
+		c.inferStatements(node.Finally.Statements, e)
+	}
+	return result
+}
+
+func (c *Checker) inferFor(node *ast.ForStatement, e *env) {
+	var elem Type
+	switch t := Resolve(c.infer(node.Iterable, e)).(type) {
+	case *Array:
+		elem = t.Elem
+	case *Hash:
+		elem = t.Key
+	case *Iterator:
+		elem = t.Elem
+	case *Chan:
+		elem = t.Elem
+	default:
+		if t == String {
+			elem = String
+		} else {
+			elem = c.newVar()
+		}
+	}
+	le := newEnv(e)
+	le.vars[node.Var.Value] = &Scheme{Type: elem}
+	c.idents[node.Var] = le.vars[node.Var.Value]
+	c.inferStatements(node.Body.Statements, le)
+}
+
+// inferSelect checks each case against its channel's element type; the
+// cases' bodies must agree like match arms.
+func (c *Checker) inferSelect(node *ast.SelectExpression, e *env) Type {
+	var result Type
+	for _, sc := range node.Cases {
+		se := newEnv(e)
+		if !sc.IsDefault() {
+			elem := c.newVar()
+			if t := c.infer(sc.Channel, e); !c.unify(&Chan{Elem: elem}, t) {
+				c.errorf(sc.Channel.Pos(), "cannot select on %s", Resolve(t))
+			}
+			if sc.Value != nil {
+				if t := c.infer(sc.Value, e); !c.unify(elem, t) {
+					c.errorf(sc.Value.Pos(), "cannot send %s on channel[%s]", Resolve(t), Resolve(elem))
+				}
+			}
+			if sc.Var != nil {
+				se.vars[sc.Var.Value] = &Scheme{Type: elem}
+				c.idents[sc.Var] = se.vars[sc.Var.Value]
+			}
+		}
+		t := c.infer(sc.Body, se)
+		if result == nil {
+			result = t
+		} else if !c.unify(result, t) {
+			c.errorf(sc.Body.Pos(), "select cases have mismatched types %s and %s", Resolve(result), Resolve(t))
+		}
+	}
+	return result
+}
+
+func (c *Checker) inferFunction(node *ast.FunctionLiteral, e *env) Type {
+	fe := newEnv(e)
+	ret := c.newVar()
+	fe.ret = ret
+
+	// calling a generator returns an iterator over the values it yields;
+	// what its body returns is dropped
+	var result Type = ret
+	if node.Generator {
+		fe.yield = c.newVar()
+		result = &Iterator{Elem: fe.yield}
+	}
+	if node.ReturnType != nil && !node.Generator {
+		c.unify(ret, c.annotationType(node.ReturnType))
+	}
+
+	// functions with defaults or a variadic param take varying arguments,
+	// so calls to them are not checked
+	variadic := false
+	params := make([]Type, len(node.Params))
+	for i, p := range node.Params {
+		ident, ok := p.Name()
+		if !ok {
+			params[i] = c.patternType(p.Pattern, fe)
+		} else {
+			var tv Type = c.newVar()
+			if p.Variadic {
+				tv = &Array{Elem: c.newVar()}
+			}
+			if ident.Type != nil {
+				tv = c.annotationType(ident.Type)
+			}
+			params[i] = tv
+		}
+		if p.Default != nil {
+			if def := c.infer(p.Default, fe); !c.unify(params[i], def) {
+				name := p.Pattern.String()
+				if ok {
+					name = ident.Value
+				}
+				c.errorf(p.Default.Pos(), "cannot use %s as default for %s", Resolve(def), name)
+			}
+		}
+		if ok {
+			fe.vars[ident.Value] = &Scheme{Type: params[i]}
+			c.idents[ident] = fe.vars[ident.Value]
+		}
+		variadic = variadic || p.Variadic || p.Default != nil
+	}
+
+	body := c.inferStatements(node.Block.Statements, fe)
+	if node.Generator {
+		if node.ReturnType != nil {
+			c.checkAnnotation(node.ReturnType, result)
+		}
+	} else if !c.unify(ret, body) {
+		c.errorf(node.Pos(), "function returns both %s and %s", Resolve(ret), Resolve(body))
+	}
+	return &Func{Params: params, Return: result, Variadic: variadic}
+}
+
+func (c *Checker) inferCall(node *ast.CallExpression, e *env) Type {
+	callee := c.infer(node.Function, e)
+	args := make([]Type, len(node.Args))
+	spread := false
+	for i, a := range node.Args {
+		switch a := a.(type) {
+		case *ast.SpreadExpression:
+			if t := c.infer(a.Value, e); !c.unify(t, &Array{Elem: c.newVar()}) {
+				c.errorf(a.Pos(), "cannot spread %s", Resolve(t))
+			}
+			spread = true
+		case *ast.NamedArgument:
+			c.infer(a.Value, e)
+			spread = true
+		default:
+			args[i] = c.infer(a, e)
+		}
+	}
+
+	switch fn := prune(callee).(type) {
+	case *Func:
+		if fn.Variadic || spread {
+			return fn.Return
+		}
+		if len(fn.Params) != len(args) {
+			c.errorf(node.Pos(), "wrong number of arguments to %s: want=%d, got=%d", node.Function, len(fn.Params), len(args))
+			return fn.Return
+		}
+		for i, param := range fn.Params {
+			if !c.unify(param, args[i]) {
+				c.errorf(node.Args[i].Pos(), "cannot use %s as %s in argument %d to %s", Resolve(args[i]), Resolve(param), i+1, node.Function)
+			}
+		}
+		return fn.Return
+	case *Var:
+		if spread {
+			return c.newVar()
+		}
+		ret := c.newVar()
+		if !c.unify(fn, &Func{Params: args, Return: ret}) {
+			c.errorf(node.Pos(), "infinite type in call to %s", node.Function)
+		}
+		return ret
+	default:
+		c.errorf(node.Pos(), "cannot call non-function %s (type %s)", node.Function, Resolve(callee))
+		return c.newVar()
+	}
+}
+
+func (c *Checker) inferIndex(node *ast.IndexExpression, e *env) Type {
+	left := c.infer(node.Left, e)
+	index := c.infer(node.Index, e)
+
+	if v, ok := prune(left).(*Var); ok && prune(index) == String {
+		c.unify(v, &Hash{Key: String, Value: c.newVar()})
+	}
+
+	switch t := prune(left).(type) {
+	case *Hash:
+		if !c.unify(t.Key, index) {
+			c.errorf(node.Index.Pos(), "cannot index %s with %s", Resolve(left), Resolve(index))
+		}
+		return t.Value
+	default:
+		elem := c.newVar()
+		if !c.unify(left, &Array{Elem: elem}) {
+			c.errorf(node.Pos(), "cannot index %s", Resolve(left))
+			return elem
+		}
+		if !c.unify(index, Int) {
+			c.errorf(node.Index.Pos(), "array index must be int, got %s", Resolve(index))
+		}
+		return elem
+	}
+}
+
+// annotationType returns the type named by an annotation. fn admits any
+// function, so it is left as a fresh variable.
+func (c *Checker) annotationType(a *ast.TypeAnnotation) Type {
+	switch a.Name {
+	case "int":
+		return Int
+	case "bool":
+		return Bool
+	case "string":
+		return String
+	case "null":
+		return Null
+	case "array":
+		return &Array{Elem: c.newVar()}
+	case "hash":
+		return &Hash{Key: c.newVar(), Value: c.newVar()}
+	case "iterator":
+		return &Iterator{Elem: c.newVar()}
+	}
+	return c.newVar()
+}
+
+func (c *Checker) checkAnnotation(a *ast.TypeAnnotation, t Type) {
+	want := c.annotationType(a)
+	if !c.unify(want, t) {
+		c.errorf(a.Pos(), "cannot use %s as %s", Resolve(t), Resolve(want))
+	}
+}
+
+// unify makes a and b the same type, reporting whether that is possible.
+func (c *Checker) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+
+	if v, ok := a.(*Var); ok {
+		if a == b {
+			return true
+		}
+		if occurs(v, b) {
+			return false
+		}
+		adjustLevels(b, v.level)
+		v.Instance = b
+		return true
+	}
+	if _, ok := b.(*Var); ok {
+		return c.unify(b, a)
+	}
+
+	switch a := a.(type) {
+	case *Con:
+		return a == b
+	case *Func:
+		b, ok := b.(*Func)
+		if !ok {
+			return false
+		}
+		if a.Variadic || b.Variadic {
+			return c.unify(a.Return, b.Return)
+		}
+		if len(a.Params) != len(b.Params) {
+			return false
+		}
+		for i := range a.Params {
+			if !c.unify(a.Params[i], b.Params[i]) {
+				return false
+			}
+		}
+		return c.unify(a.Return, b.Return)
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && c.unify(a.Elem, b.Elem)
+	case *Iterator:
+		b, ok := b.(*Iterator)
+		return ok && c.unify(a.Elem, b.Elem)
+	case *Chan:
+		b, ok := b.(*Chan)
+		return ok && c.unify(a.Elem, b.Elem)
+	case *Task:
+		b, ok := b.(*Task)
+		return ok && c.unify(a.Result, b.Result)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && c.unify(a.Key, b.Key) && c.unify(a.Value, b.Value)
+	}
+	return false
+}
+
+func occurs(v *Var, t Type) bool {
+	switch t := prune(t).(type) {
+	case *Var:
+		return t == v
+	case *Func:
+		for _, p := range t.Params {
+			if occurs(v, p) {
+				return true
+			}
+		}
+		return occurs(v, t.Return)
+	case *Array:
+		return occurs(v, t.Elem)
+	case *Iterator:
+		return occurs(v, t.Elem)
+	case *Chan:
+		return occurs(v, t.Elem)
+	case *Task:
+		return occurs(v, t.Result)
+	case *Hash:
+		return occurs(v, t.Key) || occurs(v, t.Value)
+	}
+	return false
+}
+
+func adjustLevels(t Type, level int) {
+	switch t := prune(t).(type) {
+	case *Var:
+		if t.level > level {
+			t.level = level
+		}
+	case *Func:
+		for _, p := range t.Params {
+			adjustLevels(p, level)
+		}
+		adjustLevels(t.Return, level)
+	case *Array:
+		adjustLevels(t.Elem, level)
+	case *Iterator:
+		adjustLevels(t.Elem, level)
+	case *Chan:
+		adjustLevels(t.Elem, level)
+	case *Task:
+		adjustLevels(t.Result, level)
+	case *Hash:
+		adjustLevels(t.Key, level)
+		adjustLevels(t.Value, level)
+	}
+}
+
+// generalize quantifies the variables of t created inside the current let.
+// Those of channel elements are left alone, as every send and receive on a
+// channel must agree.
+func (c *Checker) generalize(t Type) *Scheme {
+	s := &Scheme{Type: t}
+	seen := map[*Var]bool{}
+	var walk func(Type)
+	walk = func(t Type) {
+		switch t := prune(t).(type) {
+		case *Var:
+			if t.level > c.level && !seen[t] {
+				seen[t] = true
+				s.Vars = append(s.Vars, t)
+			}
+		case *Func:
+			for _, p := range t.Params {
+				walk(p)
+			}
+			walk(t.Return)
+		case *Array:
+			walk(t.Elem)
+		case *Iterator:
+			walk(t.Elem)
+		case *Chan:
+			adjustLevels(t.Elem, c.level)
+		case *Task:
+			walk(t.Result)
+		case *Hash:
+			walk(t.Key)
+			walk(t.Value)
+		}
+	}
+	walk(t)
+	return s
+}
+
+func (c *Checker) instantiate(s *Scheme) Type {
+	if len(s.Vars) == 0 {
+		return s.Type
+	}
+	fresh := make(map[*Var]Type, len(s.Vars))
+	for _, v := range s.Vars {
+		fresh[v] = c.newVar()
+	}
+	return substitute(s.Type, fresh)
+}
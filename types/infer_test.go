@@ -0,0 +1,145 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/jarviliam/inti/ast"
+	"github.com/jarviliam/inti/lexer"
+	"github.com/jarviliam/inti/parser"
+)
+
+func TestInferBindings(t *testing.T) {
+	testCases := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{"let x = 5;", "x", "int"},
+		{"let s = \"a\" + \"b\";", "s", "string"},
+		{"let b = 1 < 2 == true;", "b", "bool"},
+		{"let add = fn(x, y) { x + y * 2 };", "add", "fn(int, int) -> int"},
+		{"let id = fn(x) { x };", "id", "fn(a) -> a"},
+		{"let xs = [1, 2, 3];", "xs", "[int]"},
+		{"let h = {\"a\": true};", "h", "{string: bool}"},
+		{"let first = fn(xs) { xs[0] };", "first", "fn([a]) -> a"},
+		{"let f = fn(n) { if (n < 1) { return 0; } f(n - 1) };", "f", "fn(int) -> int"},
+		{"let id = fn(x) { x }; let pair = [id(1), id(2)];", "pair", "[int]"},
+		{"let id = fn(x) { x }; let b = id(true);", "b", "bool"},
+		{"let f = fn(a: string) { a };", "f", "fn(string) -> string"},
+		{"let f = fn(a) -> bool { a };", "f", "fn(bool) -> bool"},
+		{"let n: int = len([1]);", "n", "int"},
+		{"let p = push([1], first([2]));", "p", "[int]"},
+		{"let f = fn(x) { try { x + 1 } catch (e) { 0 } };", "f", "fn(int) -> int"},
+		{"let e = 5; let n = try { 1 } catch (e) { 2 };", "e", "int"},
+		{"let xs = [\"a\"]; let f = fn() { for (x in xs) { return x; } \"\" };", "f", "fn() -> string"},
+		{"let x = 5; for (x in [\"a\"]) { let y = x; }", "x", "int"},
+		{"let f = fn(x) { if (x) { 1 } else { throw \"no\" } };", "f", "fn(a) -> int"},
+		{"let [a, ...r] = [1, 2];", "r", "[int]"},
+		{"let {x, y: z} = {\"x\": true, \"y\": false};", "z", "bool"},
+		{"let f = fn([a, b]) { a * b };", "f", "fn([int]) -> int"},
+		{"let f = fn({n}) { n };", "f", "fn({string: a}) -> a"},
+		{"let f = fn(xs) { match (xs) { [] => 0, [h, ...t] => h + len(t) } };", "f", "fn([int]) -> int"},
+		{"let f = fn(r) { match (r) { {\"n\": n} if n > 0 => n, _ => 0 } };", "f", "fn({string: int}) -> int"},
+		{"let f = fn(a, b = 2) { a * b }; let n = f(1, b: 3);", "n", "int"},
+		{"let f = fn(...xs) { xs }; let ys = f(1, 2);", "ys", "[a]"},
+		{"let f = fn(a, b) { a * b }; let n = f(...[1, 2]);", "n", "int"},
+		{"let g = fn(n) { yield n; yield n + 1 };", "g", "fn(int) -> iterator[int]"},
+		{"let g = fn() { yield \"a\" }; let h = fn() { for (s in g()) { yield s; } };", "h", "fn() -> iterator[string]"},
+		{"let g = fn() { yield true }; let b = next(take(g(), 1));", "b", "bool"},
+		{"let t = spawn len([1]);", "t", "task[int]"},
+		{"let c = channel(); send(c, \"a\"); let s = receive(c);", "s", "string"},
+		{"let c = channel(1); let n = select { receive(c) as x => x + 1, _ => 0 };", "n", "int"},
+		{"let c = channel(); let f = fn() { for (x in c) { return !x; } false };", "f", "fn() -> bool"},
+		{"infixl 6 <+> = fn(a, b) { [a, b] }; let p = 1 <+> 2;", "p", "[int]"},
+		{"infixr 5 |> = fn(x, f) { f(x) }; let s = 1 |> fn(n) { \"a\" };", "s", "string"},
+		{"let q = quote(undefined + 1);", "q", "quote"},
+		{"let m = macro(x) { quote(unquote(x) + y) }; let b = m(1) == 2;", "b", "bool"},
+	}
+	for _, tC := range testCases {
+		c := NewChecker()
+		errs := c.Check(parse(t, tC.input))
+		if len(errs) != 0 {
+			t.Errorf("%q: unexpected errors %v", tC.input, errs)
+			continue
+		}
+		s, ok := c.Lookup(tC.name)
+		if !ok {
+			t.Errorf("%q: %s not bound", tC.input, tC.name)
+			continue
+		}
+		if s.String() != tC.expected {
+			t.Errorf("%q: type of %s wrong. want=%q, got=%q", tC.input, tC.name, tC.expected, s.String())
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + true", "1:3: mismatched types int and bool for +"},
+		{"true - false", "1:6: operator - not defined on bool"},
+		{"let x = 5;\nx(1)", "2:2: cannot call non-function x (type int)"},
+		{"let f = fn(x) { x + 1 };\nf(\"a\")", "2:3: cannot use string as int in argument 1 to f"},
+		{"let f = fn(x, y) { x };\nf(1)", "2:2: wrong number of arguments to f: want=2, got=1"},
+		{"if (true) { 1 } else { \"a\" }", "1:1: if branches have mismatched types int and string"},
+		{"[1, \"a\"]", "1:5: array elements have mismatched types int and string"},
+		{"foo + 1", "1:1: undefined: foo"},
+		{"let f = fn(x) { x(x) };", "1:18: infinite type in call to x"},
+		{"let x: bool = 5;", "1:8: cannot use int as bool"},
+		{"let f = fn(a: int) { a }; f(true)", "1:29: cannot use bool as int in argument 1 to f"},
+		{"let f = fn() -> string { 1 };", "1:9: function returns both string and int"},
+		{"push([1], true)", "1:11: cannot use bool as int in argument 2 to push"},
+		{"try { 1 } catch (e) { \"a\" }", "1:1: try and catch have mismatched types int and string"},
+		{"let [1] = [true];", "1:5: cannot destructure [bool] as [int]"},
+		{"match (1) { \"a\" => 1 }", "1:13: pattern of type string cannot match int"},
+		{"match (1) { 1 => 1, _ => \"a\" }", "1:26: match arms have mismatched types int and string"},
+		{"let f = fn(a: int = \"x\") { a };", "1:21: cannot use string as default for a"},
+		{"let f = fn(a) { a }; f(...1)", "1:24: cannot spread int"},
+		{"let g = fn() { yield 1; yield \"a\" };", "1:25: cannot yield string, expected int"},
+		{"let g = fn() -> int { yield 1 };", "1:17: cannot use iterator[int] as int"},
+		{"let c = channel(); send(c, 1); send(c, true)", "1:40: cannot use bool as int in argument 2 to send"},
+		{"select { receive(1) => 1 }", "1:18: cannot select on int"},
+		{"let c = channel(); send(c, 1); select { send(c, \"a\") => 1 }", "1:49: cannot send string on channel[int]"},
+		{"let c = channel(); select { receive(c) => 1, _ => true }", "1:51: select cases have mismatched types int and bool"},
+		{"let t = spawn len([1]); await(t) + true", "1:34: mismatched types int and bool for +"},
+		{"infixl 6 <+> = fn(a, b) { a * b }; 1 <+> \"a\"", "1:38: cannot use int and string as operands of <+> (type fn(int, int) -> int)"},
+	}
+	for _, tC := range testCases {
+		errs := Check(parse(t, tC.input))
+		if len(errs) == 0 {
+			t.Errorf("%q: expected error %q", tC.input, tC.expected)
+			continue
+		}
+		if errs[0].Error() != tC.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tC.input, tC.expected, errs[0].Error())
+		}
+	}
+}
+
+func TestCheckerKeepsBindingsAcrossPrograms(t *testing.T) {
+	c := NewChecker()
+	if errs := c.Check(parse(t, "let x = 1;")); len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+	if errs := c.Check(parse(t, "let y = z;")); len(errs) == 0 {
+		t.Fatalf("expected an error for an undefined name")
+	}
+	if _, ok := c.Lookup("y"); ok {
+		t.Errorf("binding from a failing program was kept")
+	}
+	errs := c.Check(parse(t, "x + true"))
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v", errs)
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
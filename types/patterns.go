@@ -0,0 +1,85 @@
+package types
+
+import "github.com/jarviliam/inti/ast"
+
+func (c *Checker) inferMatch(node *ast.MatchExpression, e *env) Type {
+	subject := c.infer(node.Subject, e)
+	var result Type
+	for _, arm := range node.Arms {
+		ae := newEnv(e)
+		pt := c.patternType(arm.Pattern, ae)
+		if !c.unify(subject, pt) {
+			c.errorf(arm.Pattern.Pos(), "pattern of type %s cannot match %s", Resolve(pt), Resolve(subject))
+		}
+		if arm.Guard != nil {
+			c.infer(arm.Guard, ae)
+		}
+		t := c.infer(arm.Body, ae)
+		if result == nil {
+			result = t
+		} else if !c.unify(result, t) {
+			c.errorf(arm.Body.Pos(), "match arms have mismatched types %s and %s", Resolve(result), Resolve(t))
+		}
+	}
+	return result
+}
+
+func (c *Checker) inferLetPattern(stmt *ast.LetStatement, e *env) {
+	c.level++
+	t := c.infer(stmt.Value, e)
+	pe := newEnv(nil)
+	if pt := c.patternType(stmt.Pattern, pe); !c.unify(pt, t) {
+		c.errorf(stmt.Pattern.Pos(), "cannot destructure %s as %s", Resolve(t), Resolve(pt))
+	}
+	c.level--
+	for _, name := range ast.PatternNames(stmt.Pattern) {
+		e.vars[name.Value] = c.generalize(pe.vars[name.Value].Type)
+		c.idents[name] = e.vars[name.Value]
+	}
+}
+
+// patternType returns the type of the values pat matches, binding the
+// names in it in e.
+func (c *Checker) patternType(pat ast.Pattern, e *env) Type {
+	switch pat := pat.(type) {
+	case *ast.Identifier:
+		v := c.newVar()
+		if pat.Value != "_" {
+			e.vars[pat.Value] = &Scheme{Type: v}
+			c.idents[pat] = e.vars[pat.Value]
+		}
+		return v
+	case *ast.LiteralPattern:
+		return c.infer(pat.Value, e)
+	case *ast.ArrayPattern:
+		elem := Type(c.newVar())
+		for _, el := range pat.Elements {
+			t := c.patternType(el, e)
+			if !c.unify(elem, t) {
+				c.errorf(el.Pos(), "array elements have mismatched types %s and %s", Resolve(elem), Resolve(t))
+			}
+		}
+		arr := &Array{Elem: elem}
+		if pat.Rest != nil && pat.Rest.Value != "_" {
+			e.vars[pat.Rest.Value] = &Scheme{Type: arr}
+			c.idents[pat.Rest] = e.vars[pat.Rest.Value]
+		}
+		return arr
+	case *ast.HashPattern:
+		key, value := Type(c.newVar()), Type(c.newVar())
+		for _, pair := range pat.Pairs {
+			var kt Type = String
+			if _, ok := pair.Key.(*ast.Identifier); !ok {
+				kt = c.infer(pair.Key, e)
+			}
+			if !c.unify(key, kt) {
+				c.errorf(pair.Key.Pos(), "hash keys have mismatched types %s and %s", Resolve(key), Resolve(kt))
+			}
+			if vt := c.patternType(pair.Value, e); !c.unify(value, vt) {
+				c.errorf(pair.Value.Pos(), "hash values have mismatched types %s and %s", Resolve(value), Resolve(vt))
+			}
+		}
+		return &Hash{Key: key, Value: value}
+	}
+	return c.newVar()
+}
@@ -0,0 +1,150 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is an inferred type. Type variables are bound in place during
+// unification, so a Type should be pruned before it is inspected.
+type Type interface {
+	String() string
+}
+
+// Con is a nullary type constructor such as int or bool.
+type Con struct {
+	Name string
+}
+
+func (c *Con) String() string { return c.Name }
+
+var (
+	Int    = &Con{Name: "int"}
+	Bool   = &Con{Name: "bool"}
+	String = &Con{Name: "string"}
+	Null   = &Con{Name: "null"}
+	Quote  = &Con{Name: "quote"}
+)
+
+type Func struct {
+	Params []Type
+	Return Type
+	// Variadic functions accept any number of arguments of any type.
+	Variadic bool
+}
+
+func (f *Func) String() string {
+	if f.Variadic {
+		return fmt.Sprintf("fn(...) -> %s", f.Return)
+	}
+	params := []string{}
+	for _, p := range f.Params {
+		params = append(params, p.String())
+	}
+	return fmt.Sprintf("fn(%s) -> %s", strings.Join(params, ", "), f.Return)
+}
+
+type Array struct {
+	Elem Type
+}
+
+func (a *Array) String() string { return "[" + a.Elem.String() + "]" }
+
+// Iterator is the type of the iterators generator functions return.
+type Iterator struct {
+	Elem Type
+}
+
+func (i *Iterator) String() string { return "iterator[" + i.Elem.String() + "]" }
+
+// Chan is the type of channels carrying values of type Elem.
+type Chan struct {
+	Elem Type
+}
+
+func (c *Chan) String() string { return "channel[" + c.Elem.String() + "]" }
+
+// Task is the type of spawned calls returning values of type Result.
+type Task struct {
+	Result Type
+}
+
+func (t *Task) String() string { return "task[" + t.Result.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Var is a type variable. Once unified it points at its instance.
+type Var struct {
+	ID       int
+	Instance Type
+	// level is the let-nesting depth the variable was created at; variables
+	// deeper than the enclosing let are generalised.
+	level int
+}
+
+func (v *Var) String() string {
+	if v.Instance != nil {
+		return v.Instance.String()
+	}
+	return fmt.Sprintf("t%d", v.ID)
+}
+
+// Scheme is a type quantified over some of its variables.
+type Scheme struct {
+	Vars []*Var
+	Type Type
+}
+
+// String prints s with its quantified variables named a, b, c...
+func (s *Scheme) String() string {
+	names := make(map[*Var]Type, len(s.Vars))
+	for i, v := range s.Vars {
+		names[v] = &Con{Name: string(rune('a' + i%26))}
+	}
+	return substitute(s.Type, names).String()
+}
+
+func substitute(t Type, sub map[*Var]Type) Type {
+	switch t := prune(t).(type) {
+	case *Var:
+		if s, ok := sub[t]; ok {
+			return s
+		}
+		return t
+	case *Func:
+		params := make([]Type, len(t.Params))
+		for i, p := range t.Params {
+			params[i] = substitute(p, sub)
+		}
+		return &Func{Params: params, Return: substitute(t.Return, sub), Variadic: t.Variadic}
+	case *Array:
+		return &Array{Elem: substitute(t.Elem, sub)}
+	case *Iterator:
+		return &Iterator{Elem: substitute(t.Elem, sub)}
+	case *Chan:
+		return &Chan{Elem: substitute(t.Elem, sub)}
+	case *Task:
+		return &Task{Result: substitute(t.Result, sub)}
+	case *Hash:
+		return &Hash{Key: substitute(t.Key, sub), Value: substitute(t.Value, sub)}
+	}
+	return t
+}
+
+func prune(t Type) Type {
+	if v, ok := t.(*Var); ok && v.Instance != nil {
+		v.Instance = prune(v.Instance)
+		return v.Instance
+	}
+	return t
+}
+
+// Resolve returns t with every bound type variable replaced by its instance.
+func Resolve(t Type) Type {
+	return substitute(t, nil)
+}